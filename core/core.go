@@ -102,6 +102,32 @@ type StateDriver interface {
 	ClearState(key string) error
 }
 
+type WatchableStateDriver interface {
+	// A watchable state driver notifies the keys that change under a base
+	// key, letting its consumers keep the state in memory. The keys are
+	// delivered until 'stop' is closed, after which the keys channel is
+	// closed. The keys channel is also closed if the watch fails.
+	StateDriver
+	WatchAll(baseKey string, keys chan string, stop chan bool) error
+}
+
+type LeaseDriver interface {
+	// A lease driver provides mechanism to hold a key for a limited time
+	// (ttl, in seconds), after which the key expires unless renewed by its
+	// holder. It is the building block to elect a leader amongst the
+	// instances of a logically centralized function.
+	AcquireLease(key, holder string, ttl uint64) (bool, error)
+	RenewLease(key, holder string, ttl uint64) error
+	ReleaseLease(key, holder string) error
+}
+
+type HealthChecker interface {
+	// A health checker reports whether a driver is able to reach the
+	// entities it depends upon (like a database or a daemon). Drivers
+	// implement it optionally, in addition to their primary interface.
+	CheckHealth() error
+}
+
 type Resource interface {
 	// Resource defines a allocatable unit. A resource is uniquely identified
 	// by 'Id'. A resource description identifies the nature of the resource.
@@ -113,6 +139,53 @@ type Resource interface {
 	Deallocate(interface{}) error
 }
 
+type ReservableResource interface {
+	// A reservable resource allows allocating a specific value, like a
+	// statically configured one, in addition to the next available value.
+	// The owner, like the name of the value's user, is recorded by the
+	// resources that keep track of the owners of their values.
+	Resource
+	Reserve(value interface{}, owner string) error
+}
+
+type HintedResource interface {
+	// A hinted resource takes a hint, like the name of the value's user,
+	// into account when picking the next available value.
+	Resource
+	AllocateWithHint(hint string) (interface{}, error)
+}
+
+type ResizableResource interface {
+	// A resizable resource allows changing its range of values in place,
+	// keeping the values that are allocated.
+	Resource
+	Resize(rsrcCfg interface{}) error
+}
+
+type UsageReportingResource interface {
+	// A usage reporting resource reports how much of its range of values is
+	// in use, along with the values allocated.
+	Resource
+	Usage() ([]ResourceUsage, error)
+}
+
+type AllocatedValue struct {
+	Value string `json:"value"`
+	// network (or other user) the value is allocated to, empty if unknown
+	Owner string `json:"owner,omitempty"`
+}
+
+type ResourceUsage struct {
+	// A resource with more than one range of values, like the vxlans and
+	// their local vlans, reports a usage per range.
+	Id          string           `json:"id"`
+	Description string           `json:"description"`
+	Capacity    uint             `json:"capacity"`
+	Used        uint             `json:"used"`
+	Free        uint             `json:"free"`
+	Allocated   []AllocatedValue `json:"allocated"`
+}
+
 type ResourceManager interface {
 	// A resource manager provides mechanism to manage (define/undefine,
 	// allocate/deallocate) resources. Example, it may provide management in
@@ -121,6 +194,10 @@ type ResourceManager interface {
 	Deinit()
 	DefineResource(id, desc string, rsrcCfg interface{}) error
 	UndefineResource(id, desc string) error
+	RedefineResource(id, desc string, rsrcCfg interface{}) error
 	AllocateResourceVal(id, desc string) (interface{}, error)
+	AllocateResourceValWithHint(id, desc, hint string) (interface{}, error)
+	ReserveResourceVal(id, desc string, value interface{}, owner string) error
 	DeallocateResourceVal(id, desc string, value interface{}) error
+	GetResourceUsage(id string) ([]ResourceUsage, error)
 }
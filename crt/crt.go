@@ -20,6 +20,7 @@ import (
 	"errors"
 	"reflect"
 
+	"github.com/contiv/netplugin/core"
 	"github.com/contiv/netplugin/crtclient"
 	"github.com/contiv/netplugin/crtclient/docker"
 )
@@ -63,6 +64,16 @@ func (c *Crt) GetContainerName(contId string) (string, error) {
 	return c.ContainerIf.GetContainerName(contId)
 }
 
+// CheckHealth reports the connectivity to the container runtime, if the
+// runtime client supports checking it
+func (c *Crt) CheckHealth() error {
+	checker, ok := c.ContainerIf.(core.HealthChecker)
+	if !ok {
+		return nil
+	}
+	return checker.CheckHealth()
+}
+
 func (c *Crt) Deinit() {
 	c.ContainerIf.Deinit()
 }
@@ -31,6 +31,17 @@ type ContainerEpContext struct {
 	IpAddress      string
 	SubnetLen      uint
 	DefaultGw      string
+	MacAddress     string
+	// addresses configured besides IpAddress, as 'ip/len'
+	SecondaryIps []string
+	// subnets of the endpoint's network, other than the ones of its
+	// addresses, reached directly on the interface, as 'ip/len'
+	OnLinkRoutes []string
+	// subnets reached through DefaultGw, as 'ip/len' or 'default'
+	Routes []string
+	// container ports published on the ports of the host, as
+	// 'hostPort:containerPort/protocol'
+	PublishedPorts []string
 }
 
 type ContainerIf interface {
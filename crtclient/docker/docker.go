@@ -26,6 +26,7 @@ import (
 	"strconv"
 
 	"github.com/contiv/netplugin/crtclient"
+	"github.com/contiv/netplugin/netutils"
 	"github.com/vishvananda/netlink"
 	// "github.com/vishvananda/netns"
 )
@@ -64,6 +65,11 @@ func (d *Docker) Init(config *crtclient.Config) error {
 func (d *Docker) Deinit() {
 }
 
+func (d *Docker) CheckHealth() error {
+	_, err := d.Client.Version()
+	return err
+}
+
 func (d *Docker) getContPid(ctx *crtclient.ContainerEpContext) (string, error) {
 
 	contNameOrId := ctx.NewContName
@@ -269,6 +275,17 @@ func (d *Docker) configureIfAddress(ctx *crtclient.ContainerEpContext) error {
 		return err
 	}
 
+	for _, secondaryIp := range ctx.SecondaryIps {
+		out, err = exec.Command("/sbin/ip", "netns", "exec", contPid, "ip",
+			"addr", "add", secondaryIp, "dev", ctx.InterfaceId).Output()
+		if err != nil {
+			log.Printf("error configuring secondary ip address %s for "+
+				"interface %s out = '%s', err = '%s'\n", secondaryIp,
+				ctx.InterfaceId, out, err)
+			return err
+		}
+	}
+
 	out, err = exec.Command("/sbin/ip", "netns", "exec", contPid, "ip",
 		"link", "set", ctx.InterfaceId, "up").Output()
 	if err != nil {
@@ -276,11 +293,117 @@ func (d *Docker) configureIfAddress(ctx *crtclient.ContainerEpContext) error {
 			ctx.InterfaceId, out, err)
 		return err
 	}
+
+	// the other subnets of the network are on the same segment
+	for _, route := range ctx.OnLinkRoutes {
+		out, err = exec.Command("/sbin/ip", "netns", "exec", contPid, "ip",
+			"route", "replace", route, "dev", ctx.InterfaceId).Output()
+		if err != nil {
+			log.Printf("error adding route %s on interface %s "+
+				"out = '%s', err = '%s'\n", route, ctx.InterfaceId, out, err)
+			return err
+		}
+	}
+
+	// the gateway may be outside the subnet of the address, e.g. of an
+	// address in a subnet the network grew by
+	for _, route := range ctx.Routes {
+		out, err = exec.Command("/sbin/ip", "netns", "exec", contPid, "ip",
+			"route", "replace", route, "via", ctx.DefaultGw, "dev",
+			ctx.InterfaceId, "onlink").Output()
+		if err != nil {
+			log.Printf("error adding route %s via %s for interface %s "+
+				"out = '%s', err = '%s'\n", route, ctx.DefaultGw,
+				ctx.InterfaceId, out, err)
+			return err
+		}
+	}
 	log.Printf("successfully configured ip and brought up the interface \n")
 
 	return err
 }
 
+func (d *Docker) configureIfMac(ctx *crtclient.ContainerEpContext) error {
+
+	log.Printf("configuring mac: %s on if %s for container %s\n",
+		ctx.MacAddress, ctx.InterfaceId, ctx.NewContName)
+
+	if ctx.MacAddress == "" {
+		return nil
+	}
+
+	contPid, err := d.getContPid(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command("/sbin/ip", "netns", "exec", contPid, "ip",
+		"link", "set", "dev", ctx.InterfaceId, "address",
+		ctx.MacAddress).Output()
+	if err != nil {
+		log.Printf("error configuring mac address for interface %s "+
+			"out = '%s', err = '%s'\n", ctx.InterfaceId, out, err)
+		return err
+	}
+
+	return err
+}
+
+// portRules returns the iptables commands that check (-C), append (-A) or
+// delete (-D) the rules publishing the container's ports on the host; the
+// traffic to the host's ports, from outside or from the host itself, is
+// translated to the container's address
+func portRules(ctx *crtclient.ContainerEpContext, op string) [][]string {
+	cmds := [][]string{}
+	for _, port := range ctx.PublishedPorts {
+		hostPort, contPort, protocol, err := netutils.ParsePortMapping(port)
+		if err != nil {
+			log.Printf("error '%s' publishing port %s \n", err, port)
+			continue
+		}
+		dest := fmt.Sprintf("%s:%d", ctx.IpAddress, contPort)
+		for _, chain := range []string{"PREROUTING", "OUTPUT"} {
+			cmds = append(cmds, []string{"/sbin/iptables", "-t", "nat", op,
+				chain, "-p", protocol, "-m", "addrtype", "--dst-type", "LOCAL",
+				"--dport", strconv.Itoa(int(hostPort)), "-j", "DNAT",
+				"--to-destination", dest})
+		}
+		cmds = append(cmds, []string{"/sbin/iptables", "-t", "filter", op,
+			"FORWARD", "-p", protocol, "-d", ctx.IpAddress, "--dport",
+			strconv.Itoa(int(contPort)), "-j", "ACCEPT"})
+	}
+	return cmds
+}
+
+// publishPorts adds the rules publishing the container's ports on the host,
+// keeping the ones already added, e.g. when the container is restarted
+func (d *Docker) publishPorts(ctx *crtclient.ContainerEpContext) error {
+	checks := portRules(ctx, "-C")
+	for i, cmd := range portRules(ctx, "-A") {
+		if exec.Command(checks[i][0], checks[i][1:]...).Run() == nil {
+			continue
+		}
+		out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+		if err != nil {
+			log.Printf("error publishing ports of container %s "+
+				"out = '%s', err = '%s'\n", ctx.NewContName, out, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// unpublishPorts removes the rules publishing the container's ports
+func (d *Docker) unpublishPorts(ctx *crtclient.ContainerEpContext) {
+	for _, cmd := range portRules(ctx, "-D") {
+		out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+		if err != nil {
+			log.Printf("error unpublishing ports of container %s "+
+				"out = '%s', err = '%s'\n", ctx.CurrContName, out, err)
+		}
+	}
+}
+
 // performs funtion to configure the network access and policies
 // before the container becomes active
 func (d *Docker) AttachEndpoint(ctx *crtclient.ContainerEpContext) error {
@@ -290,11 +413,21 @@ func (d *Docker) AttachEndpoint(ctx *crtclient.ContainerEpContext) error {
 		return err
 	}
 
+	err = d.configureIfMac(ctx)
+	if err != nil {
+		return err
+	}
+
 	err = d.configureIfAddress(ctx)
 	if err != nil {
 		return err
 	}
 
+	err = d.publishPorts(ctx)
+	if err != nil {
+		return err
+	}
+
 	// configure policies: acl/qos for the container on the host
 
 	// cleanup intermediate things (overdoing it?)
@@ -313,6 +446,8 @@ func (d *Docker) DetachEndpoint(ctx *crtclient.ContainerEpContext) error {
 	// no need to move the interface out of containre, etc.
 	// usually deletion of ep takes care of that
 
+	d.unpublishPorts(ctx)
+
 	// TODO: unconfigure policies
 
 	return err
@@ -17,6 +17,7 @@ package drivers
 
 import (
 	"fmt"
+	"log"
 	"reflect"
 
 	"github.com/contiv/go-etcd/etcd"
@@ -55,6 +56,12 @@ func (d *EtcdStateDriver) Init(config *core.Config) error {
 func (d *EtcdStateDriver) Deinit() {
 }
 
+func (d *EtcdStateDriver) CheckHealth() error {
+	// a missing key still means that etcd is reachable
+	_, err := d.Read(BASE_PATH)
+	return core.ErrIfKeyExists(err)
+}
+
 func (d *EtcdStateDriver) Write(key string, value []byte) error {
 	_, err := d.Client.Set(key, string(value[:]), 0)
 
@@ -104,6 +111,78 @@ func (d *EtcdStateDriver) ReadState(key string, value core.State,
 	return nil
 }
 
+const (
+	// etcd error codes, as returned in etcd.EtcdError
+	ETCD_ERR_KEY_NOT_FOUND = 100
+	ETCD_ERR_TEST_FAILED   = 101
+	ETCD_ERR_NODE_EXIST    = 105
+)
+
+func etcdErrorCode(err error) int {
+	if etcdErr, ok := err.(*etcd.EtcdError); ok {
+		return etcdErr.ErrorCode
+	}
+	return 0
+}
+
+// AcquireLease atomically creates the key with the holder as its value. The
+// lease is not acquired if the key is held by another holder.
+func (d *EtcdStateDriver) AcquireLease(key, holder string, ttl uint64) (bool, error) {
+	_, err := d.Client.Create(key, holder, ttl)
+	if err == nil {
+		return true, nil
+	}
+	if etcdErrorCode(err) != ETCD_ERR_NODE_EXIST {
+		return false, err
+	}
+
+	// the lease might already be ours, refresh it in that case
+	err = d.RenewLease(key, holder, ttl)
+	if err != nil {
+		if code := etcdErrorCode(err); code == ETCD_ERR_TEST_FAILED ||
+			code == ETCD_ERR_KEY_NOT_FOUND {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *EtcdStateDriver) RenewLease(key, holder string, ttl uint64) error {
+	_, err := d.Client.CompareAndSwap(key, holder, ttl, holder, 0)
+	return err
+}
+
+func (d *EtcdStateDriver) ReleaseLease(key, holder string) error {
+	_, err := d.Client.CompareAndDelete(key, holder, 0)
+	return err
+}
+
+// WatchAll delivers the keys changed under the base key until stopped. The
+// etcd client closes the responses channel once its watch returns, which in
+// turn closes the keys channel.
+func (d *EtcdStateDriver) WatchAll(baseKey string, keys chan string,
+	stop chan bool) error {
+	rsps := make(chan *etcd.Response)
+	go func() {
+		defer close(keys)
+		for rsp := range rsps {
+			if rsp.Node != nil {
+				keys <- rsp.Node.Key
+			}
+		}
+	}()
+
+	go func() {
+		_, err := d.Client.Watch(baseKey, 0, true, rsps, stop)
+		if err != nil && err != etcd.ErrWatchStoppedByUser {
+			log.Printf("etcd watch of %q failed. Error: %s \n", baseKey, err)
+		}
+	}()
+
+	return nil
+}
+
 // XXX: move this to some common file
 func ReadAllStateCommon(d core.StateDriver, baseKey string, sType core.State,
 	unmarshal func([]byte, interface{}) error) ([]core.State, error) {
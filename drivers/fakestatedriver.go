@@ -1,8 +1,11 @@
 package drivers
 
 import (
+	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/contiv/netplugin/core"
 )
@@ -14,8 +17,18 @@ type ValueData struct {
 	value []byte
 }
 
+type fakeWatch struct {
+	baseKey string
+	keys    chan string
+	stop    chan bool
+}
+
 type FakeStateDriver struct {
 	TestState map[string]ValueData
+	leases    map[string]time.Time
+	// watches are added and removed by the watching goroutines
+	watchMutex sync.Mutex
+	watches    []*fakeWatch
 }
 
 func (d *FakeStateDriver) Init(config *core.Config) error {
@@ -31,6 +44,7 @@ func (d *FakeStateDriver) Deinit() {
 func (d *FakeStateDriver) Write(key string, value []byte) error {
 	val := ValueData{value: value}
 	d.TestState[key] = val
+	d.notifyWatches(key)
 
 	return nil
 }
@@ -57,10 +71,53 @@ func (d *FakeStateDriver) ReadAll(baseKey string) ([][]byte, error) {
 func (d *FakeStateDriver) ClearState(key string) error {
 	if _, ok := d.TestState[key]; ok {
 		delete(d.TestState, key)
+		d.notifyWatches(key)
 	}
 	return nil
 }
 
+// WatchAll registers the watch before returning, so that no change made after
+// the call is missed
+func (d *FakeStateDriver) WatchAll(baseKey string, keys chan string,
+	stop chan bool) error {
+	w := &fakeWatch{baseKey: baseKey, keys: keys, stop: stop}
+	d.watchMutex.Lock()
+	d.watches = append(d.watches, w)
+	d.watchMutex.Unlock()
+
+	go func() {
+		<-stop
+		d.watchMutex.Lock()
+		for i, other := range d.watches {
+			if other == w {
+				d.watches = append(d.watches[:i], d.watches[i+1:]...)
+				break
+			}
+		}
+		d.watchMutex.Unlock()
+		close(keys)
+	}()
+
+	return nil
+}
+
+// the keys are sent holding the mutex, a stopped watch can't close its
+// channel in middle of a send
+func (d *FakeStateDriver) notifyWatches(key string) {
+	d.watchMutex.Lock()
+	defer d.watchMutex.Unlock()
+
+	for _, w := range d.watches {
+		if !strings.HasPrefix(key, w.baseKey) {
+			continue
+		}
+		select {
+		case w.keys <- key:
+		case <-w.stop:
+		}
+	}
+}
+
 func (d *FakeStateDriver) ReadState(key string, value core.State,
 	unmarshal func([]byte, interface{}) error) error {
 	encodedState, err := d.Read(key)
@@ -96,6 +153,52 @@ func (d *FakeStateDriver) WriteState(key string, value core.State,
 	return nil
 }
 
+func (d *FakeStateDriver) leaseHolder(key string) string {
+	if expiry, ok := d.leases[key]; ok && time.Now().After(expiry) {
+		delete(d.leases, key)
+		delete(d.TestState, key)
+	}
+	if val, ok := d.TestState[key]; ok {
+		return string(val.value)
+	}
+	return ""
+}
+
+func (d *FakeStateDriver) AcquireLease(key, holder string, ttl uint64) (bool, error) {
+	currHolder := d.leaseHolder(key)
+	if currHolder != "" && currHolder != holder {
+		return false, nil
+	}
+
+	if d.leases == nil {
+		d.leases = make(map[string]time.Time)
+	}
+	d.TestState[key] = ValueData{value: []byte(holder)}
+	d.leases[key] = time.Now().Add(time.Duration(ttl) * time.Second)
+	return true, nil
+}
+
+func (d *FakeStateDriver) RenewLease(key, holder string, ttl uint64) error {
+	if currHolder := d.leaseHolder(key); currHolder != holder {
+		return &core.Error{Desc: fmt.Sprintf("lease %q is held by %q",
+			key, currHolder)}
+	}
+
+	d.leases[key] = time.Now().Add(time.Duration(ttl) * time.Second)
+	return nil
+}
+
+func (d *FakeStateDriver) ReleaseLease(key, holder string) error {
+	if currHolder := d.leaseHolder(key); currHolder != holder {
+		return &core.Error{Desc: fmt.Sprintf("lease %q is held by %q",
+			key, currHolder)}
+	}
+
+	delete(d.leases, key)
+	delete(d.TestState, key)
+	return nil
+}
+
 func (d *FakeStateDriver) DumpState() {
 	for key, _ := range d.TestState {
 		log.Printf("key: %q\n", key)
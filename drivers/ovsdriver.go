@@ -18,12 +18,15 @@ package drivers
 import (
 	"fmt"
 	"log"
+	"os/exec"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/contiv/libovsdb"
 	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/metrics"
 )
 
 // implements the NetworkDriver and EndpointDriver interface for an vlan based
@@ -53,6 +56,12 @@ const (
 type OvsConfig struct {
 	DbIp   string `json:"dbip"`
 	DbPort int    `json:"dbport"`
+	// when set, the bridge is left in place on deinit so that the datapath
+	// keeps forwarding while the daemon restarts
+	RetainBridge bool `json:"retainBridge"`
+	// label of the host, the host-local vlans of the vxlan networks are
+	// kept by host label
+	HostLabel string `json:"hostLabel"`
 }
 
 type OvsDriverConfig struct {
@@ -63,10 +72,12 @@ type OvsDriverConfig struct {
 // specific to vlan based open-vswitch. It also implements the
 // libovsdb.Notifier interface to keep cache of ovs table state.
 type OvsDriver struct {
-	ovs         *libovsdb.OvsdbClient
-	cache       map[string]map[libovsdb.UUID]libovsdb.Row
-	stateDriver core.StateDriver
-	currPortNum int // used to allocate port names. XXX: should it be user controlled?
+	ovs          *libovsdb.OvsdbClient
+	cache        map[string]map[libovsdb.UUID]libovsdb.Row
+	stateDriver  core.StateDriver
+	currPortNum  int // used to allocate port names. XXX: should it be user controlled?
+	retainBridge bool
+	hostLabel    string
 }
 
 func (d *OvsDriver) getRootUuid() libovsdb.UUID {
@@ -211,8 +222,9 @@ func (d *OvsDriver) getPortOrIntfNameFromId(id string, isPort bool) (string, err
 	return "", &core.Error{Desc: fmt.Sprintf("Ovs port/intf not found for id: %s", id)}
 }
 
-func (d *OvsDriver) createDeletePort(portName, intfName, intfType, id string,
-	intfOptions map[string]interface{}, tag int, op oper) error {
+func (d *OvsDriver) createDeletePort(portName, intfName, intfType, id,
+	macAddress string, intfOptions map[string]interface{}, tag int,
+	op oper) error {
 	// portName is assumed to be unique enough to become uuid
 	portUuidStr := portName
 	intfUuidStr := fmt.Sprintf("Intf%s", portName)
@@ -231,6 +243,9 @@ func (d *OvsDriver) createDeletePort(portName, intfName, intfType, id string,
 		intf := make(map[string]interface{})
 		intf["name"] = intfName
 		intf["type"] = intfType
+		if macAddress != "" {
+			intf["mac"] = macAddress
+		}
 		idMap["endpoint-id"] = id
 		intf["external_ids"], err = libovsdb.NewOvsMap(idMap)
 		if err != nil {
@@ -329,21 +344,60 @@ func vxlanIfName(netId, vtepIp string) string {
 		netId, strings.Replace(vtepIp, ".", "", -1))
 }
 
+// hostLocalVlan is true for a vxlan network that leaves the pick of its local
+// vlan to the hosts
+func hostLocalVlan(cfgNw *OvsCfgNetworkState) bool {
+	return cfgNw.PktTagType == "vxlan" && cfgNw.PktTag == 0
+}
+
+// allocNetVlan returns the vlan to tag the ports of a network with on this
+// host, a network with a host-local vlan takes a user of it
+func (d *OvsDriver) allocNetVlan(cfgNw *OvsCfgNetworkState) (int, error) {
+	if !hostLocalVlan(cfgNw) {
+		return cfgNw.PktTag, nil
+	}
+	vlan, err := AllocHostVlan(d.stateDriver, d.hostLabel, cfgNw.Id)
+	if err != nil {
+		log.Printf("error '%s' allocating a local vlan for network %s \n",
+			err, cfgNw.Id)
+	}
+	return int(vlan), err
+}
+
+// freeNetVlan releases a user of the host-local vlan of a network
+func (d *OvsDriver) freeNetVlan(cfgNw *OvsCfgNetworkState) (int, error) {
+	if !hostLocalVlan(cfgNw) {
+		return cfgNw.PktTag, nil
+	}
+	vlan, err := FreeHostVlan(d.stateDriver, d.hostLabel, cfgNw.Id)
+	if err != nil {
+		log.Printf("error '%s' freeing the local vlan of network %s \n",
+			err, cfgNw.Id)
+	}
+	return int(vlan), err
+}
+
 func (d *OvsDriver) createVtep(epCfg *OvsCfgEndpointState) error {
 	if cfgNw, err := readNwCfg(epCfg.NetId); err != nil {
 		return err
 	}
 
+	vlan, err := d.allocNetVlan(cfgNw)
+	if err != nil {
+		return err
+	}
+
 	intfOptions := make(map[string]interface{})
 	intfOptions["remote_ip"] = epCfg.VtepIp
 	intfOptions["key"] = strconv.Itoa(cfgNw.ExtPktTag)
 
 	intfName := vxlanIfName(epCfg.NetId, epCfg.VtepIp)
-	err = d.createDeletePort(intfName, intfName, "vxlan", cfgNw.Id,
-		intfOptions, cfgNw.PktTag, CREATE_PORT)
+	err = d.createDeletePort(intfName, intfName, "vxlan", cfgNw.Id, "",
+		intfOptions, vlan, CREATE_PORT)
 	if err != nil {
 		log.Printf("error '%s' creating vxlan peer intfName %s, options %s, tag %d \n",
-			err, intfName, intfOptions, cfgNw.PktTag)
+			err, intfName, intfOptions, vlan)
+		d.freeNetVlan(cfgNw)
 		return err
 	}
 
@@ -355,15 +409,167 @@ func (d *OvsDriver) deleteVtep(epCfg *OvsCfgEndpointState) error {
 		return err
 	}
 
+	vlan, err := d.freeNetVlan(cfgNw)
+	if err != nil {
+		return err
+	}
+
 	intfName := vxlanIfName(epCfg.NetId, epCfg.VtepIp)
-	err = d.createDeletePort(intfName, intfName, "vxlan", cfgNw.Id,
-		nil, cfgNw.PktTag, DELETE_PORT)
+	err = d.createDeletePort(intfName, intfName, "vxlan", cfgNw.Id, "",
+		nil, vlan, DELETE_PORT)
 	if err != nil {
 		log.Printf("error '%s' deleting vxlan peer intfName %s, tag %d \n",
-			err, intfName, cfgNw.PktTag)
+			err, intfName, vlan)
+		return err
+	}
+
+	return nil
+}
+
+const (
+	// polls for the ofport ovs-vswitchd assigns to a new interface
+	OFPORT_WAIT_RETRIES  = 20
+	OFPORT_WAIT_INTERVAL = 100 * time.Millisecond
+)
+
+func runCmd(args []string) error {
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		log.Printf("error '%s' running %v, out = '%s' \n", err, args, out)
+	}
+	return err
+}
+
+// getOfport returns the openflow port of an interface, as it reaches the
+// cache with the ovsdb updates
+func (d *OvsDriver) getOfport(intfName string) (int, error) {
+	for i := 0; i < OFPORT_WAIT_RETRIES; i++ {
+		for _, row := range d.cache[INTERFACE_TABLE] {
+			if row.Fields["name"] != intfName {
+				continue
+			}
+			if ofport, ok := row.Fields["ofport"].(float64); ok && ofport > 0 {
+				return int(ofport), nil
+			}
+		}
+		time.Sleep(OFPORT_WAIT_INTERVAL)
+	}
+	return 0, &core.Error{Desc: fmt.Sprintf("no ofport for intf %s", intfName)}
+}
+
+// createGateway sets the gateway port of a routed or outbound nat network up
+// on the host, when the network has none yet, and routes the network's
+// subnets through it
+func (d *OvsDriver) createGateway(cfgNw *OvsCfgNetworkState) error {
+	if (cfgNw.Vrf == 0 && !cfgNw.OutboundNat) || cfgNw.DefaultGw == "" {
+		return nil
+	}
+
+	if cfgNw.Vrf != 0 &&
+		exec.Command("ip", "link", "show", vrfName(cfgNw)).Run() != nil {
+		err := runCmd(vrfCreateCmd(cfgNw))
+		if err != nil {
+			return err
+		}
+	}
+
+	portName, err := d.getPortOrIntfNameFromId(gatewayId(cfgNw), GET_PORT_NAME)
+	if err != nil {
+		vlan, err := d.allocNetVlan(cfgNw)
+		if err != nil {
+			return err
+		}
+		portName = gatewayPortName(vlan)
+		err = d.createDeletePort(portName, portName, "internal",
+			gatewayId(cfgNw), gatewayMac(cfgNw), nil, vlan, CREATE_PORT)
+		if err != nil {
+			d.freeNetVlan(cfgNw)
+			return err
+		}
+
+		ofport, err := d.getOfport(portName)
+		if err == nil {
+			err = runCmd([]string{"ovs-ofctl", "add-flow", DEFAULT_BRIDGE_NAME,
+				gatewayFlow(cfgNw, ofport)})
+		}
+		if err != nil {
+			log.Printf("error '%s' adding the flow of gateway %s \n", err,
+				portName)
+			d.deleteGateway(cfgNw)
+			return err
+		}
+	}
+
+	for _, cmd := range gatewayCmds(cfgNw, portName) {
+		err = runCmd(cmd)
+		if err != nil {
+			return err
+		}
+	}
+	if !cfgNw.OutboundNat {
+		return nil
+	}
+	for _, rule := range natRules(cfgNw, portName) {
+		// the rules are kept as is when the gateway is set up again
+		check := rule.cmd("-C")
+		if exec.Command(check[0], check[1:]...).Run() == nil {
+			continue
+		}
+		err = runCmd(rule.cmd("-A"))
+		if err != nil {
+			return err
+		}
+	}
+	for _, rule := range natEgressRules(cfgNw) {
+		// ip rules can be added twice, the rule is deleted first so that
+		// it is added once when the gateway is set up again
+		exec.Command("ip", rule.cmd("del")[1:]...).Run()
+		err = runCmd(rule.cmd("add"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteGateway removes the gateway port of a network from the host, along
+// with its nat rules and the tenant's vrf when it has no gateways left on the
+// host
+func (d *OvsDriver) deleteGateway(cfgNw *OvsCfgNetworkState) error {
+	portName, err := d.getPortOrIntfNameFromId(gatewayId(cfgNw), GET_PORT_NAME)
+	if err != nil {
+		return nil
+	}
+
+	if cfgNw.OutboundNat {
+		for _, rule := range natRules(cfgNw, portName) {
+			runCmd(rule.cmd("-D"))
+		}
+		for _, rule := range natEgressRules(cfgNw) {
+			runCmd(rule.cmd("del"))
+		}
+	}
+	runCmd([]string{"ovs-ofctl", "del-flows", DEFAULT_BRIDGE_NAME,
+		"dl_dst=" + gatewayMac(cfgNw)})
+	err = d.createDeletePort(portName, portName, "", "", "", nil, 0,
+		DELETE_PORT)
+	if err != nil {
+		log.Printf("error '%s' deleting gateway %s \n", err, portName)
+		return err
+	}
+	_, err = d.freeNetVlan(cfgNw)
+	if err != nil {
 		return err
 	}
 
+	if cfgNw.Vrf == 0 {
+		return nil
+	}
+	out, err := exec.Command("ip", "-o", "link", "show", "master",
+		vrfName(cfgNw)).Output()
+	if err == nil && strings.TrimSpace(string(out)) == "" {
+		return runCmd([]string{"ip", "link", "del", vrfName(cfgNw)})
+	}
 	return nil
 }
 
@@ -385,6 +591,8 @@ func (d *OvsDriver) Init(config *core.Config, stateDriver core.StateDriver) erro
 
 	d.ovs = ovs
 	d.stateDriver = stateDriver
+	d.retainBridge = cfg.Ovs.RetainBridge
+	d.hostLabel = cfg.Ovs.HostLabel
 	d.cache = make(map[string]map[libovsdb.UUID]libovsdb.Row)
 	d.ovs.Register(d)
 	initial, _ := d.ovs.MonitorAll(DATABASE, "")
@@ -414,11 +622,22 @@ func (d *OvsDriver) Init(config *core.Config, stateDriver core.StateDriver) erro
 
 func (d *OvsDriver) Deinit() {
 	if d.ovs != nil {
-		d.createDeleteBridge(DEFAULT_BRIDGE_NAME, DELETE_BRIDGE)
+		if !d.retainBridge {
+			d.createDeleteBridge(DEFAULT_BRIDGE_NAME, DELETE_BRIDGE)
+		}
 		(*d.ovs).Disconnect()
 	}
 }
 
+func (d *OvsDriver) CheckHealth() error {
+	if d.ovs == nil {
+		return &core.Error{Desc: "not connected to ovsdb"}
+	}
+
+	_, err := d.ovs.ListDbs()
+	return err
+}
+
 func (d *OvsDriver) CreateNetwork(id string) error {
 	if cfgNw, err := readNwCfg(epCfg.NetId); err != nil {
 		return err
@@ -431,7 +650,8 @@ func (d *OvsDriver) CreateNetwork(id string) error {
 
 func (d *OvsDriver) DeleteNetwork(value string) error {
 
-	// no driver operation for network delete
+	// the gateway of a routed or outbound nat network is the only driver
+	// state of a network
 	var err error
 
 	if cfgNw, err := readNwCfgFromData([]byte(vaue)); err != nil {
@@ -440,12 +660,17 @@ func (d *OvsDriver) DeleteNetwork(value string) error {
 	}
 	log.Printf("delete net %s \n", cfgNw.Id)
 
-	return nil
+	return d.deleteGateway(cfgNw)
 }
 
 func (d *OvsDriver) CreateEndpoint(id string) error {
 	var err error
 
+	start := time.Now()
+	defer func() {
+		metrics.OvsCreateEndpointDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	// add an internal ovs port with vlan-tag information from the state
 	portName := d.getPortName()
 	intfName := portName
@@ -479,18 +704,36 @@ func (d *OvsDriver) CreateEndpoint(id string) error {
 		return err
 	}
 
+	vlan, err := d.allocNetVlan(cfgNw)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			d.freeNetVlan(cfgNw)
+		}
+	}()
+
 	// TODO: some updates may mean implicit delete of the previous state
 	err = d.createDeletePort(portName, intfName, intfType, epCfg.Id,
-		nil, cfgNw.PktTag, CREATE_PORT)
+		epCfg.MacAddress, nil, vlan, CREATE_PORT)
 	if err != nil {
 		return err
 	}
 	defer func() {
 		if err != nil {
-			d.createDeletePort(portName, intfName, intfType, "", nil, 0, DELETE_PORT)
+			d.createDeletePort(portName, intfName, intfType, "", "", nil, 0,
+				DELETE_PORT)
 		}
 	}()
 
+	err = d.createGateway(cfgNw)
+	if err != nil {
+		log.Printf("error '%s' creating the gateway of network %s \n", err,
+			cfgNw.Id)
+		return err
+	}
+
 	if operState, operEp, err := newEpOperFromId(id); err != nil {
 		return err
 	}
@@ -501,6 +744,9 @@ func (d *OvsDriver) CreateEndpoint(id string) error {
 	operEp.IntfName = intfName
 	operEp.HomingHost = epCfg.HomingHost
 	operEp.VtepIp = epCfg.VtepIp
+	operEp.MacAddress = epCfg.MacAddress
+	operEp.SecondaryIps = epCfg.SecondaryIps
+	operEp.PublishedPorts = epCfg.PublishedPorts
 
 	err = state.Write()
 	if err != nil {
@@ -550,7 +796,15 @@ func (d *OvsDriver) DeleteEndpoint(value string) (err error) {
 		return err
 	}
 
-	err = d.createDeletePort(portName, intfName, "", "", nil, 0, DELETE_PORT)
+	err = d.createDeletePort(portName, intfName, "", "", "", nil, 0, DELETE_PORT)
+	if err != nil {
+		return err
+	}
+
+	if cfgNw, err := readNwCfg(epCfg.NetId); err != nil {
+		return err
+	}
+	_, err = d.freeNetVlan(cfgNw)
 	if err != nil {
 		return err
 	}
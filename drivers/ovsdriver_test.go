@@ -244,6 +244,51 @@ func TestOvsDriverDeinit(t *testing.T) {
 
 }
 
+func TestOvsDriverDeinitRetainBridge(t *testing.T) {
+	driver := &OvsDriver{}
+	ovsConfig := &OvsDriverConfig{}
+	ovsConfig.Ovs.DbIp = ""
+	ovsConfig.Ovs.DbPort = 0
+	ovsConfig.Ovs.RetainBridge = true
+	config := &core.Config{V: ovsConfig}
+
+	err := driver.Init(config, ovsStateDriver)
+	if err != nil {
+		t.Fatalf("driver init failed. Error: %s", err)
+	}
+
+	driver.Deinit()
+
+	output, err := exec.Command("ovs-vsctl", "list", "Bridge").Output()
+	if err != nil || !strings.Contains(string(output), DEFAULT_BRIDGE_NAME) {
+		t.Fatalf("bridge not retained on deinit. Error: %s Output: %s",
+			err, output)
+	}
+
+	// cleanup the retained bridge for subsequent tests
+	driver = initOvsDriver(t)
+	driver.Deinit()
+}
+
+func TestOvsDriverCheckHealth(t *testing.T) {
+	driver := initOvsDriver(t)
+	defer func() { driver.Deinit() }()
+
+	err := driver.CheckHealth()
+	if err != nil {
+		t.Fatalf("health check failed. Error: %s", err)
+	}
+}
+
+func TestOvsDriverCheckHealthNotConnected(t *testing.T) {
+	driver := &OvsDriver{}
+
+	err := driver.CheckHealth()
+	if err == nil {
+		t.Fatalf("health check succeeded without ovsdb connection!")
+	}
+}
+
 func TestOvsDriverCreateEndpoint(t *testing.T) {
 	driver := initOvsDriver(t)
 	defer func() { driver.Deinit() }()
@@ -34,6 +34,13 @@ type OvsCfgEndpointState struct {
 	HomingHost string `json:"homingHost"`
 	IntfName   string `json:"intfName"`
 	VtepIp     string `json:'vtepIP"`
+	MacAddress string `json:"macAddress"`
+	// addresses of the endpoint besides IpAddress, from any of the
+	// network's subnets
+	SecondaryIps []string `json:"secondaryIps"`
+	// container ports published on the ports of the homing host, as
+	// 'hostPort:containerPort/protocol'
+	PublishedPorts []string `json:"publishedPorts"`
 }
 
 func (s OvsCfgEndpointState) Key() string {
@@ -75,6 +82,11 @@ type OvsOperEndpointState struct {
 	HomingHost string `json:"homingHost"`
 	IntfName   string `json:"intfName"`
 	VtepIp     string `json:'vtepIP"`
+	MacAddress string `json:"macAddress"`
+	// addresses of the endpoint besides IpAddress
+	SecondaryIps []string `json:"secondaryIps"`
+	// container ports published on the ports of the homing host
+	PublishedPorts []string `json:"publishedPorts"`
 }
 
 func (s OvsOperEndpointState) Key() string {
@@ -0,0 +1,199 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/jainvipin/bitset"
+)
+
+// the local vlans of the vxlan networks are host-local, when a range of vlans
+// is set aside for them each host picks the local vlan of a vxlan network out
+// of that range, independently of the other hosts. The vlans of the range are
+// kept out of the tenants' vlans, so that the number of vxlan networks isn't
+// limited by the cluster wide vlan space.
+
+const (
+	HOST_VLANS_CFG_PATH        = CFG_PATH + "host-vlans"
+	HOST_VLAN_OPER_PATH_PREFIX = OPER_PATH + "host-vlans/"
+	HOST_VLAN_OPER_PATH        = HOST_VLAN_OPER_PATH_PREFIX + "%s"
+)
+
+// OvsCfgHostVlansState is the range of vlans the hosts pick the local vlans of
+// the vxlan networks from
+type OvsCfgHostVlansState struct {
+	core.CommonState
+	Vlans string `json:"vlans"`
+}
+
+func (s *OvsCfgHostVlansState) Write() error {
+	return s.StateDriver.WriteState(HOST_VLANS_CFG_PATH, s, json.Marshal)
+}
+
+func (s *OvsCfgHostVlansState) Read(id string) error {
+	return s.StateDriver.ReadState(HOST_VLANS_CFG_PATH, s, json.Unmarshal)
+}
+
+func (s *OvsCfgHostVlansState) ReadAll() ([]core.State, error) {
+	return nil, &core.Error{Desc: "Not supported"}
+}
+
+func (s *OvsCfgHostVlansState) Clear() error {
+	return s.StateDriver.ClearState(HOST_VLANS_CFG_PATH)
+}
+
+// Bitset returns the vlans of the range
+func (s *OvsCfgHostVlansState) Bitset() (*bitset.BitSet, error) {
+	vlanBitset := netutils.CreateBitset(12)
+	vlanRanges, err := netutils.ParseTagRanges(s.Vlans, "vlan")
+	if err != nil {
+		return nil, err
+	}
+	for _, vlanRange := range vlanRanges {
+		for vlan := vlanRange.Min; vlan <= vlanRange.Max; vlan++ {
+			vlanBitset.Set(uint(vlan))
+		}
+	}
+	vlanBitset.Clear(0)
+	vlanBitset.Clear(4095)
+	return vlanBitset, nil
+}
+
+// ReadHostVlans reads the vlans set aside for the hosts' local vlans, it
+// returns an empty set when none are
+func ReadHostVlans(stateDriver core.StateDriver) (*bitset.BitSet, error) {
+	cfg := &OvsCfgHostVlansState{}
+	cfg.StateDriver = stateDriver
+	err := cfg.Read("")
+	if core.ErrIfKeyExists(err) != nil {
+		return nil, err
+	} else if err != nil {
+		return netutils.CreateBitset(12), nil
+	}
+	return cfg.Bitset()
+}
+
+// OvsOperHostVlanState keeps the local vlans a host picked for the vxlan
+// networks with endpoints or vteps on the host
+type OvsOperHostVlanState struct {
+	core.CommonState
+	// local vlans by network
+	Vlans map[string]uint `json:"vlans"`
+	// endpoints and vteps using the local vlan, by network
+	Users map[string]int `json:"users"`
+}
+
+func (s *OvsOperHostVlanState) Write() error {
+	key := fmt.Sprintf(HOST_VLAN_OPER_PATH, s.Id)
+	return s.StateDriver.WriteState(key, s, json.Marshal)
+}
+
+func (s *OvsOperHostVlanState) Read(id string) error {
+	key := fmt.Sprintf(HOST_VLAN_OPER_PATH, id)
+	return s.StateDriver.ReadState(key, s, json.Unmarshal)
+}
+
+func (s *OvsOperHostVlanState) ReadAll() ([]core.State, error) {
+	return s.StateDriver.ReadAllState(HOST_VLAN_OPER_PATH_PREFIX, s,
+		json.Unmarshal)
+}
+
+func (s *OvsOperHostVlanState) Clear() error {
+	key := fmt.Sprintf(HOST_VLAN_OPER_PATH, s.Id)
+	return s.StateDriver.ClearState(key)
+}
+
+func readHostVlanOper(stateDriver core.StateDriver,
+	hostLabel string) (*OvsOperHostVlanState, error) {
+	oper := &OvsOperHostVlanState{}
+	oper.StateDriver = stateDriver
+	err := oper.Read(hostLabel)
+	if core.ErrIfKeyExists(err) != nil {
+		return nil, err
+	} else if err != nil {
+		oper.Id = hostLabel
+	}
+	if oper.Vlans == nil {
+		oper.Vlans = make(map[string]uint)
+		oper.Users = make(map[string]int)
+	}
+	return oper, nil
+}
+
+// AllocHostVlan returns the local vlan of a vxlan network on a host, the
+// first user of the network on the host picks the lowest vlan of the host
+// vlans that isn't used by another network
+func AllocHostVlan(stateDriver core.StateDriver, hostLabel,
+	netId string) (uint, error) {
+	oper, err := readHostVlanOper(stateDriver, hostLabel)
+	if err != nil {
+		return 0, err
+	}
+
+	vlan, found := oper.Vlans[netId]
+	if !found {
+		freeVlans, err := ReadHostVlans(stateDriver)
+		if err != nil {
+			return 0, err
+		}
+		for _, usedVlan := range oper.Vlans {
+			freeVlans.Clear(usedVlan)
+		}
+		vlan, found = freeVlans.NextSet(0)
+		if !found {
+			return 0, &core.Error{Desc: fmt.Sprintf(
+				"no local vlans available on host %s", hostLabel)}
+		}
+		oper.Vlans[netId] = vlan
+	}
+	oper.Users[netId]++
+
+	err = oper.Write()
+	if err != nil {
+		return 0, err
+	}
+	return vlan, nil
+}
+
+// FreeHostVlan releases a user of the local vlan of a vxlan network on a
+// host, returning the vlan. The vlan is freed with its last user.
+func FreeHostVlan(stateDriver core.StateDriver, hostLabel,
+	netId string) (uint, error) {
+	oper, err := readHostVlanOper(stateDriver, hostLabel)
+	if err != nil {
+		return 0, err
+	}
+
+	vlan, found := oper.Vlans[netId]
+	if !found {
+		return 0, &core.Error{Desc: fmt.Sprintf(
+			"network %s has no local vlan on host %s", netId, hostLabel)}
+	}
+	oper.Users[netId]--
+	if oper.Users[netId] <= 0 {
+		delete(oper.Vlans, netId)
+		delete(oper.Users, netId)
+	}
+
+	if len(oper.Vlans) == 0 {
+		return vlan, oper.Clear()
+	}
+	return vlan, oper.Write()
+}
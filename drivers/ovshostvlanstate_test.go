@@ -0,0 +1,77 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drivers
+
+import (
+	"testing"
+)
+
+func TestHostVlans(t *testing.T) {
+	sd := &FakeStateDriver{}
+	sd.Init(nil)
+
+	_, err := AllocHostVlan(sd, "host1", "orange")
+	if err == nil {
+		t.Fatalf("allocated a host vlan without any host vlans \n")
+	}
+
+	cfg := &OvsCfgHostVlansState{Vlans: "100-101"}
+	cfg.StateDriver = sd
+	err = cfg.Write()
+	if err != nil {
+		t.Fatalf("error '%s' writing the host vlans \n", err)
+	}
+
+	// the users of a network on a host share its vlan, the hosts pick the
+	// vlans independently of each other
+	allocs := []struct {
+		host, netId string
+		vlan        uint
+	}{
+		{"host1", "orange", 100},
+		{"host1", "orange", 100},
+		{"host1", "purple", 101},
+		{"host2", "purple", 100},
+	}
+	for _, alloc := range allocs {
+		vlan, err := AllocHostVlan(sd, alloc.host, alloc.netId)
+		if err != nil || vlan != alloc.vlan {
+			t.Fatalf("error '%v' allocating the vlan of %s on %s, got %d, "+
+				"expected %d \n", err, alloc.netId, alloc.host, vlan, alloc.vlan)
+		}
+	}
+	_, err = AllocHostVlan(sd, "host1", "green")
+	if err == nil {
+		t.Fatalf("allocated more host vlans than available \n")
+	}
+
+	// the vlan is freed with its last user
+	for i := 0; i < 2; i++ {
+		vlan, err := FreeHostVlan(sd, "host1", "orange")
+		if err != nil || vlan != 100 {
+			t.Fatalf("error '%v' freeing the vlan of orange, freed %d \n",
+				err, vlan)
+		}
+	}
+	vlan, err := AllocHostVlan(sd, "host1", "green")
+	if err != nil || vlan != 100 {
+		t.Fatalf("error '%v' allocating the freed vlan, got %d \n", err, vlan)
+	}
+	_, err = FreeHostVlan(sd, "host1", "orange")
+	if err == nil {
+		t.Fatalf("freed the vlan of orange after its last user \n")
+	}
+}
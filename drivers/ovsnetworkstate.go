@@ -18,6 +18,8 @@ package drivers
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+
 	"github.com/contiv/netplugin/core"
 	"github.com/jainvipin/bitset"
 	"state"
@@ -27,16 +29,27 @@ import (
 // vlans with ovs. The st is stored as Json objects.
 
 type OvsCfgNetworkState struct {
-	Id         string        `json:"id"`
-	Tenant     string        `json:"tenant"`
-	PktTagType string        `json:"pktTagType"`
-	PktTag     int           `json:"pktTag"`
-	ExtPktTag  int           `json:"extPktTag"`
-	SubnetIp   string        `json:"subnetIp"`
-	SubnetLen  uint          `json:"subnetLen"`
-	DefaultGw  string        `json:"defaultGw"`
-	EpCount    int           `json:"epCount"`
-	IpAllocMap bitset.BitSet `json:"ipAllocMap"`
+	Id         string `json:"id"`
+	Tenant     string `json:"tenant"`
+	PktTagType string `json:"pktTagType"`
+	PktTag     int    `json:"pktTag"`
+	ExtPktTag  int    `json:"extPktTag"`
+	SubnetIp   string `json:"subnetIp"`
+	SubnetLen  uint   `json:"subnetLen"`
+	DefaultGw  string `json:"defaultGw"`
+	EpCount    int    `json:"epCount"`
+	// subnets added out of the tenant's subnet pool as the addresses of the
+	// network run out, as 'ip/len'
+	ExtraSubnets []string `json:"extraSubnets"`
+	// id of the vrf of the tenant the network is routed in on the hosts,
+	// zero when the tenant has no distributed routing
+	Vrf uint `json:"vrf"`
+	// the endpoints' traffic to the outside world is masqueraded behind the
+	// address of their host, through the network's gateway on the host
+	OutboundNat bool `json:"outboundNat"`
+	// allocation map of the addresses of a network created before the
+	// networks had an ip resource, only read to migrate the network to one
+	IpAllocMap *bitset.BitSet `json:"ipAllocMap,omitempty"`
 }
 
 func (s OvsCfgNetworkState) Key() string {
@@ -67,3 +80,27 @@ func newNwCfgFromData(data []byte) (st state.State, nwCfg *OvsCfgNetworkState, e
 	nwCfg := &((st.Data()).(OvsCfgNetworkState))
 	return
 }
+
+// Subnets returns the subnets of the network as 'ip/len', its first subnet
+// followed by the ones it grew by
+func (s *OvsCfgNetworkState) Subnets() []string {
+	if s.SubnetIp == "" {
+		return s.ExtraSubnets
+	}
+	return append([]string{fmt.Sprintf("%s/%d", s.SubnetIp, s.SubnetLen)},
+		s.ExtraSubnets...)
+}
+
+// SubnetLenOf returns the length of the network's subnet an address belongs
+// to, the length of the first subnet when none of them contains it
+func (s *OvsCfgNetworkState) SubnetLenOf(ipAddress string) uint {
+	ip := net.ParseIP(ipAddress)
+	for _, subnet := range s.ExtraSubnets {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err == nil && ip != nil && ipNet.Contains(ip) {
+			subnetLen, _ := ipNet.Mask.Size()
+			return uint(subnetLen)
+		}
+	}
+	return s.SubnetLen
+}
@@ -0,0 +1,195 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drivers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// the networks of a tenant with distributed routing are routed on every host
+// with endpoints in them. Each such host has a gateway port on the bridge for
+// the network, an internal port in the network's vlan that owns the network's
+// default gateway address and is enslaved to the tenant's vrf device, so that
+// the host's kernel routes between the networks of the tenant, rewriting the
+// macs and decrementing the ttl. The gateway has the same address and mac on
+// every host; a flow sends the frames to the gateway mac to the local gateway
+// port, so that they are routed locally even when the bridge learnt the mac
+// from a remote gateway. The traffic of a vrf to addresses none of its
+// networks has is unreachable, rather than routed in the host's main table.
+//
+// A network with outbound nat has the same gateway port, in the host's main
+// table unless the network is routed too, and its endpoints' traffic to the
+// outside world is masqueraded behind the host's address. The traffic of a
+// routed network with outbound nat leaves its vrf through ip rules, looked up
+// before the vrfs' own rule: the traffic from the network's subnets is routed
+// in the vrf's table to the tenant's networks, and in the main table to the
+// outside world.
+
+const (
+	GW_PORT_PREFIX   = "gw"
+	GW_PORT_NAME_FMT = GW_PORT_PREFIX + "%d"
+	GW_ID_PREFIX     = "gw-"
+	VRF_NAME_FMT     = "vrf%d"
+	// the routing table of the vrf of id n is VRF_TABLE_BASE + n
+	VRF_TABLE_BASE = 1000
+	// the metric of the unreachable default route of a vrf, the highest the
+	// kernel's vrf documentation suggests, so that any other route wins
+	VRF_UNREACHABLE_METRIC = 4278198272
+	// the preferences of the ip rules of the routed networks with outbound
+	// nat, before the l3mdev rule of the vrfs, of preference 1000
+	VRF_ROUTES_RULE_PREF = 998
+	NAT_EGRESS_RULE_PREF = 999
+	GW_FLOW_PRIO         = 100
+)
+
+// gatewayId returns the endpoint id of the gateway port of a network
+func gatewayId(cfgNw *OvsCfgNetworkState) string {
+	return GW_ID_PREFIX + cfgNw.Id
+}
+
+// gatewayPortName returns the name of the gateway port of the network of a
+// vlan on the host
+func gatewayPortName(vlan int) string {
+	return fmt.Sprintf(GW_PORT_NAME_FMT, vlan)
+}
+
+func vrfName(cfgNw *OvsCfgNetworkState) string {
+	return fmt.Sprintf(VRF_NAME_FMT, cfgNw.Vrf)
+}
+
+// gatewayMac returns the mac of the gateway of a network, the same on every
+// host. It is a locally administered mac made of the tenant's vrf and the
+// network's vlan or vxlan, so that the gateways of the networks of all the
+// tenants have macs of their own.
+func gatewayMac(cfgNw *OvsCfgNetworkState) string {
+	kind, tag := 0, cfgNw.PktTag
+	if cfgNw.PktTagType == "vxlan" {
+		kind, tag = 1, cfgNw.ExtPktTag
+	}
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", 0x02|kind<<2,
+		(cfgNw.Vrf>>8)&0xff, cfgNw.Vrf&0xff, (tag>>16)&0xff, (tag>>8)&0xff,
+		tag&0xff)
+}
+
+// gatewayCmds returns the commands that set the gateway port of a network up
+// on the host, in its tenant's vrf when it is routed. The commands can be run
+// again, e.g. to route the subnets the network grew by.
+func gatewayCmds(cfgNw *OvsCfgNetworkState, port string) [][]string {
+	cmds := [][]string{{"sysctl", "-w", "net.ipv4.ip_forward=1"}}
+	if cfgNw.Vrf != 0 {
+		cmds = append(cmds, []string{"ip", "link", "set", vrfName(cfgNw), "up"},
+			[]string{"ip", "route", "replace", "unreachable", "default",
+				"metric", strconv.FormatUint(VRF_UNREACHABLE_METRIC, 10), "vrf",
+				vrfName(cfgNw)},
+			[]string{"ip", "link", "set", port, "master", vrfName(cfgNw)})
+	}
+	cmds = append(cmds, []string{"ip", "addr", "replace",
+		fmt.Sprintf("%s/%d", cfgNw.DefaultGw, cfgNw.SubnetLen), "dev", port},
+		[]string{"ip", "link", "set", port, "up"})
+
+	// the subnets the network grew by are reached through the gateway port
+	// too, the endpoints have routes to the gateway address regardless
+	for _, subnet := range cfgNw.ExtraSubnets {
+		cmd := []string{"ip", "route", "replace", subnet, "dev", port}
+		if cfgNw.Vrf != 0 {
+			cmd = append(cmd, "vrf", vrfName(cfgNw))
+		}
+		cmds = append(cmds, cmd)
+	}
+	// the replies to the masqueraded traffic of a routed network are routed
+	// in the main table, once their destination is translated back
+	if cfgNw.Vrf != 0 && cfgNw.OutboundNat {
+		for _, subnet := range cfgNw.Subnets() {
+			cmds = append(cmds, []string{"ip", "route", "replace", subnet,
+				"dev", port})
+		}
+	}
+	return cmds
+}
+
+// vrfCreateCmd returns the command that creates the tenant's vrf device
+func vrfCreateCmd(cfgNw *OvsCfgNetworkState) []string {
+	return []string{"ip", "link", "add", vrfName(cfgNw), "type", "vrf", "table",
+		strconv.Itoa(VRF_TABLE_BASE + int(cfgNw.Vrf))}
+}
+
+// gatewayFlow returns the flow that sends the frames to the gateway mac of a
+// network to the gateway port of the host
+func gatewayFlow(cfgNw *OvsCfgNetworkState, ofport int) string {
+	return fmt.Sprintf("priority=%d,dl_dst=%s,actions=output:%d", GW_FLOW_PRIO,
+		gatewayMac(cfgNw), ofport)
+}
+
+// iptRule is an iptables rule of the host
+type iptRule struct {
+	table string
+	chain string
+	spec  []string
+}
+
+// cmd returns the iptables command that checks (-C), appends (-A) or deletes
+// (-D) the rule
+func (r iptRule) cmd(op string) []string {
+	return append([]string{"iptables", "-t", r.table, op, r.chain}, r.spec...)
+}
+
+// natRules returns the iptables rules of a network with outbound nat, that
+// masquerade the traffic of its subnets leaving the host, other than the
+// traffic routed to the tenant's networks, and forward it through the host
+func natRules(cfgNw *OvsCfgNetworkState, port string) []iptRule {
+	rules := []iptRule{}
+	for _, subnet := range cfgNw.Subnets() {
+		rules = append(rules, iptRule{"nat", "POSTROUTING", []string{"-s",
+			subnet, "!", "-o", GW_PORT_PREFIX + "+", "-j", "MASQUERADE"}})
+	}
+	return append(rules,
+		iptRule{"filter", "FORWARD", []string{"-i", port, "-j", "ACCEPT"}},
+		iptRule{"filter", "FORWARD", []string{"-o", port, "-m", "conntrack",
+			"--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}})
+}
+
+// ipRule is an ip rule of the host
+type ipRule struct {
+	pref int
+	spec []string
+}
+
+// cmd returns the ip command that adds (add) or deletes (del) the rule
+func (r ipRule) cmd(op string) []string {
+	return append([]string{"ip", "rule", op, "pref", strconv.Itoa(r.pref)},
+		r.spec...)
+}
+
+// natEgressRules returns the ip rules of a routed network with outbound nat,
+// that route the traffic of its subnets to the tenant's networks in the vrf's
+// table, without the vrf's unreachable default route, and the rest of it in
+// the main table
+func natEgressRules(cfgNw *OvsCfgNetworkState) []ipRule {
+	rules := []ipRule{}
+	if cfgNw.Vrf == 0 {
+		return rules
+	}
+	for _, subnet := range cfgNw.Subnets() {
+		rules = append(rules, ipRule{VRF_ROUTES_RULE_PREF, []string{"iif",
+			vrfName(cfgNw), "from", subnet, "lookup",
+			strconv.Itoa(VRF_TABLE_BASE + int(cfgNw.Vrf)),
+			"suppress_prefixlength", "0"}},
+			ipRule{NAT_EGRESS_RULE_PREF, []string{"iif", vrfName(cfgNw), "from",
+				subnet, "lookup", "main"}})
+	}
+	return rules
+}
@@ -0,0 +1,114 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drivers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGatewayMac(t *testing.T) {
+	vlanNw := &OvsCfgNetworkState{PktTagType: "vlan", PktTag: 11, Vrf: 0x102}
+	vxlanNw := &OvsCfgNetworkState{PktTagType: "vxlan", PktTag: 11,
+		ExtPktTag: 0x10203, Vrf: 1}
+
+	if mac := gatewayMac(vlanNw); mac != "02:01:02:00:00:0b" {
+		t.Fatalf("vlan gateway mac %s, expected 02:01:02:00:00:0b \n", mac)
+	}
+	if mac := gatewayMac(vxlanNw); mac != "06:00:01:01:02:03" {
+		t.Fatalf("vxlan gateway mac %s, expected 06:00:01:01:02:03 \n", mac)
+	}
+	if flow := gatewayFlow(vlanNw, 5); flow !=
+		"priority=100,dl_dst=02:01:02:00:00:0b,actions=output:5" {
+		t.Fatalf("unexpected gateway flow %s \n", flow)
+	}
+}
+
+func TestGatewayCmds(t *testing.T) {
+	cfgNw := &OvsCfgNetworkState{DefaultGw: "11.1.0.1", SubnetLen: 24,
+		ExtraSubnets: []string{"11.1.1.0/24"}, Vrf: 3}
+
+	expCmds := [][]string{
+		{"sysctl", "-w", "net.ipv4.ip_forward=1"},
+		{"ip", "link", "set", "vrf3", "up"},
+		{"ip", "route", "replace", "unreachable", "default", "metric",
+			"4278198272", "vrf", "vrf3"},
+		{"ip", "link", "set", "gw11", "master", "vrf3"},
+		{"ip", "addr", "replace", "11.1.0.1/24", "dev", "gw11"},
+		{"ip", "link", "set", "gw11", "up"},
+		{"ip", "route", "replace", "11.1.1.0/24", "dev", "gw11", "vrf", "vrf3"}}
+	cmds := gatewayCmds(cfgNw, gatewayPortName(11))
+	if !reflect.DeepEqual(cmds, expCmds) {
+		t.Fatalf("gateway cmds %v, expected %v \n", cmds, expCmds)
+	}
+	if cmd := vrfCreateCmd(cfgNw); !reflect.DeepEqual(cmd, []string{"ip",
+		"link", "add", "vrf3", "type", "vrf", "table", "1003"}) {
+		t.Fatalf("unexpected vrf create cmd %v \n", cmd)
+	}
+}
+
+func TestNatGateway(t *testing.T) {
+	cfgNw := &OvsCfgNetworkState{DefaultGw: "11.1.0.1", SubnetIp: "11.1.0.0",
+		SubnetLen: 24, ExtraSubnets: []string{"11.1.1.0/24"}, OutboundNat: true}
+
+	// outside a vrf, the gateway is in the host's main table
+	expCmds := [][]string{
+		{"sysctl", "-w", "net.ipv4.ip_forward=1"},
+		{"ip", "addr", "replace", "11.1.0.1/24", "dev", "gw11"},
+		{"ip", "link", "set", "gw11", "up"},
+		{"ip", "route", "replace", "11.1.1.0/24", "dev", "gw11"}}
+	cmds := gatewayCmds(cfgNw, "gw11")
+	if !reflect.DeepEqual(cmds, expCmds) {
+		t.Fatalf("gateway cmds %v, expected %v \n", cmds, expCmds)
+	}
+
+	// the subnets of a routed network are routed in the main table too
+	cfgNw.Vrf = 3
+	cmds = gatewayCmds(cfgNw, "gw11")
+	expRoutes := [][]string{
+		{"ip", "route", "replace", "11.1.0.0/24", "dev", "gw11"},
+		{"ip", "route", "replace", "11.1.1.0/24", "dev", "gw11"}}
+	if !reflect.DeepEqual(cmds[len(cmds)-2:], expRoutes) {
+		t.Fatalf("gateway cmds %v, expected main table routes %v \n", cmds,
+			expRoutes)
+	}
+
+	// the traffic from the subnets of a routed network leaves the vrf to
+	// the main table, unless it is to the tenant's networks
+	egressRules := natEgressRules(cfgNw)
+	if len(egressRules) != 4 || !reflect.DeepEqual(egressRules[2].cmd("add"),
+		[]string{"ip", "rule", "add", "pref", "998", "iif", "vrf3", "from",
+			"11.1.1.0/24", "lookup", "1003", "suppress_prefixlength", "0"}) ||
+		!reflect.DeepEqual(egressRules[3].cmd("del"), []string{"ip", "rule",
+			"del", "pref", "999", "iif", "vrf3", "from", "11.1.1.0/24",
+			"lookup", "main"}) {
+		t.Fatalf("unexpected nat egress rules %+v \n", egressRules)
+	}
+	cfgNw.Vrf = 0
+	if egressRules = natEgressRules(cfgNw); len(egressRules) != 0 {
+		t.Fatalf("unexpected nat egress rules %+v outside a vrf \n",
+			egressRules)
+	}
+
+	rules := natRules(cfgNw, "gw11")
+	if len(rules) != 4 || !reflect.DeepEqual(rules[1].cmd("-A"),
+		[]string{"iptables", "-t", "nat", "-A", "POSTROUTING", "-s",
+			"11.1.1.0/24", "!", "-o", "gw+", "-j", "MASQUERADE"}) ||
+		!reflect.DeepEqual(rules[2].cmd("-D"), []string{"iptables", "-t",
+			"filter", "-D", "FORWARD", "-i", "gw11", "-j", "ACCEPT"}) {
+		t.Fatalf("unexpected nat rules %+v \n", rules)
+	}
+}
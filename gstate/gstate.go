@@ -25,6 +25,7 @@ import (
 	"github.com/jainvipin/bitset"
 
 	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
 	"github.com/contiv/netplugin/netutils"
 	"github.com/contiv/netplugin/resources"
 )
@@ -50,11 +51,35 @@ type AutoParams struct {
 	AllocSubnetLen uint   `json:"AllocSubnetLen"`
 	Vlans          string `json:"Vlans"`
 	Vxlans         string `json:"Vxlans"`
+	// pool of the endpoints' macs, as 'prefix/len'; when not specified the
+	// macs are assigned by the kernel
+	MacPool string `json:"macPool"`
+	// derive an endpoint's mac from its ip, instead of allocating it
+	MacFromIp bool `json:"macFromIp"`
+	// strategy to pick the vlans, vxlans and subnets with, one of
+	// lowest-first (default), round-robin, random and sticky
+	AllocStrategy string `json:"allocStrategy"`
 }
 
 // specifies parameters that decides the deployment choices
 type DeployParams struct {
 	DefaultNetType string `json:"defaultNetType"`
+	// the tenant has an address space of its own, its subnets can overlap
+	// with other tenants' subnets
+	IsolatedVrf bool `json:"isolatedVrf"`
+	// id of the vrf the tenant's networks are routed in on the hosts, zero
+	// when the tenant has no distributed routing
+	Vrf uint `json:"vrf"`
+}
+
+// specifies the most networks, endpoints, vlans, vxlans and subnets a tenant
+// may use; a zero limit leaves the resource unlimited
+type QuotaParams struct {
+	MaxNetworks  uint `json:"maxNetworks"`
+	MaxEndpoints uint `json:"maxEndpoints"`
+	MaxVlans     uint `json:"maxVlans"`
+	MaxVxlans    uint `json:"maxVxlans"`
+	MaxSubnets   uint `json:"maxSubnets"`
 }
 
 // global state of the network plugin
@@ -64,6 +89,7 @@ type Cfg struct {
 	Tenant  string       `json:"tenant"`
 	Auto    AutoParams   `json:auto"`
 	Deploy  DeployParams `json:"deploy"`
+	Quota   QuotaParams  `json:"quota"`
 }
 
 func (s Cfg) Key() string {
@@ -157,6 +183,18 @@ func (gc *Cfg) checkErrors() error {
 		return err
 	}
 
+	if gc.Auto.MacPool != "" {
+		_, _, err = netutils.ParseMacPool(gc.Auto.MacPool)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = resources.ValidateAllocStrategy(gc.Auto.AllocStrategy)
+	if err != nil {
+		return err
+	}
+
 	if gc.Deploy.DefaultNetType != "vlan" &&
 		gc.Deploy.DefaultNetType != "vxlan" {
 		return errors.New(fmt.Sprintf("unsupported net type %s",
@@ -218,8 +256,34 @@ func (g *Oper) Clear() error {
 // resource usage. Revisit if this assumption changes, as then it might need to
 // be moved to resource-manager
 func deriveAvailableVlans(stateDriver core.StateDriver) (*bitset.BitSet, error) {
-	// available vlans = vlan-space - For each tenant (vlans + local-vxlan-vlans)
-	availableVlans := netutils.CreateBitset(12)
+	// available vlans = vlan-space - host vlans - For each tenant (vlans +
+	// local-vxlan-vlans)
+	tenantVlans, err := TenantVlans(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+	hostVlans, err := drivers.ReadHostVlans(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	// subtract to get availableVlans
+	availableVlans := tenantVlans.Union(hostVlans).Complement()
+	clearReservedVlans(availableVlans)
+	return availableVlans, nil
+}
+
+// TenantVlans returns the vlans and the local vlans of the vxlans of all the
+// tenants
+func TenantVlans(stateDriver core.StateDriver) (*bitset.BitSet, error) {
+	return tenantVlansExcept(stateDriver, "")
+}
+
+// tenantVlansExcept returns the vlans of all the tenants but the passed one,
+// and the local vlans of the vxlans of all the tenants
+func tenantVlansExcept(stateDriver core.StateDriver,
+	tenant string) (*bitset.BitSet, error) {
+	usedVlans := netutils.CreateBitset(12)
 
 	// get all vlans
 	readVlanRsrc := &resources.AutoVlanCfgResource{}
@@ -232,7 +296,9 @@ func deriveAvailableVlans(stateDriver core.StateDriver) (*bitset.BitSet, error)
 	}
 	for _, rsrc := range vlanRsrcs {
 		cfg := rsrc.(*resources.AutoVlanCfgResource)
-		availableVlans = availableVlans.Union(cfg.Vlans)
+		if cfg.Id != tenant {
+			usedVlans = usedVlans.Union(cfg.Vlans)
+		}
 	}
 
 	//get all vxlan-vlans
@@ -246,13 +312,10 @@ func deriveAvailableVlans(stateDriver core.StateDriver) (*bitset.BitSet, error)
 	}
 	for _, rsrc := range vxlanRsrcs {
 		cfg := rsrc.(*resources.AutoVxlanCfgResource)
-		availableVlans = availableVlans.Union(cfg.LocalVlans)
+		usedVlans = usedVlans.Union(cfg.LocalVlans)
 	}
 
-	// subtract to get availableVlans
-	availableVlans = availableVlans.Complement()
-	clearReservedVlans(availableVlans)
-	return availableVlans, nil
+	return usedVlans, nil
 }
 
 func (gc *Cfg) initVxlanBitset(vxlans string) (*resources.AutoVxlanCfgResource,
@@ -260,6 +323,7 @@ func (gc *Cfg) initVxlanBitset(vxlans string) (*resources.AutoVxlanCfgResource,
 
 	vxlanRsrcCfg := &resources.AutoVxlanCfgResource{}
 	vxlanRsrcCfg.Vxlans = netutils.CreateBitset(14)
+	vxlanRsrcCfg.AllocStrategy = gc.Auto.AllocStrategy
 
 	vxlanRange := netutils.TagRange{}
 	vxlanRanges, err := netutils.ParseTagRanges(vxlans, "vxlan")
@@ -274,6 +338,18 @@ func (gc *Cfg) initVxlanBitset(vxlans string) (*resources.AutoVxlanCfgResource,
 		vxlanRsrcCfg.Vxlans.Set(uint(vxlan - vxlanRange.Min))
 	}
 
+	// the hosts pick the local vlans out of the host vlans when there are
+	// any, the vxlans don't take up any of the vlan space then
+	hostVlans, err := drivers.ReadHostVlans(gc.StateDriver)
+	if err != nil {
+		return nil, 0, err
+	}
+	if hostVlans.Count() != 0 {
+		vxlanRsrcCfg.LocalVlans = netutils.CreateBitset(12)
+		vxlanRsrcCfg.HostLocalVlans = true
+		return vxlanRsrcCfg, freeVxlansStart, nil
+	}
+
 	availableVlans, err := deriveAvailableVlans(gc.StateDriver)
 	if err != nil {
 		return nil, 0, err
@@ -305,10 +381,13 @@ func (gc *Cfg) initVxlanBitset(vxlans string) (*resources.AutoVxlanCfgResource,
 	return vxlanRsrcCfg, freeVxlansStart, nil
 }
 
-func (gc *Cfg) AllocVxlan(ra core.ResourceManager) (vxlan uint,
+// AllocVxlan allocates a vxlan and its local vlan for a network, the network
+// name is the hint of the sticky allocation strategy
+func (gc *Cfg) AllocVxlan(ra core.ResourceManager, netId string) (vxlan uint,
 	localVlan uint, err error) {
 
-	pair, err1 := ra.AllocateResourceVal(gc.Tenant, resources.AUTO_VXLAN_RSRC)
+	pair, err1 := ra.AllocateResourceValWithHint(gc.Tenant,
+		resources.AUTO_VXLAN_RSRC, netId)
 	if err1 != nil {
 		return 0, 0, err1
 	}
@@ -326,6 +405,56 @@ func (gc *Cfg) AllocVxlan(ra core.ResourceManager) (vxlan uint,
 	return
 }
 
+// ReserveVxlan marks a network's static vxlan, and its local vlan, as in use
+// by the network. A local vlan of 0 has the lowest free local vlan picked, unless the hosts
+// pick the local vlans. The local vlan of the network is returned.
+func (gc *Cfg) ReserveVxlan(ra core.ResourceManager, vxlan uint,
+	localVlan uint, netId string) (uint, error) {
+	g := &Oper{}
+	g.StateDriver = gc.StateDriver
+	err := g.Read(gc.Tenant)
+	if err != nil {
+		return 0, err
+	}
+
+	rsrc := &resources.AutoVxlanCfgResource{}
+	rsrc.StateDriver = gc.StateDriver
+	err = rsrc.Read(gc.Tenant)
+	if err != nil {
+		return 0, &core.Error{Desc: fmt.Sprintf("tenant %s has no vxlans",
+			gc.Tenant)}
+	}
+	if vxlan < g.FreeVxlansStart || !rsrc.Vxlans.Test(vxlan-g.FreeVxlansStart) {
+		return 0, &core.Error{Desc: fmt.Sprintf(
+			"vxlan %d is out of the vxlans of tenant %s", vxlan, gc.Tenant)}
+	}
+
+	if rsrc.HostLocalVlans && localVlan != 0 {
+		return 0, &core.Error{Desc: fmt.Sprintf(
+			"the hosts pick the local vlans of tenant %s", gc.Tenant)}
+	} else if !rsrc.HostLocalVlans && localVlan == 0 {
+		oper := &resources.AutoVxlanOperResource{}
+		oper.StateDriver = gc.StateDriver
+		err = oper.Read(gc.Tenant)
+		if err != nil {
+			return 0, err
+		}
+		var found bool
+		localVlan, found = oper.FreeLocalVlans.NextSet(0)
+		if !found {
+			return 0, &core.Error{Desc: "no local vlans available."}
+		}
+	}
+
+	err = ra.ReserveResourceVal(gc.Tenant, resources.AUTO_VXLAN_RSRC,
+		resources.VxlanVlanPair{Vxlan: vxlan - g.FreeVxlansStart,
+			Vlan: localVlan}, netId)
+	if err != nil {
+		return 0, err
+	}
+	return localVlan, nil
+}
+
 func (gc *Cfg) FreeVxlan(ra core.ResourceManager, vxlan uint, localVlan uint) error {
 	g := &Oper{}
 	g.StateDriver = gc.StateDriver
@@ -361,11 +490,21 @@ func (gc *Cfg) initVlanBitset(vlans string) (*bitset.BitSet, error) {
 	}
 	clearReservedVlans(vlanBitset)
 
+	hostVlans, err := drivers.ReadHostVlans(gc.StateDriver)
+	if err != nil {
+		return nil, err
+	}
+	if vlan, found := vlanBitset.Intersection(hostVlans).NextSet(0); found {
+		return nil, &core.Error{Desc: fmt.Sprintf(
+			"vlan %d is set aside for the hosts' local vlans", vlan)}
+	}
+
 	return vlanBitset, nil
 }
 
-func (gc *Cfg) AllocVlan(ra core.ResourceManager) (uint, error) {
-	vlan, err := ra.AllocateResourceVal(gc.Tenant, resources.AUTO_VLAN_RSRC)
+func (gc *Cfg) AllocVlan(ra core.ResourceManager, netId string) (uint, error) {
+	vlan, err := ra.AllocateResourceValWithHint(gc.Tenant,
+		resources.AUTO_VLAN_RSRC, netId)
 	if err != nil {
 		log.Printf("alloc vlan failed: %q", err)
 		return 0, err
@@ -374,12 +513,33 @@ func (gc *Cfg) AllocVlan(ra core.ResourceManager) (uint, error) {
 	return vlan.(uint), err
 }
 
+// ReserveVlan marks a network's static vlan as in use by the network, the vlan
+// must be one of the tenant's vlans
+func (gc *Cfg) ReserveVlan(ra core.ResourceManager, vlan uint,
+	netId string) error {
+	rsrc := &resources.AutoVlanCfgResource{}
+	rsrc.StateDriver = gc.StateDriver
+	err := rsrc.Read(gc.Tenant)
+	if err != nil {
+		return &core.Error{Desc: fmt.Sprintf("tenant %s has no vlans",
+			gc.Tenant)}
+	}
+	if !rsrc.Vlans.Test(vlan) {
+		return &core.Error{Desc: fmt.Sprintf(
+			"vlan %d is out of the vlans of tenant %s", vlan, gc.Tenant)}
+	}
+
+	return ra.ReserveResourceVal(gc.Tenant, resources.AUTO_VLAN_RSRC, vlan,
+		netId)
+}
+
 func (gc *Cfg) FreeVlan(ra core.ResourceManager, vlan uint) error {
 	return ra.DeallocateResourceVal(gc.Tenant, resources.AUTO_VLAN_RSRC, vlan)
 }
 
-func (gc *Cfg) AllocSubnet(ra core.ResourceManager) (string, error) {
-	pair, err := ra.AllocateResourceVal(gc.Tenant, resources.AUTO_SUBNET_RSRC)
+func (gc *Cfg) AllocSubnet(ra core.ResourceManager, netId string) (string, error) {
+	pair, err := ra.AllocateResourceValWithHint(gc.Tenant,
+		resources.AUTO_SUBNET_RSRC, netId)
 	if err != nil {
 		return "", err
 	}
@@ -387,6 +547,32 @@ func (gc *Cfg) AllocSubnet(ra core.ResourceManager) (string, error) {
 	return pair.(resources.SubnetIpLenPair).Ip.String(), err
 }
 
+// SubnetInPool tells if a subnet is one of the subnets allocated out of the
+// tenant's subnet pool
+func (gc *Cfg) SubnetInPool(subnetIp string, subnetLen uint) bool {
+	if gc.Auto.SubnetPool == "" || subnetLen != gc.Auto.AllocSubnetLen {
+		return false
+	}
+	_, poolNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", gc.Auto.SubnetPool,
+		gc.Auto.SubnetLen))
+	if err != nil {
+		return false
+	}
+	_, subnet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", subnetIp, subnetLen))
+	return err == nil && poolNet.Contains(subnet.IP) &&
+		subnet.IP.Equal(net.ParseIP(subnetIp))
+}
+
+// ReserveSubnet takes a static subnet of the tenant's subnet pool out of the
+// pool for the network, it is freed back to the pool like an allocated one
+func (gc *Cfg) ReserveSubnet(ra core.ResourceManager, subnetIp string,
+	netId string) error {
+	return ra.ReserveResourceVal(gc.Tenant, resources.AUTO_SUBNET_RSRC,
+		resources.SubnetIpLenPair{
+			Ip:  net.ParseIP(subnetIp),
+			Len: gc.Auto.AllocSubnetLen}, netId)
+}
+
 func (gc *Cfg) FreeSubnet(ra core.ResourceManager, subnetIp string) error {
 	return ra.DeallocateResourceVal(gc.Tenant, resources.AUTO_SUBNET_RSRC,
 		resources.SubnetIpLenPair{
@@ -394,6 +580,259 @@ func (gc *Cfg) FreeSubnet(ra core.ResourceManager, subnetIp string) error {
 			Len: gc.Auto.AllocSubnetLen})
 }
 
+// AllocMac allocates an endpoint's mac from the tenant's mac pool. When the
+// tenant derives the macs from the ips, the derived mac is reserved instead;
+// a mac that collides with one in use falls back to allocation.
+func (gc *Cfg) AllocMac(ra core.ResourceManager, ipAddress string) (string, error) {
+	if gc.Auto.MacFromIp && ipAddress != "" {
+		macPrefix, poolLen, err := netutils.ParseMacPool(gc.Auto.MacPool)
+		if err != nil {
+			return "", err
+		}
+		macAddr, err := netutils.GetMacFromIp(macPrefix, poolLen, ipAddress)
+		if err != nil {
+			return "", err
+		}
+		mac, _ := net.ParseMAC(macAddr)
+		err = ra.ReserveResourceVal(gc.Tenant, resources.AUTO_MAC_RSRC, mac, "")
+		if err == nil {
+			return macAddr, nil
+		}
+		log.Printf("error '%s' reserving mac %s derived from ip %s \n",
+			err, macAddr, ipAddress)
+	}
+
+	mac, err := ra.AllocateResourceVal(gc.Tenant, resources.AUTO_MAC_RSRC)
+	if err != nil {
+		return "", err
+	}
+
+	return mac.(net.HardwareAddr).String(), err
+}
+
+func (gc *Cfg) FreeMac(ra core.ResourceManager, macAddr string) error {
+	mac, err := net.ParseMAC(macAddr)
+	if err != nil {
+		return err
+	}
+	return ra.DeallocateResourceVal(gc.Tenant, resources.AUTO_MAC_RSRC, mac)
+}
+
+func (gc *Cfg) resizeSubnetPool(ra core.ResourceManager, auto *AutoParams) error {
+	subnetRsrcCfg := &resources.AutoSubnetCfgResource{
+		SubnetPool:     net.ParseIP(auto.SubnetPool),
+		SubnetPoolLen:  auto.SubnetLen,
+		AllocSubnetLen: auto.AllocSubnetLen}
+	return ra.RedefineResource(gc.Tenant, resources.AUTO_SUBNET_RSRC,
+		subnetRsrcCfg)
+}
+
+// checkVlansUnused makes sure the vlans added to the tenant's vlans aren't
+// another tenant's vlans or the local vlans of any tenant's vxlans. The host
+// vlans are ruled out when parsing the vlans.
+func (gc *Cfg) checkVlansUnused(curVlans, vlans *bitset.BitSet) error {
+	usedVlans, err := tenantVlansExcept(gc.StateDriver, gc.Tenant)
+	if err != nil {
+		return err
+	}
+	for vlan, found := vlans.NextSet(0); found; vlan, found = vlans.NextSet(vlan + 1) {
+		if curVlans != nil && curVlans.Test(vlan) {
+			continue
+		}
+		if usedVlans.Test(vlan) {
+			return &core.Error{Desc: fmt.Sprintf(
+				"vlan %d is in use by another tenant", vlan)}
+		}
+	}
+	return nil
+}
+
+func (gc *Cfg) resizeVlans(ra core.ResourceManager, vlans string) error {
+	vlanRsrcCfg := &resources.AutoVlanCfgResource{
+		AllocStrategy: gc.Auto.AllocStrategy}
+	if gc.Auto.Vlans == "" {
+		var err error
+		vlanRsrcCfg.Vlans, err = gc.initVlanBitset(vlans)
+		if err != nil {
+			return err
+		}
+		err = gc.checkVlansUnused(nil, vlanRsrcCfg.Vlans)
+		if err != nil {
+			return err
+		}
+		return ra.DefineResource(gc.Tenant, resources.AUTO_VLAN_RSRC, vlanRsrcCfg)
+	}
+
+	// removing the vlans is a shrink to an empty range
+	vlanRsrcCfg.Vlans = netutils.CreateBitset(12)
+	if vlans != "" {
+		curRsrc := &resources.AutoVlanCfgResource{}
+		curRsrc.StateDriver = gc.StateDriver
+		err := curRsrc.Read(gc.Tenant)
+		if err != nil {
+			return err
+		}
+		vlanRsrcCfg.Vlans, err = gc.initVlanBitset(vlans)
+		if err != nil {
+			return err
+		}
+		err = gc.checkVlansUnused(curRsrc.Vlans, vlanRsrcCfg.Vlans)
+		if err != nil {
+			return err
+		}
+	}
+	err := ra.RedefineResource(gc.Tenant, resources.AUTO_VLAN_RSRC, vlanRsrcCfg)
+	if err != nil || vlans != "" {
+		return err
+	}
+	return ra.UndefineResource(gc.Tenant, resources.AUTO_VLAN_RSRC)
+}
+
+func (gc *Cfg) resizeVxlans(ra core.ResourceManager, vxlans string) error {
+	g := &Oper{}
+	g.StateDriver = gc.StateDriver
+	err := g.Read(gc.Tenant)
+	if err != nil {
+		return err
+	}
+
+	if gc.Auto.Vxlans == "" {
+		vxlanRsrcCfg, freeVxlansStart, err := gc.initVxlanBitset(vxlans)
+		if err != nil {
+			return err
+		}
+		err = ra.DefineResource(gc.Tenant, resources.AUTO_VXLAN_RSRC, vxlanRsrcCfg)
+		if err != nil {
+			return err
+		}
+		g.FreeVxlansStart = freeVxlansStart
+		return g.Write()
+	}
+
+	curRsrc := &resources.AutoVxlanCfgResource{}
+	curRsrc.StateDriver = gc.StateDriver
+	err = curRsrc.Read(gc.Tenant)
+	if err != nil {
+		return err
+	}
+
+	// removing the vxlans is a shrink to an empty range, keeping the local
+	// vlans in use
+	resizeCfg := &resources.VxlanResizeCfg{
+		Vxlans:     netutils.CreateBitset(14),
+		LocalVlans: curRsrc.LocalVlans}
+	freeVxlansStart := g.FreeVxlansStart
+	if vxlans != "" {
+		vxlanRanges, err := netutils.ParseTagRanges(vxlans, "vxlan")
+		if err != nil {
+			return err
+		}
+		// XXX: REVISIT, we seem to accept one contiguous vxlan range
+		vxlanRange := vxlanRanges[0]
+		freeVxlansStart = uint(vxlanRange.Min)
+		for vxlan := vxlanRange.Min; vxlan <= vxlanRange.Max; vxlan++ {
+			resizeCfg.Vxlans.Set(uint(vxlan - vxlanRange.Min))
+		}
+
+		// a bigger range needs more local vlans, a smaller range keeps them.
+		// No local vlans are needed when the hosts pick them.
+		localVlansReqd := uint(vxlanRange.Max - vxlanRange.Min + 1)
+		if curRsrc.HostLocalVlans {
+			localVlansReqd = 0
+		}
+		if count := curRsrc.LocalVlans.Count(); count < localVlansReqd {
+			availableVlans, err := deriveAvailableVlans(gc.StateDriver)
+			if err != nil {
+				return err
+			}
+			if availableVlans.Count() < localVlansReqd-count {
+				return &core.Error{Desc: fmt.Sprintf("Available free local vlans (%d) is less than the additional vxlans (%d)",
+					availableVlans.Count(), localVlansReqd-count)}
+			}
+			resizeCfg.LocalVlans = curRsrc.LocalVlans.Clone()
+			vlan, _ := availableVlans.NextSet(0)
+			for ; count < localVlansReqd; count++ {
+				resizeCfg.LocalVlans.Set(vlan)
+				vlan, _ = availableVlans.NextSet(vlan + 1)
+			}
+		}
+	}
+	resizeCfg.Rebase = int(g.FreeVxlansStart) - int(freeVxlansStart)
+
+	err = ra.RedefineResource(gc.Tenant, resources.AUTO_VXLAN_RSRC, resizeCfg)
+	if err != nil {
+		return err
+	}
+	if vxlans == "" {
+		return ra.UndefineResource(gc.Tenant, resources.AUTO_VXLAN_RSRC)
+	}
+
+	g.FreeVxlansStart = freeVxlansStart
+	return g.Write()
+}
+
+// ResizePools changes the subnet pool, the vlans and the vxlans of a processed
+// config to the ones of 'auto', keeping the values in use. The pools are
+// resized one at a time; on an error the config reflects the pools resized
+// so far. The mac pool and the allocation strategy can't be changed.
+func (gc *Cfg) ResizePools(ra core.ResourceManager, auto *AutoParams) error {
+	if auto.MacPool != gc.Auto.MacPool || auto.MacFromIp != gc.Auto.MacFromIp {
+		return &core.Error{Desc: fmt.Sprintf(
+			"the mac pool of tenant %s can't be changed", gc.Tenant)}
+	}
+	if auto.AllocStrategy != gc.Auto.AllocStrategy {
+		return &core.Error{Desc: fmt.Sprintf(
+			"the allocation strategy of tenant %s can't be changed", gc.Tenant)}
+	}
+
+	newCfg := *gc
+	newCfg.Auto.SubnetPool = auto.SubnetPool
+	newCfg.Auto.SubnetLen = auto.SubnetLen
+	newCfg.Auto.AllocSubnetLen = auto.AllocSubnetLen
+	newCfg.Auto.Vlans = auto.Vlans
+	newCfg.Auto.Vxlans = auto.Vxlans
+	err := newCfg.checkErrors()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err1 := gc.Write(); err1 != nil {
+			log.Printf("error '%s' updating the global config %v \n", err1, gc)
+		}
+	}()
+
+	if gc.Auto.SubnetPool != auto.SubnetPool ||
+		gc.Auto.SubnetLen != auto.SubnetLen ||
+		gc.Auto.AllocSubnetLen != auto.AllocSubnetLen {
+		err = gc.resizeSubnetPool(ra, auto)
+		if err != nil {
+			return err
+		}
+		gc.Auto.SubnetPool = auto.SubnetPool
+		gc.Auto.SubnetLen = auto.SubnetLen
+		gc.Auto.AllocSubnetLen = auto.AllocSubnetLen
+	}
+
+	if gc.Auto.Vlans != auto.Vlans {
+		err = gc.resizeVlans(ra, auto.Vlans)
+		if err != nil {
+			return err
+		}
+		gc.Auto.Vlans = auto.Vlans
+	}
+
+	if gc.Auto.Vxlans != auto.Vxlans {
+		err = gc.resizeVxlans(ra, auto.Vxlans)
+		if err != nil {
+			return err
+		}
+		gc.Auto.Vxlans = auto.Vxlans
+	}
+
+	return nil
+}
+
 func (gc *Cfg) Process(ra core.ResourceManager) error {
 	var err error
 
@@ -416,7 +855,8 @@ func (gc *Cfg) Process(ra core.ResourceManager) error {
 	subnetRsrcCfg := &resources.AutoSubnetCfgResource{
 		SubnetPool:     net.ParseIP(gc.Auto.SubnetPool),
 		SubnetPoolLen:  gc.Auto.SubnetLen,
-		AllocSubnetLen: gc.Auto.AllocSubnetLen}
+		AllocSubnetLen: gc.Auto.AllocSubnetLen,
+		AllocStrategy:  gc.Auto.AllocStrategy}
 	err = ra.DefineResource(tenant, resources.AUTO_SUBNET_RSRC, subnetRsrcCfg)
 	if err != nil {
 		return err
@@ -424,8 +864,9 @@ func (gc *Cfg) Process(ra core.ResourceManager) error {
 
 	// Only define a vlan resource if a valid range was specified
 	if gc.Auto.Vlans != "" {
-		var vlanRsrcCfg *bitset.BitSet
-		vlanRsrcCfg, err = gc.initVlanBitset(gc.Auto.Vlans)
+		vlanRsrcCfg := &resources.AutoVlanCfgResource{
+			AllocStrategy: gc.Auto.AllocStrategy}
+		vlanRsrcCfg.Vlans, err = gc.initVlanBitset(gc.Auto.Vlans)
 		if err != nil {
 			return err
 		}
@@ -435,6 +876,18 @@ func (gc *Cfg) Process(ra core.ResourceManager) error {
 		}
 	}
 
+	// Only define a mac resource if a pool was specified
+	if gc.Auto.MacPool != "" {
+		macPrefix, poolLen, _ := netutils.ParseMacPool(gc.Auto.MacPool)
+		macRsrcCfg := &resources.AutoMacCfgResource{
+			MacPrefix:  macPrefix.String(),
+			MacPoolLen: poolLen}
+		err = ra.DefineResource(tenant, resources.AUTO_MAC_RSRC, macRsrcCfg)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Only define a vxlan resource if a valid range was specified
 	var freeVxlansStart uint = 0
 	if gc.Auto.Vxlans != "" {
@@ -61,7 +61,7 @@ func TestGlobalConfigAutoVlans(t *testing.T) {
 		t.Fatalf("error '%s' processing config %v \n", err, gc)
 	}
 
-	vlan, err = gc.AllocVlan(gstateTestRA)
+	vlan, err = gc.AllocVlan(gstateTestRA, "")
 	if err != nil {
 		t.Fatalf("error - allocating vlan - %s \n", err)
 	}
@@ -78,6 +78,144 @@ func TestGlobalConfigAutoVlans(t *testing.T) {
 	}
 }
 
+func TestGlobalConfigAutoMacs(t *testing.T) {
+	cfgData := []byte(`
+        {
+            "Version" : "0.01",
+            "Tenant"  : "default",
+            "Auto" : {
+                "SubnetPool"        : "11.5.0.0",
+                "SubnetLen"         : 16,
+                "AllocSubnetLen"    : 24,
+                "Vlans"             : "1-10",
+                "Vxlans"            : "15000-17000",
+                "MacPool"           : "02:02:ac:11:00:00/32",
+                "MacFromIp"         : true
+            },
+            "Deploy" : {
+                "DefaultNetType"    : "vlan"
+            }
+        }`)
+
+	_, gc, err := Parse(cfgData)
+	if err != nil {
+		t.Fatalf("error '%s' parsing config '%s' \n", err, cfgData)
+	}
+
+	gstateSD.Init(nil)
+	defer func() { gstateSD.Deinit() }()
+	_, gc.StateDriver = gstateSD
+	gstateTestRA.Init()
+	defer func() { gstateTestRA.Deinit() }()
+
+	err = gc.Process(gstateTestRA)
+	if err != nil {
+		t.Fatalf("error '%s' processing config %v \n", err, gc)
+	}
+
+	mac, err := gc.AllocMac(gstateTestRA, "11.5.1.5")
+	if err != nil {
+		t.Fatalf("error - allocating mac - %s \n", err)
+	}
+	if mac != "02:02:ac:11:01:05" {
+		t.Fatalf("error - expecting mac derived from ip but allocated %s \n", mac)
+	}
+
+	// a mac in use isn't derived twice
+	mac, err = gc.AllocMac(gstateTestRA, "11.6.1.5")
+	if err != nil {
+		t.Fatalf("error - allocating mac - %s \n", err)
+	}
+	if mac != "02:02:ac:11:00:00" {
+		t.Fatalf("error - expecting first mac of the pool but allocated %s \n", mac)
+	}
+
+	err = gc.FreeMac(gstateTestRA, "02:02:ac:11:01:05")
+	if err != nil {
+		t.Fatalf("error freeing allocated mac - err '%s' \n", err)
+	}
+	mac, err = gc.AllocMac(gstateTestRA, "11.6.1.5")
+	if err != nil || mac != "02:02:ac:11:01:05" {
+		t.Fatalf("error '%v' reallocating freed mac, allocated %s \n", err, mac)
+	}
+}
+
+func TestGlobalConfigRoundRobinVlans(t *testing.T) {
+	cfgData := []byte(`
+        {
+            "Version" : "0.01",
+            "Tenant"  : "default",
+            "Auto" : {
+                "SubnetPool"        : "11.5.0.0",
+                "SubnetLen"         : 16,
+                "AllocSubnetLen"    : 24,
+                "Vlans"             : "1-10",
+                "Vxlans"            : "15000-17000",
+                "AllocStrategy"     : "round-robin"
+            },
+            "Deploy" : {
+                "DefaultNetType"    : "vlan"
+            }
+        }`)
+
+	_, gc, err := Parse(cfgData)
+	if err != nil {
+		t.Fatalf("error '%s' parsing config '%s' \n", err, cfgData)
+	}
+
+	gstateSD.Init(nil)
+	defer func() { gstateSD.Deinit() }()
+	_, gc.StateDriver = gstateSD
+	gstateTestRA.Init()
+	defer func() { gstateTestRA.Deinit() }()
+
+	err = gc.Process(gstateTestRA)
+	if err != nil {
+		t.Fatalf("error '%s' processing config %v \n", err, gc)
+	}
+
+	vlan, err := gc.AllocVlan(gstateTestRA, "orange")
+	if err != nil || vlan != 1 {
+		t.Fatalf("error '%v' allocating vlan, allocated %d \n", err, vlan)
+	}
+	err = gc.FreeVlan(gstateTestRA, vlan)
+	if err != nil {
+		t.Fatalf("error freeing allocated vlan %d - err '%s' \n", vlan, err)
+	}
+
+	// the freed vlan isn't reused right away
+	vlan, err = gc.AllocVlan(gstateTestRA, "orange")
+	if err != nil || vlan != 2 {
+		t.Fatalf("error '%v' allocating vlan, expecting 2 but allocated %d \n",
+			err, vlan)
+	}
+}
+
+func TestInvalidGlobalConfigAllocStrategy(t *testing.T) {
+	cfgData := []byte(`
+        {
+            "Version" : "0.01",
+            "Tenant"  : "default",
+            "Auto" : {
+                "SubnetPool"        : "11.5.0.0",
+                "SubnetLen"         : 16,
+                "AllocSubnetLen"    : 24,
+                "Vlans"             : "1-10",
+                "Vxlans"            : "15000-17000",
+                "AllocStrategy"     : "highest-first"
+            },
+            "Deploy" : {
+                "DefaultNetType"    : "vlan"
+            }
+        }`)
+
+	_, _, err := Parse(cfgData)
+	if err == nil {
+		t.Fatalf("Error: was able to parse invalid allocation strategy '%s' \n",
+			cfgData)
+	}
+}
+
 func TestGlobalConfigAutoVxlan(t *testing.T) {
 	cfgData := []byte(`
         {
@@ -112,7 +250,7 @@ func TestGlobalConfigAutoVxlan(t *testing.T) {
 		t.Fatalf("error '%s' processing config %v \n", err, gc)
 	}
 
-	vxlan, localVlan, err = gc.AllocVxlan(gstateTestRA)
+	vxlan, localVlan, err = gc.AllocVxlan(gstateTestRA, "")
 	if err != nil {
 		t.Fatalf("error - allocating vxlan - %s \n", err)
 	}
@@ -164,7 +302,7 @@ func TestGlobalConfigDefaultVxlanWithVlans(t *testing.T) {
 		t.Fatalf("error '%s' processing config %v \n", err, gc)
 	}
 
-	vlan, err = gc.AllocVlan(gstateTestRA)
+	vlan, err = gc.AllocVlan(gstateTestRA, "")
 	if err != nil {
 		t.Fatalf("error - allocating vlan - %s \n", err)
 	}
@@ -172,7 +310,7 @@ func TestGlobalConfigDefaultVxlanWithVlans(t *testing.T) {
 		t.Fatalf("error - expecting vlan %d but allocated %d \n", 100, vlan)
 	}
 
-	vxlan, localVlan, err = gc.AllocVxlan(gstateTestRA)
+	vxlan, localVlan, err = gc.AllocVxlan(gstateTestRA, "")
 	if err != nil {
 		t.Fatalf("error - allocating vxlan - %s \n", err)
 	}
@@ -0,0 +1,157 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/crt"
+	"github.com/contiv/netplugin/plugin"
+)
+
+// health and readiness reporting for netd. netd is healthy when it can reach
+// the state store, ovsdb and the container runtime; and it is ready to serve
+// the endpoints once the state present at startup has been replayed.
+
+const (
+	HEALTH_URL_PATH = "/health"
+	READY_URL_PATH  = "/ready"
+
+	COMPONENT_STATE_STORE = "stateStore"
+	COMPONENT_OVSDB       = "ovsdb"
+	COMPONENT_CRT         = "containerRuntime"
+)
+
+type componentHealth struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type eventInfo struct {
+	Source string    `json:"source"`
+	Key    string    `json:"key"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Healthy         bool                       `json:"healthy"`
+	Ready           bool                       `json:"ready"`
+	Components      map[string]componentHealth `json:"components"`
+	ReplayCompleted bool                       `json:"replayCompleted"`
+	ReplayError     string                     `json:"replayError,omitempty"`
+	LastEvent       *eventInfo                 `json:"lastEvent,omitempty"`
+}
+
+type healthState struct {
+	sync.Mutex
+	replayCompleted bool
+	replayErr       error
+	lastEvent       *eventInfo
+}
+
+var health = &healthState{}
+
+func (h *healthState) setReplayCompleted(err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.replayCompleted = true
+	h.replayErr = err
+}
+
+func (h *healthState) setLastEvent(source, key string, err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.lastEvent = &eventInfo{Source: source, Key: key, Time: time.Now()}
+	if err != nil {
+		h.lastEvent.Error = err.Error()
+	}
+}
+
+func checkComponent(driver interface{}) componentHealth {
+	checker, ok := driver.(core.HealthChecker)
+	if !ok {
+		// nothing to check, the driver doesn't depend on external entities
+		return componentHealth{Healthy: true}
+	}
+
+	err := checker.CheckHealth()
+	if err != nil {
+		return componentHealth{Healthy: false, Error: err.Error()}
+	}
+	return componentHealth{Healthy: true}
+}
+
+func (h *healthState) report(netPlugin *plugin.NetPlugin,
+	crt *crt.Crt) *healthReport {
+	rpt := &healthReport{Healthy: true}
+	rpt.Components = map[string]componentHealth{
+		COMPONENT_STATE_STORE: checkComponent(netPlugin.StateDriver),
+		COMPONENT_OVSDB:       checkComponent(netPlugin.NetworkDriver),
+		COMPONENT_CRT:         checkComponent(crt),
+	}
+	for _, comp := range rpt.Components {
+		if !comp.Healthy {
+			rpt.Healthy = false
+		}
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	rpt.ReplayCompleted = h.replayCompleted
+	if h.replayErr != nil {
+		rpt.ReplayError = h.replayErr.Error()
+	}
+	if h.lastEvent != nil {
+		lastEvent := *h.lastEvent
+		rpt.LastEvent = &lastEvent
+	}
+	rpt.Ready = rpt.Healthy && rpt.ReplayCompleted
+
+	return rpt
+}
+
+// returns a handler that reports the health; the response status is set
+// based on the health or the readiness, depending on 'readiness'
+func healthHandler(netPlugin *plugin.NetPlugin, crt *crt.Crt,
+	readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rpt := health.report(netPlugin, crt)
+
+		status := http.StatusOK
+		if (readiness && !rpt.Ready) || (!readiness && !rpt.Healthy) {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		err := json.NewEncoder(w).Encode(rpt)
+		if err != nil {
+			log.Printf("error '%s' writing health report \n", err)
+		}
+	}
+}
+
+func addHealthHandlers(mux *http.ServeMux, netPlugin *plugin.NetPlugin,
+	crt *crt.Crt) {
+	mux.HandleFunc(HEALTH_URL_PATH, healthHandler(netPlugin, crt, false))
+	mux.HandleFunc(READY_URL_PATH, healthHandler(netPlugin, crt, true))
+}
@@ -0,0 +1,146 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The package 'metrics' keeps the prometheus metrics exported by the netplugin
+// daemons (netd and netmaster). The metrics are registered with the default
+// prometheus registry and served over http at METRICS_URL_PATH.
+
+const (
+	NAMESPACE        = "netplugin"
+	METRICS_URL_PATH = "/metrics"
+
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+
+	OPER_CREATE = "create"
+	OPER_DELETE = "delete"
+
+	CONSTRUCT_NW = "network"
+	CONSTRUCT_EP = "endpoint"
+)
+
+var (
+	PluginOps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "plugin",
+			Name:      "operations_total",
+			Help:      "Number of network and endpoint operations performed by the plugin.",
+		}, []string{"oper", "construct", "result"})
+
+	PluginOpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "plugin",
+			Name:      "operation_duration_seconds",
+			Help:      "Time taken by the plugin to perform network and endpoint operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"oper", "construct"})
+
+	OvsCreateEndpointDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "ovs",
+			Name:      "create_endpoint_duration_seconds",
+			Help:      "Time taken by the ovs driver to program an endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		})
+
+	Events = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "events",
+			Name:      "processed_total",
+			Help:      "Number of state store and container runtime events processed.",
+		}, []string{"source", "type"})
+
+	EventsFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "events",
+			Name:      "failed_total",
+			Help:      "Number of state store and container runtime events that failed processing.",
+		}, []string{"source", "type"})
+)
+
+func init() {
+	register(prometheus.DefaultRegisterer)
+}
+
+// register adds the metrics of the daemons to a registry
+func register(reg prometheus.Registerer) {
+	reg.MustRegister(PluginOps)
+	reg.MustRegister(PluginOpDuration)
+	reg.MustRegister(OvsCreateEndpointDuration)
+	reg.MustRegister(Events)
+	reg.MustRegister(EventsFailed)
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return RESULT_FAILURE
+	}
+	return RESULT_SUCCESS
+}
+
+// ObservePluginOp accounts for a plugin operation that started at 'start' and
+// completed with 'err'
+func ObservePluginOp(oper, construct string, start time.Time, err error) {
+	PluginOps.WithLabelValues(oper, construct, resultLabel(err)).Inc()
+	PluginOpDuration.WithLabelValues(oper, construct).Observe(
+		time.Since(start).Seconds())
+}
+
+// CountEvent accounts for an event of 'eventType' received from 'source' and
+// the result of processing it
+func CountEvent(source, eventType string, err error) {
+	Events.WithLabelValues(source, eventType).Inc()
+	if err != nil {
+		EventsFailed.WithLabelValues(source, eventType).Inc()
+	}
+}
+
+// Register adds a collector, like the ones reporting resource pool usage, to
+// the set of exported metrics
+func Register(c prometheus.Collector) error {
+	return prometheus.Register(c)
+}
+
+// RegisterGaugeFunc exports the value returned by 'fn' at the time of
+// collection as a gauge
+func RegisterGaugeFunc(subsystem, name, help string, fn func() float64) error {
+	return prometheus.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: NAMESPACE,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		}, fn))
+}
+
+// AddHandler serves the exported metrics on the passed mux
+func AddHandler(mux *http.ServeMux) {
+	mux.Handle(METRICS_URL_PATH, promhttp.Handler())
+}
@@ -0,0 +1,72 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// the metrics are served from a private registry and start afresh, so that
+// the test can run repeatedly in the same process
+func TestMetricsHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	register(reg)
+	PluginOps.Reset()
+	PluginOpDuration.Reset()
+	Events.Reset()
+	EventsFailed.Reset()
+
+	ObservePluginOp(OPER_CREATE, CONSTRUCT_EP, time.Now(), nil)
+	ObservePluginOp(OPER_DELETE, CONSTRUCT_NW, time.Now(),
+		errors.New("test failure"))
+	CountEvent("etcd", CONSTRUCT_EP, errors.New("test failure"))
+
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_URL_PATH, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + METRICS_URL_PATH)
+	if err != nil {
+		t.Fatalf("error '%s' fetching metrics \n", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error '%s' reading metrics \n", err)
+	}
+
+	expMetrics := []string{
+		`netplugin_plugin_operations_total{construct="endpoint",oper="create",result="success"} 1`,
+		`netplugin_plugin_operations_total{construct="network",oper="delete",result="failure"} 1`,
+		`netplugin_events_processed_total{source="etcd",type="endpoint"} 1`,
+		`netplugin_events_failed_total{source="etcd",type="endpoint"} 1`,
+	}
+	for _, exp := range expMetrics {
+		if !strings.Contains(string(body), exp) {
+			t.Fatalf("metric '%s' not found in output: \n%s\n", exp, body)
+		}
+	}
+}
@@ -16,18 +16,26 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/contiv/go-etcd/etcd"
 	"github.com/samalba/dockerclient"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/contiv/netplugin/core"
 	"github.com/contiv/netplugin/crt"
 	"github.com/contiv/netplugin/crtclient"
 	"github.com/contiv/netplugin/crtclient/docker"
 	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/metrics"
 	"github.com/contiv/netplugin/plugin"
 )
 
@@ -39,9 +47,72 @@ const (
 )
 
 type cliOpts struct {
-	hostLabel   string
-	nativeInteg bool
-	publishVtep bool
+	hostLabel    string
+	nativeInteg  bool
+	publishVtep  bool
+	retainBridge bool
+	listenAddr   string
+}
+
+// keeps track of the networks and endpoints programmed on this host, to
+// be reported as metrics
+type programmedState struct {
+	sync.Mutex
+	nets map[string]bool
+	eps  map[string]bool
+}
+
+var programmed = &programmedState{
+	nets: make(map[string]bool),
+	eps:  make(map[string]bool),
+}
+
+func (p *programmedState) update(ids map[string]bool, id string, present bool) {
+	p.Lock()
+	defer p.Unlock()
+	if present {
+		ids[id] = true
+	} else {
+		delete(ids, id)
+	}
+}
+
+func (p *programmedState) count(ids map[string]bool) float64 {
+	p.Lock()
+	defer p.Unlock()
+	return float64(len(ids))
+}
+
+// tracks the docker events being handled, so that the shutdown waits for
+// them; the events received once the shutdown started are dropped
+type inFlightEvents struct {
+	sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// start accounts for an event about to be handled, false when the shutdown
+// started and the event must be dropped
+func (e *inFlightEvents) start() bool {
+	e.Lock()
+	defer e.Unlock()
+	if e.stopped {
+		return false
+	}
+	e.wg.Add(1)
+	return true
+}
+
+func (e *inFlightEvents) done() {
+	e.wg.Done()
+}
+
+// stopAndWait refuses any further event and waits for the ones being handled
+func (e *inFlightEvents) stopAndWait() {
+	e.Lock()
+	e.stopped = true
+	e.Unlock()
+	e.wg.Wait()
 }
 
 func skipHost(vtepIp, homingHost, myHostLabel string) bool {
@@ -93,6 +164,7 @@ func processNetEvent(netPlugin *plugin.NetPlugin, netId, preValue string,
 		log.Printf("Network operation %s failed. Error: %s", operStr, err)
 	} else {
 		log.Printf("Network operation %s succeeded", operStr)
+		programmed.update(programmed.nets, netId, preValue == "")
 	}
 
 	return
@@ -130,11 +202,81 @@ func getEndpointContainerContext(state core.StateDriver, epId string) (
 	epCtx.CurrContName = operEp.ContName
 	epCtx.InterfaceId = operEp.PortName
 	epCtx.IpAddress = operEp.IpAddress
+	// the addresses can be in any of the network's subnets
+	epCtx.SubnetLen = cfgNet.SubnetLenOf(operEp.IpAddress)
+	for _, ip := range operEp.SecondaryIps {
+		epCtx.SecondaryIps = append(epCtx.SecondaryIps,
+			fmt.Sprintf("%s/%d", ip, cfgNet.SubnetLenOf(ip)))
+	}
+	epCtx.MacAddress = operEp.MacAddress
 	epCtx.CurrAttachUUID = operEp.AttachUUID
+	epCtx.PublishedPorts = operEp.PublishedPorts
+	epCtx.OnLinkRoutes = onLinkRoutes(cfgNet,
+		append([]string{operEp.IpAddress}, operEp.SecondaryIps...))
+	if cfgNet.Vrf != 0 {
+		epCtx.Routes, err = tenantRoutes(state, cfgNet, operEp.IpAddress)
+	}
+	if cfgNet.OutboundNat && cfgNet.DefaultGw != "" {
+		epCtx.Routes = append(epCtx.Routes, "default")
+	}
 
 	return &epCtx, err
 }
 
+// onLinkRoutes returns the subnets of a network that none of an endpoint's
+// addresses is in. The subnets share the network's segment, so the endpoint
+// reaches them directly, whether or not the network is routed.
+func onLinkRoutes(cfgNet *drivers.OvsCfgNetworkState,
+	ipAddresses []string) []string {
+	routes := []string{}
+	for _, subnet := range cfgNet.Subnets() {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			continue
+		}
+		onLink := false
+		for _, ipAddress := range ipAddresses {
+			if ip := net.ParseIP(ipAddress); ip != nil && ipNet.Contains(ip) {
+				onLink = true
+				break
+			}
+		}
+		if !onLink {
+			routes = append(routes, subnet)
+		}
+	}
+	return routes
+}
+
+// tenantRoutes returns the subnets of the other routed networks of a network's
+// tenant; an endpoint reaches them through its network's gateway
+func tenantRoutes(state core.StateDriver, cfgNet *drivers.OvsCfgNetworkState,
+	ipAddress string) ([]string, error) {
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = state
+	netCfgs, err := readNet.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(ipAddress)
+	routes := []string{}
+	for _, netCfg := range netCfgs {
+		nwCfg := netCfg.(*drivers.OvsCfgNetworkState)
+		if nwCfg.Tenant != cfgNet.Tenant || nwCfg.Vrf == 0 ||
+			nwCfg.Id == cfgNet.Id {
+			continue
+		}
+		for _, subnet := range nwCfg.Subnets() {
+			_, ipNet, err := net.ParseCIDR(subnet)
+			if err == nil && !ipNet.Contains(ip) {
+				routes = append(routes, subnet)
+			}
+		}
+	}
+	return routes, nil
+}
+
 func getContainerEpContextByContName(state core.StateDriver, contName string) (
 	epCtxs []crtclient.ContainerEpContext, err error) {
 	var epCtx *crtclient.ContainerEpContext
@@ -194,6 +336,7 @@ func processEpEvent(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 	deleteOp := false
 	homingHost := ""
 	vtepIp := ""
+	epOper := &drivers.OvsOperEndpointState{}
 
 	epCfg := &drivers.OvsCfgEndpointState{}
 	epCfg.StateDriver = netPlugin.StateDriver
@@ -210,7 +353,6 @@ func processEpEvent(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 		if err != nil {
 			deleteOp = true
 		}
-		epOper := &drivers.OvsOperEndpointState{}
 		epOper.StateDriver = netPlugin.StateDriver
 		err = epOper.Read(epId)
 		if err != nil {
@@ -235,6 +377,13 @@ func processEpEvent(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 		return
 	}
 	// log.Printf("read endpoint context: %s \n", contEpContext)
+	if deleteOp {
+		// the config of a deleted ep is gone, the ports it published are
+		// unpublished as per its oper state
+		contEpContext.CurrContName = epOper.ContName
+		contEpContext.IpAddress = epOper.IpAddress
+		contEpContext.PublishedPorts = epOper.PublishedPorts
+	}
 
 	operStr := ""
 	if deleteOp {
@@ -250,6 +399,7 @@ func processEpEvent(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 		return
 	}
 	log.Printf("Endpoint operation %s succeeded", operStr)
+	programmed.update(programmed.eps, epId, !deleteOp)
 
 	// attach or detach an endpoint to a container
 	if deleteOp || contAttachPointDeleted(contEpContext) {
@@ -272,7 +422,11 @@ func processEpEvent(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 		}
 		contEpContext.InterfaceId = newContEpContext.InterfaceId
 		contEpContext.IpAddress = newContEpContext.IpAddress
+		contEpContext.MacAddress = newContEpContext.MacAddress
 		contEpContext.SubnetLen = newContEpContext.SubnetLen
+		contEpContext.SecondaryIps = newContEpContext.SecondaryIps
+		contEpContext.Routes = newContEpContext.Routes
+		contEpContext.PublishedPorts = newContEpContext.PublishedPorts
 
 		err = crt.ContainerIf.AttachEndpoint(contEpContext)
 		if err != nil {
@@ -291,11 +445,21 @@ func processEpEvent(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 }
 
 func handleEtcdEvents(netPlugin *plugin.NetPlugin, crt *crt.Crt,
-	rsps chan *etcd.Response, stop chan bool, retErr chan error,
-	opts cliOpts) {
+	rsps chan *etcd.Response, stop chan bool, done chan bool, opts cliOpts) {
+	defer close(done)
+
 	for {
-		// block on change notifications
-		rsp := <-rsps
+		// block on change notifications, until asked to stop
+		var rsp *etcd.Response
+		ok := false
+		select {
+		case rsp, ok = <-rsps:
+		case <-stop:
+		}
+		if !ok {
+			log.Printf("stopped handling etcd events \n")
+			return
+		}
 
 		node := rsp.Node
 		preValue := ""
@@ -307,16 +471,17 @@ func handleEtcdEvents(netPlugin *plugin.NetPlugin, crt *crt.Crt,
 		switch key := node.Key; {
 		case strings.HasPrefix(key, drivers.NW_CFG_PATH_PREFIX):
 			netId := strings.TrimPrefix(key, drivers.NW_CFG_PATH_PREFIX)
-			processNetEvent(netPlugin, netId, preValue, opts)
+			err := processNetEvent(netPlugin, netId, preValue, opts)
+			metrics.CountEvent("etcd", metrics.CONSTRUCT_NW, err)
+			health.setLastEvent("etcd", key, err)
 
 		case strings.HasPrefix(key, drivers.EP_CFG_PATH_PREFIX):
 			epId := strings.TrimPrefix(key, drivers.EP_CFG_PATH_PREFIX)
-			processEpEvent(netPlugin, crt, epId, preValue, opts)
+			err := processEpEvent(netPlugin, crt, epId, preValue, opts)
+			metrics.CountEvent("etcd", metrics.CONSTRUCT_EP, err)
+			health.setLastEvent("etcd", key, err)
 		}
 	}
-
-	// shall never come here
-	retErr <- nil
 }
 
 func attachContainer(stateDriver core.StateDriver, crt *crt.Crt, contName string) error {
@@ -377,6 +542,18 @@ func handleDockerEvents(event *dockerclient.Event, retErr chan error,
 		log.Printf("error decoding netplugin in handleDocker \n")
 	}
 
+	inFlight, ok := args[2].(*inFlightEvents)
+	if !ok {
+		log.Printf("error decoding in-flight tracker in handleDocker \n")
+	} else {
+		if !inFlight.start() {
+			log.Printf("dropping event %s for container %s received during "+
+				"shutdown \n", event.Status, event.Id)
+			return
+		}
+		defer inFlight.done()
+	}
+
 	log.Printf("Received event: %#v, for netPlugin %v \n", *event, netPlugin)
 
 	// XXX: with plugin (in a lib) this code will handle these events
@@ -396,45 +573,143 @@ func handleDockerEvents(event *dockerclient.Event, retErr chan error,
 		// or reincarnation of the same container
 
 	}
+	metrics.CountEvent("docker", event.Status, err)
+	health.setLastEvent("docker", event.Status+" "+event.Id, err)
 
+	// the first error stops the event handling, the others are only logged
 	if err != nil {
-		retErr <- err
+		select {
+		case retErr <- err:
+		default:
+		}
 	}
 }
 
 func handleEvents(netPlugin *plugin.NetPlugin, crt *crt.Crt,
-	opts cliOpts) error {
+	sigs chan os.Signal, opts cliOpts) error {
 
 	// watch the etcd changes and call the respective plugin APIs
 	rsps := make(chan *etcd.Response)
 	recvErr := make(chan error, 1)
 	stop := make(chan bool, 1)
+	etcdDone := make(chan bool)
+	inFlight := &inFlightEvents{}
 	etcdDriver := netPlugin.StateDriver.(*drivers.EtcdStateDriver)
 	etcdClient := etcdDriver.Client
 
-	go handleEtcdEvents(netPlugin, crt, rsps, stop, recvErr, opts)
+	go handleEtcdEvents(netPlugin, crt, rsps, stop, etcdDone, opts)
 
+	var dockerCrt *docker.Docker
 	if !opts.nativeInteg {
 		// start docker client and handle docker events
 		// wait on error chan for problems handling the docker events
-		dockerCrt := crt.ContainerIf.(*docker.Docker)
+		dockerCrt = crt.ContainerIf.(*docker.Docker)
 		dockerCrt.Client.StartMonitorEvents(handleDockerEvents, recvErr,
-			netPlugin, crt)
+			netPlugin, crt, inFlight)
 	}
 
 	// XXX: todo, restore any config that might have been created till this
 	// point
-	_, err := etcdClient.Watch(drivers.CFG_PATH, 0, RECURSIVE, rsps, stop)
-	if err != nil && err != etcd.ErrWatchStoppedByUser {
-		log.Printf("etcd watch failed. Error: %s", err)
-		return err
+	go func() {
+		_, err := etcdClient.Watch(drivers.CFG_PATH, 0, RECURSIVE, rsps, stop)
+		if err != nil && err != etcd.ErrWatchStoppedByUser {
+			log.Printf("etcd watch failed. Error: %s", err)
+			select {
+			case recvErr <- err:
+			default:
+			}
+		}
+	}()
+
+	var err error
+	select {
+	case sig := <-sigs:
+		log.Printf("Received signal '%s', shutting down \n", sig)
+	case err = <-recvErr:
+		if err != nil {
+			log.Printf("Failure occured. Error: %s", err)
+		}
+	}
+
+	// stop the event sources and let the events being processed complete
+	close(stop)
+	if dockerCrt != nil {
+		dockerCrt.Client.StopAllMonitorEvents()
 	}
+	<-etcdDone
+	inFlight.stopAndWait()
+
+	return err
+}
+
+// the configuration of the plugin and of the container runtime
+type netdConfig struct {
+	Drivers struct {
+		Network  string `json:"network"`
+		Endpoint string `json:"endpoint"`
+		State    string `json:"state"`
+	} `json:"drivers"`
+	Ovs struct {
+		DbIp         string `json:"dbip"`
+		DbPort       int    `json:"dbport"`
+		RetainBridge bool   `json:"retainBridge"`
+		HostLabel    string `json:"hostLabel"`
+	} `json:"ovs"`
+	Etcd struct {
+		Machines []string `json:"machines"`
+	} `json:"etcd"`
+	Crt struct {
+		Type string `json:"type"`
+	} `json:"crt"`
+	Docker struct {
+		Socket string `json:"socket"`
+	} `json:"docker"`
+}
 
-	err = <-recvErr
+// pluginConfig returns the json configuration of the plugin, the host label
+// being escaped as any other string
+func pluginConfig(opts cliOpts) (string, error) {
+	cfg := &netdConfig{}
+	cfg.Drivers.Network = "ovs"
+	cfg.Drivers.Endpoint = "ovs"
+	cfg.Drivers.State = "etcd"
+	cfg.Ovs.DbIp = "127.0.0.1"
+	cfg.Ovs.DbPort = 6640
+	cfg.Ovs.RetainBridge = opts.retainBridge
+	cfg.Ovs.HostLabel = opts.hostLabel
+	cfg.Etcd.Machines = []string{"http://127.0.0.1:4001"}
+	cfg.Crt.Type = "docker"
+	cfg.Docker.Socket = "unix:///var/run/docker.sock"
+
+	configBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(configBytes), nil
+}
+
+func startHttpServer(netPlugin *plugin.NetPlugin, crt *crt.Crt,
+	opts cliOpts) error {
+	err := metrics.RegisterGaugeFunc("host", "networks",
+		"Number of networks programmed on this host.",
+		func() float64 { return programmed.count(programmed.nets) })
 	if err != nil {
-		log.Printf("Failure occured. Error: %s", err)
 		return err
 	}
+	err = metrics.RegisterGaugeFunc("host", "endpoints",
+		"Number of endpoints programmed on this host.",
+		func() float64 { return programmed.count(programmed.eps) })
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	metrics.AddHandler(mux)
+	addHealthHandlers(mux, netPlugin, crt)
+	go func() {
+		err := http.ListenAndServe(opts.listenAddr, mux)
+		log.Printf("http server on '%s' exited. Error: %s", opts.listenAddr, err)
+	}()
 
 	return nil
 }
@@ -462,6 +737,14 @@ func main() {
 		"publish-vtep",
 		false,
 		"publish the vtep when allowed by global policy")
+	flagSet.BoolVar(&opts.retainBridge,
+		"retain-bridge",
+		false,
+		"do not delete the ovs bridge on exit, so that the existing connectivity is kept across restarts")
+	flagSet.StringVar(&opts.listenAddr,
+		"listen-addr",
+		":9005",
+		"address to serve the http endpoints (/metrics, /health and /ready) on, empty string disables the http server")
 
 	err = flagSet.Parse(os.Args[1:])
 	if err != nil {
@@ -472,26 +755,18 @@ func main() {
 		log.Printf("host-label not specified, using default (%s)", opts.hostLabel)
 	}
 
-	configStr := `{
-                    "drivers" : {
-                       "network": "ovs",
-                       "endpoint": "ovs",
-                       "state": "etcd"
-                    },
-                    "ovs" : {
-                       "dbip": "127.0.0.1",
-                       "dbport": 6640
-                    },
-                    "etcd" : {
-                        "machines": ["http://127.0.0.1:4001"]
-                    },
-                    "crt" : {
-                       "type": "docker"
-                    },
-                    "docker" : {
-                        "socket" : "unix:///var/run/docker.sock"
-                    }
-                  }`
+	configStr, err := pluginConfig(opts)
+	if err != nil {
+		log.Fatalf("Failed to build the plugin config. Error: %s", err)
+	}
+
+	// register for termination signals before any state gets programmed,
+	// so that a signal received during the replay of the current state
+	// doesn't kill the daemon in middle of programming; the signal is
+	// handled once the replay completes
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
 	netPlugin := &plugin.NetPlugin{}
 
 	err = netPlugin.Init(configStr)
@@ -507,12 +782,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	processCurrentState(netPlugin, crt, opts)
+	if opts.listenAddr != "" {
+		err = startHttpServer(netPlugin, crt, opts)
+		if err != nil {
+			log.Printf("Failed to start the http server, err %s \n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = processCurrentState(netPlugin, crt, opts)
+	if err != nil {
+		log.Printf("Failed to replay the current state, err %s \n", err)
+	}
+	health.setReplayCompleted(err)
 
 	//logger := log.New(os.Stdout, "go-etcd: ", log.LstdFlags)
 	//etcd.SetLogger(logger)
 
-	err = handleEvents(netPlugin, crt, opts)
+	err = handleEvents(netPlugin, crt, sigs, opts)
+	signal.Stop(sigs)
+
+	crt.Deinit()
+	netPlugin.Deinit()
+
 	if err != nil {
 		os.Exit(1)
 	} else {
@@ -0,0 +1,60 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/contiv/netplugin/netmaster"
+)
+
+func renderAudit(rep *netmaster.AuditReport, w io.Writer, format string) error {
+	result := &listResult{columns: []string{"TENANT", "RESOURCE", "ID",
+		"VALUE", "PROBLEM", "USED-BY", "REPAIRED"}}
+	for _, f := range rep.Findings {
+		result.add(f, f.Tenant, f.Resource, f.ResourceId, f.Value, f.Problem,
+			strings.Join(f.UsedBy, ","), strconv.FormatBool(f.Repaired))
+	}
+
+	return result.render(w, format)
+}
+
+func auditResources(defOpts *cliOpts, w io.Writer) error {
+	stateDriver, err := initEtcd(defOpts)
+	if err != nil {
+		log.Fatalf("Failed to init etcd driver. Error: %s", err)
+	}
+
+	// repairs mutate the allocations, like the netmaster operations
+	if defOpts.repair {
+		le, err := acquireLeadership(stateDriver)
+		if err != nil {
+			return err
+		}
+		defer releaseLeadership(le)
+	}
+
+	rep, err := netmaster.AuditResources(stateDriver, defOpts.repair)
+	if err != nil {
+		log.Printf("error '%s' auditing the resources \n", err)
+		return err
+	}
+
+	return renderAudit(rep, w, defOpts.output)
+}
@@ -17,8 +17,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
+	"os"
 	"time"
 
 	"github.com/contiv/netplugin/core"
@@ -172,10 +174,27 @@ func deleteDelta(stateDriver core.StateDriver, allCfg *netmaster.Config) error {
 		}
 	}
 
+	if allCfg.HostVlans == "" {
+		err1 := netmaster.SetHostVlans(stateDriver, "")
+		if err1 != nil {
+			log.Printf("error '%s' removing the host vlans \n", err1)
+			err = err1
+		}
+	}
+
 	return err
 }
 
 func processAdditions(stateDriver core.StateDriver, allCfg *netmaster.Config) (err error) {
+	// the host vlans are set aside ahead of the tenants' vlans
+	if allCfg.HostVlans != "" {
+		err = netmaster.SetHostVlans(stateDriver, allCfg.HostVlans)
+		if err != nil {
+			log.Printf("error '%s' setting the host vlans \n", err)
+			return
+		}
+	}
+
 	for _, host := range allCfg.Hosts {
 		err1 := netmaster.CreateHost(stateDriver, &host)
 		if err1 != nil {
@@ -273,28 +292,56 @@ func executeJsonCfg(defOpts *cliOpts) (err error) {
 	}
 
 	if opts.cfgHostBindings {
-		epBindings := []netmaster.ConfigEp{}
-		err = json.Unmarshal(data, &epBindings)
+		epBindings, err := netmaster.ParseEpBindings(data)
 		if err != nil {
 			log.Printf("error '%s' unmarshing host bindings, data ============\n%s\n=============\n", err, data)
-			return
+			return err
+		}
+
+		le, err := acquireLeadership(stateDriver)
+		if err != nil {
+			return err
 		}
+		defer releaseLeadership(le)
 
 		err = netmaster.CreateEpBindings(stateDriver, &epBindings)
 		if err != nil {
 			log.Printf("error '%s' creating host bindings \n", err)
 		}
-		return
+		return err
 	}
 
-	allCfg := &netmaster.Config{}
-	err = json.Unmarshal(data, allCfg)
+	allCfg, err := netmaster.ParseConfig(data)
 	if err != nil {
 		log.Printf("error '%s' unmarshaling tenant cfg, data %s \n", err, data)
 		return
 	}
 	// log.Printf("parsed config %v \n", allCfg)
 
+	// the plan is computed and confirmed under the lease, so that the state
+	// it is computed from is the one it is applied to
+	le, err := acquireLeadership(stateDriver)
+	if err != nil {
+		return err
+	}
+	defer releaseLeadership(le)
+
+	if defOpts.cfgPlan || !defOpts.force {
+		plan, err := computePlan(stateDriver, allCfg, defOpts)
+		if err != nil {
+			log.Printf("error '%s' computing the plan \n", err)
+			return err
+		}
+		if defOpts.cfgPlan {
+			plan.print(os.Stdout)
+			return nil
+		}
+		if plan.isDestructive() && !confirmPlan(plan, os.Stdin, os.Stdout) {
+			return errors.New("plan not confirmed, use -force to apply " +
+				"deletions without a confirmation")
+		}
+	}
+
 	if defOpts.cfgDesired {
 		err = deleteDelta(stateDriver, allCfg)
 	}
@@ -318,3 +365,71 @@ func executeJsonCfg(defOpts *cliOpts) (err error) {
 
 	return
 }
+
+func exportJsonCfg(defOpts *cliOpts) error {
+	stateDriver, err := initEtcd(defOpts)
+	if err != nil {
+		log.Fatalf("Failed to init etcd driver. Error: %s", err)
+	}
+
+	allCfg, err := netmaster.ExportConfig(stateDriver, defOpts.pinAuto)
+	if err != nil {
+		log.Printf("error '%s' exporting the config \n", err)
+		return err
+	}
+
+	data, err := json.MarshalIndent(allCfg, "", "    ")
+	if err != nil {
+		log.Printf("error '%s' marshaling the config \n", err)
+		return err
+	}
+	data = append(data, '\n')
+
+	if defOpts.idStr == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(defOpts.idStr, data, 0644)
+}
+
+func validateJsonCfg(defOpts *cliOpts) error {
+	data, err := ioutil.ReadFile(defOpts.idStr)
+	if err != nil {
+		return err
+	}
+
+	if defOpts.cfgHostBindings {
+		epBindings, err := netmaster.ParseEpBindings(data)
+		if err != nil {
+			return err
+		}
+		for _, ep := range epBindings {
+			if ep.Host == "" || ep.Container == "" {
+				return errors.New("host and container are needed for a binding")
+			}
+		}
+	} else {
+		allCfg, err := netmaster.ParseConfig(data)
+		if err != nil {
+			return err
+		}
+		err = netmaster.ValidateConfig(allCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("%s is valid \n", defOpts.idStr)
+	return nil
+}
+
+func printCfgSchema() error {
+	schema, err := netmaster.ConfigSchema()
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(schema)
+	return err
+}
@@ -0,0 +1,58 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/netmaster"
+)
+
+// acquireLeadership contends for the netmaster leadership and makes the
+// subsequent netmaster operations conditional to holding it. It waits past a
+// failover timeout, so that the lease of an unresponsive leader can expire and
+// be retried for.
+// The returned elector must be stopped to give up the leadership.
+func acquireLeadership(stateDriver core.StateDriver) (*netmaster.LeaderElector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	le := &netmaster.LeaderElector{StateDriver: stateDriver,
+		Id: fmt.Sprintf("%s:%d", hostname, os.Getpid())}
+	err = le.Start()
+	if err != nil {
+		log.Printf("error '%s' starting the leader election \n", err)
+		return nil, err
+	}
+
+	if !le.AwaitLeadership(netmaster.DEFAULT_FAILOVER_TIMEOUT * 4 / 3) {
+		le.Stop()
+		return nil, &core.Error{Desc: "another netmaster holds the leadership"}
+	}
+
+	netmaster.SetLeaderElector(le)
+	return le, nil
+}
+
+func releaseLeadership(le *netmaster.LeaderElector) {
+	netmaster.SetLeaderElector(nil)
+	le.Stop()
+}
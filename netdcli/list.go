@@ -0,0 +1,349 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netmaster"
+	"github.com/contiv/netplugin/resources"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_YAML  = "yaml"
+)
+
+var outputFormats = []string{OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_YAML}
+
+// filters applied when listing the constructs; an empty value matches all
+type listFilter struct {
+	id     string
+	tenant string
+	netId  string
+	host   string
+}
+
+func matches(filter, val string) bool {
+	return filter == "" || filter == val
+}
+
+// result of a list, kept both as table rows and as the objects listed, the
+// latter are what the json and yaml outputs consist of
+type listResult struct {
+	columns []string
+	rows    [][]string
+	objs    []interface{}
+}
+
+func (r *listResult) add(obj interface{}, row ...string) {
+	r.objs = append(r.objs, obj)
+	r.rows = append(r.rows, row)
+}
+
+func (r *listResult) render(w io.Writer, format string) error {
+	switch format {
+	case OUTPUT_JSON:
+		data, err := json.MarshalIndent(r.objs, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", data)
+	case OUTPUT_YAML:
+		// go through json so that the field names are the same in both
+		data, err := json.Marshal(r.objs)
+		if err != nil {
+			return err
+		}
+		var objs interface{}
+		err = yaml.Unmarshal(data, &objs)
+		if err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(objs)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s", data)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(r.columns, "\t"))
+		for _, row := range r.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+
+	return nil
+}
+
+func listNetworks(stateDriver core.StateDriver, filter *listFilter) (*listResult, error) {
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = stateDriver
+	nwCfgs, err := readAllStates(readNet)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &listResult{columns: []string{"NAME", "TENANT", "TYPE", "TAG",
+		"EXT-TAG", "SUBNET", "GATEWAY", "ENDPOINTS"}}
+	for _, nwCfg := range nwCfgs {
+		cfg := nwCfg.(*drivers.OvsCfgNetworkState)
+		if !matches(filter.id, cfg.Id) || !matches(filter.netId, cfg.Id) ||
+			!matches(filter.tenant, cfg.Tenant) {
+			continue
+		}
+		result.add(cfg, cfg.Id, cfg.Tenant, cfg.PktTagType,
+			strconv.Itoa(cfg.PktTag), strconv.Itoa(cfg.ExtPktTag),
+			fmt.Sprintf("%s/%d", cfg.SubnetIp, cfg.SubnetLen), cfg.DefaultGw,
+			strconv.Itoa(cfg.EpCount))
+	}
+
+	return result, nil
+}
+
+func listEndpoints(stateDriver core.StateDriver, filter *listFilter) (*listResult, error) {
+	readEp := &drivers.OvsCfgEndpointState{}
+	readEp.StateDriver = stateDriver
+	epCfgs, err := readAllStates(readEp)
+	if err != nil {
+		return nil, err
+	}
+
+	// an endpoint belongs to the tenant of its network
+	nwTenants := make(map[string]string)
+	if filter.tenant != "" {
+		readNet := &drivers.OvsCfgNetworkState{}
+		readNet.StateDriver = stateDriver
+		nwCfgs, err := readAllStates(readNet)
+		if err != nil {
+			return nil, err
+		}
+		for _, nwCfg := range nwCfgs {
+			cfg := nwCfg.(*drivers.OvsCfgNetworkState)
+			nwTenants[cfg.Id] = cfg.Tenant
+		}
+	}
+
+	result := &listResult{columns: []string{"NAME", "NETWORK", "CONTAINER",
+		"HOST", "IP-ADDRESS", "INTF", "VTEP-IP"}}
+	for _, epCfg := range epCfgs {
+		cfg := epCfg.(*drivers.OvsCfgEndpointState)
+		if !matches(filter.id, cfg.Id) || !matches(filter.netId, cfg.NetId) ||
+			!matches(filter.host, cfg.HomingHost) ||
+			!matches(filter.tenant, nwTenants[cfg.NetId]) {
+			continue
+		}
+		result.add(cfg, cfg.Id, cfg.NetId, cfg.ContName, cfg.HomingHost,
+			cfg.IpAddress, cfg.IntfName, cfg.VtepIp)
+	}
+
+	return result, nil
+}
+
+func listTenants(stateDriver core.StateDriver, filter *listFilter) (*listResult, error) {
+	readGlbl := &gstate.Cfg{}
+	readGlbl.StateDriver = stateDriver
+	gCfgs, err := readAllStates(readGlbl)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &listResult{columns: []string{"TENANT", "DEFAULT-NET-TYPE",
+		"SUBNET-POOL", "ALLOC-SUBNET-LEN", "VLANS", "VXLANS"}}
+	for _, gCfg := range gCfgs {
+		cfg := gCfg.(*gstate.Cfg)
+		if !matches(filter.id, cfg.Tenant) || !matches(filter.tenant, cfg.Tenant) {
+			continue
+		}
+		subnetPool := ""
+		if cfg.Auto.SubnetPool != "" {
+			subnetPool = fmt.Sprintf("%s/%d", cfg.Auto.SubnetPool,
+				cfg.Auto.SubnetLen)
+		}
+		result.add(cfg, cfg.Tenant, cfg.Deploy.DefaultNetType, subnetPool,
+			strconv.Itoa(int(cfg.Auto.AllocSubnetLen)), cfg.Auto.Vlans,
+			cfg.Auto.Vxlans)
+	}
+
+	return result, nil
+}
+
+func listHosts(stateDriver core.StateDriver, filter *listFilter) (*listResult, error) {
+	readHost := &netmaster.MasterHostConfig{}
+	readHost.StateDriver = stateDriver
+	hostCfgs, err := readAllStates(readHost)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &listResult{columns: []string{"NAME", "INTF", "VTEP-IP", "NET-ID"}}
+	for _, hostCfg := range hostCfgs {
+		cfg := hostCfg.(*netmaster.MasterHostConfig)
+		if !matches(filter.id, cfg.Name) || !matches(filter.host, cfg.Name) {
+			continue
+		}
+		result.add(cfg, cfg.Name, cfg.Intf, cfg.VtepIp, cfg.NetId)
+	}
+
+	return result, nil
+}
+
+// usage of a tenant's resource pool
+type poolUsage struct {
+	Tenant   string `json:"tenant"`
+	Resource string `json:"resource"`
+	Capacity uint   `json:"capacity"`
+	Used     uint   `json:"used"`
+}
+
+func (r *listResult) addPoolUsage(tenant, rsrc string, capacity, free uint) {
+	usage := &poolUsage{Tenant: tenant, Resource: rsrc, Capacity: capacity}
+	if capacity > free {
+		usage.Used = capacity - free
+	}
+	r.add(usage, usage.Tenant, usage.Resource,
+		strconv.Itoa(int(usage.Capacity)), strconv.Itoa(int(usage.Used)))
+}
+
+func listPools(stateDriver core.StateDriver, construct string,
+	filter *listFilter) (*listResult, error) {
+	var rsrcs []core.State
+	var err error
+
+	switch construct {
+	case CLI_CONSTRUCT_VLAN_RSRC:
+		readRsrc := &resources.AutoVlanCfgResource{}
+		readRsrc.StateDriver = stateDriver
+		rsrcs, err = readAllStates(readRsrc)
+	case CLI_CONSTRUCT_VXLAN_RSRC:
+		readRsrc := &resources.AutoVxlanCfgResource{}
+		readRsrc.StateDriver = stateDriver
+		rsrcs, err = readAllStates(readRsrc)
+	case CLI_CONSTRUCT_SUBNET_RSRC:
+		readRsrc := &resources.AutoSubnetCfgResource{}
+		readRsrc.StateDriver = stateDriver
+		rsrcs, err = readAllStates(readRsrc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &listResult{columns: []string{"TENANT", "RESOURCE", "CAPACITY",
+		"USED"}}
+	for _, rsrc := range rsrcs {
+		switch cfg := rsrc.(type) {
+		case *resources.AutoVlanCfgResource:
+			if !matches(filter.id, cfg.Id) || !matches(filter.tenant, cfg.Id) {
+				continue
+			}
+			oper := &resources.AutoVlanOperResource{}
+			oper.StateDriver = stateDriver
+			if err = oper.Read(cfg.Id); err != nil {
+				return nil, err
+			}
+			result.addPoolUsage(cfg.Id, resources.AUTO_VLAN_RSRC,
+				cfg.Vlans.Count(), oper.FreeVlans.Count())
+		case *resources.AutoVxlanCfgResource:
+			if !matches(filter.id, cfg.Id) || !matches(filter.tenant, cfg.Id) {
+				continue
+			}
+			oper := &resources.AutoVxlanOperResource{}
+			oper.StateDriver = stateDriver
+			if err = oper.Read(cfg.Id); err != nil {
+				return nil, err
+			}
+			result.addPoolUsage(cfg.Id, resources.AUTO_VXLAN_RSRC,
+				cfg.Vxlans.Count(), oper.FreeVxlans.Count())
+			// the hosts pick the local vlans of some tenants
+			if !cfg.HostLocalVlans {
+				result.addPoolUsage(cfg.Id, resources.LOCAL_VLAN_POOL,
+					cfg.LocalVlans.Count(), oper.FreeLocalVlans.Count())
+			}
+		case *resources.AutoSubnetCfgResource:
+			if !matches(filter.id, cfg.Id) || !matches(filter.tenant, cfg.Id) {
+				continue
+			}
+			oper := &resources.AutoSubnetOperResource{}
+			oper.StateDriver = stateDriver
+			if err = oper.Read(cfg.Id); err != nil {
+				return nil, err
+			}
+			result.addPoolUsage(cfg.Id, resources.AUTO_SUBNET_RSRC,
+				uint(1)<<(cfg.AllocSubnetLen-cfg.SubnetPoolLen),
+				oper.FreeSubnets.Count())
+		}
+	}
+
+	return result, nil
+}
+
+func listConstruct(stateDriver core.StateDriver, construct string,
+	filter *listFilter) (*listResult, error) {
+	switch construct {
+	case CLI_CONSTRUCT_NW:
+		return listNetworks(stateDriver, filter)
+	case CLI_CONSTRUCT_EP:
+		return listEndpoints(stateDriver, filter)
+	case CLI_CONSTRUCT_GLOBAL:
+		return listTenants(stateDriver, filter)
+	case CLI_CONSTRUCT_HOST:
+		return listHosts(stateDriver, filter)
+	case CLI_CONSTRUCT_VLAN_RSRC, CLI_CONSTRUCT_VXLAN_RSRC,
+		CLI_CONSTRUCT_SUBNET_RSRC:
+		return listPools(stateDriver, construct, filter)
+	}
+
+	return nil, &CliError{Desc: fmt.Sprintf("list not supported for construct %s",
+		construct)}
+}
+
+// executeList lists the constructs matching the filters specified on the
+// command line. A get with an output format is a list of the named construct.
+func executeList(stateDriver core.StateDriver, opts *cliOpts, w io.Writer) error {
+	filter := &listFilter{netId: opts.netId}
+	if isFlagSet("tenant") {
+		filter.tenant = opts.tenant
+	}
+	if isFlagSet("host") {
+		filter.host = opts.homingHost
+	}
+	if opts.oper.Get() == CLI_OPER_GET {
+		filter.id = opts.idStr
+	}
+
+	result, err := listConstruct(stateDriver, opts.construct.Get().(string), filter)
+	if err != nil {
+		return err
+	}
+	if opts.oper.Get() == CLI_OPER_GET && len(result.objs) == 0 {
+		return &CliError{Desc: fmt.Sprintf("%s %q not found",
+			opts.construct.Get(), opts.idStr)}
+	}
+
+	return result.render(w, opts.output)
+}
@@ -0,0 +1,35 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/contiv/netplugin/netmaster"
+)
+
+// serveMetrics exports the cluster-wide metrics of the netmaster, like the
+// usage of the tenants' pools. Unlike the per host metrics of netd, these are
+// served from a single place.
+func serveMetrics(defOpts *cliOpts) error {
+	stateDriver, err := initEtcd(defOpts)
+	if err != nil {
+		log.Fatalf("Failed to init etcd driver. Error: %s", err)
+	}
+
+	log.Printf("serving netmaster metrics on '%s' \n", defOpts.metricsListen)
+	return netmaster.ServeMetrics(stateDriver, defOpts.metricsListen)
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/contiv/netplugin/core"
 	"github.com/contiv/netplugin/drivers"
 	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netmaster"
 	"github.com/contiv/netplugin/netutils"
 	"github.com/contiv/netplugin/resources"
 )
@@ -35,10 +36,12 @@ const (
 	CLI_CONSTRUCT_GLOBAL      = "global"
 	CLI_CONSTRUCT_NW          = "network"
 	CLI_CONSTRUCT_EP          = "endpoint"
+	CLI_CONSTRUCT_HOST        = "host"
 	CLI_CONSTRUCT_VLAN_RSRC   = "vlan-rsrc"
 	CLI_CONSTRUCT_VXLAN_RSRC  = "vxlan-rsrc"
 	CLI_CONSTRUCT_SUBNET_RSRC = "subnet-rsrc"
 	CLI_OPER_GET              = "get"
+	CLI_OPER_LIST             = "list"
 	CLI_OPER_CREATE           = "create"
 	CLI_OPER_DELETE           = "delete"
 	CLI_OPER_ATTACH           = "attach"
@@ -49,12 +52,13 @@ var constructs = []string{
 	CLI_CONSTRUCT_GLOBAL,
 	CLI_CONSTRUCT_NW,
 	CLI_CONSTRUCT_EP,
+	CLI_CONSTRUCT_HOST,
 	CLI_CONSTRUCT_VLAN_RSRC,
 	CLI_CONSTRUCT_VXLAN_RSRC,
 	CLI_CONSTRUCT_SUBNET_RSRC,
 }
 
-var validOperList = []string{CLI_OPER_GET, CLI_OPER_CREATE, CLI_OPER_DELETE, CLI_OPER_ATTACH, CLI_OPER_DETACH}
+var validOperList = []string{CLI_OPER_GET, CLI_OPER_LIST, CLI_OPER_CREATE, CLI_OPER_DELETE, CLI_OPER_ATTACH, CLI_OPER_DETACH}
 
 type CliError struct {
 	Desc string
@@ -124,6 +128,16 @@ type cliOpts struct {
 	cfgAdditions    bool
 	cfgDeletions    bool
 	cfgHostBindings bool
+	cfgPlan         bool
+	cfgExport       bool
+	cfgValidate     bool
+	cfgSchema       bool
+	pinAuto         bool
+	force           bool
+	audit           bool
+	repair          bool
+	usage           bool
+	quota           bool
 	oper            Operation
 	construct       Construct
 	etcdUrl         string
@@ -145,6 +159,8 @@ type cliOpts struct {
 	homingHost      string
 	vtepIp          string
 	intfName        string
+	output          string
+	metricsListen   string
 }
 
 var opts cliOpts
@@ -165,15 +181,55 @@ func init() {
 	flagSet.BoolVar(&opts.cfgAdditions,
 		"add-cfg",
 		false,
-		"Json file describing addition to global and network intent")
+		"Json or yaml file describing addition to global and network intent")
 	flagSet.BoolVar(&opts.cfgDeletions,
 		"del-cfg",
 		false,
-		"Json file describing deletion from global and network intent")
+		"Json or yaml file describing deletion from global and network intent")
 	flagSet.BoolVar(&opts.cfgDesired,
 		"cfg",
 		false,
-		"Json file describing the global and network intent")
+		"Json or yaml file describing the global and network intent")
+	flagSet.BoolVar(&opts.cfgPlan,
+		"plan",
+		false,
+		"Print the changes a -cfg, -add-cfg or -del-cfg file would make, without applying them")
+	flagSet.BoolVar(&opts.cfgExport,
+		"export-cfg",
+		false,
+		"Export the current state as a json file describing the global and network intent, written to stdout if no file is specified")
+	flagSet.BoolVar(&opts.cfgValidate,
+		"validate-cfg",
+		false,
+		"Validate a json or yaml file describing the intent (or the host bindings with -host-bindings-cfg), without applying it")
+	flagSet.BoolVar(&opts.cfgSchema,
+		"cfg-schema",
+		false,
+		"Print the json-schema of the file describing the global and network intent")
+	flagSet.BoolVar(&opts.pinAuto,
+		"pin-auto",
+		false,
+		"Include the auto-allocated values in the exported intent")
+	flagSet.BoolVar(&opts.force,
+		"force",
+		false,
+		"Apply a config that deletes constructs without asking for a confirmation")
+	flagSet.BoolVar(&opts.audit,
+		"audit",
+		false,
+		"Report the leaked and doubly allocated vlans, vxlans, subnets and ips")
+	flagSet.BoolVar(&opts.repair,
+		"repair",
+		false,
+		"Repair the leaked resources found by -audit")
+	flagSet.BoolVar(&opts.usage,
+		"usage",
+		false,
+		"Report the capacity, the usage and the allocated values of the resources of the tenant given by -tenant")
+	flagSet.BoolVar(&opts.quota,
+		"quota",
+		false,
+		"Report the networks, endpoints, vlans, vxlans and subnets of the tenant given by -tenant against its quotas")
 	flagSet.StringVar(&opts.etcdUrl,
 		"etcd-url",
 		"http://127.0.0.1:4001",
@@ -238,10 +294,32 @@ func init() {
 		"intf-name",
 		"",
 		"Name of an exisitng linux device to use as endpoint's interface. This can be used for adding the host interface to the bridge for vlan based networks.")
+	flagSet.StringVar(&opts.output,
+		"output",
+		"",
+		fmt.Sprintf("Output format of get, list, audit, usage and quota operations %s. "+
+			"Lists are output as a table by default", outputFormats))
+
+	flagSet.StringVar(&opts.metricsListen,
+		"metrics-listen",
+		"",
+		"Serve the usage of the tenants' vlan, vxlan and subnet pools as prometheus metrics on this address e.g. ':9101', until interrupted")
 
 	flagSet.BoolVar(&opts.help, "help", false, "prints this message")
 }
 
+// returns true if the flag was specified on the command line, as opposed to
+// carrying its default value
+func isFlagSet(name string) bool {
+	found := false
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [OPTION]...\n", os.Args[0])
 	flagSet.PrintDefaults()
@@ -255,7 +333,7 @@ func logFatalSubnetAndMaskFormatError() {
 func validateOpts(opts *cliOpts) error {
 	var err error
 
-	if flagSet.NArg() != 1 || opts.help {
+	if (flagSet.NArg() != 1 && opts.oper.Get() != CLI_OPER_LIST) || opts.help {
 		usage()
 		return nil
 	}
@@ -268,6 +346,12 @@ func validateOpts(opts *cliOpts) error {
 		log.Fatalf("A construct must be specified")
 	}
 
+	if opts.output != "" && opts.output != OUTPUT_TABLE &&
+		opts.output != OUTPUT_JSON && opts.output != OUTPUT_YAML {
+		log.Fatalf("error '%s' output format not supported, allowed values: %s",
+			opts.output, outputFormats)
+	}
+
 	if opts.pktTagType != "vxlan" && opts.pktTagType != "vlan" {
 		log.Fatalf("error '%s' packet tag type not supported", opts.pktTagType)
 	}
@@ -376,6 +460,15 @@ func executeOpts(opts *cliOpts) error {
 		log.Fatalf("Failed to init etcd driver. Error: %s", err)
 	}
 
+	if opts.oper.Get() == CLI_OPER_LIST ||
+		(opts.oper.Get() == CLI_OPER_GET && opts.output != "") {
+		err = executeList(etcdDriver, opts, os.Stdout)
+		if err != nil {
+			log.Fatalf("Failed to list %s. Error: %s", opts.construct.Get(), err)
+		}
+		return err
+	}
+
 	switch opts.construct.Get() {
 	case CLI_CONSTRUCT_EP:
 		if opts.oper.Get() == CLI_OPER_GET {
@@ -459,6 +552,14 @@ func executeOpts(opts *cliOpts) error {
 			log.Fatalf("error '%s' \n", err)
 		}
 		return err
+	case CLI_CONSTRUCT_HOST:
+		if opts.oper.Get() == CLI_OPER_GET {
+			hostCfg := &netmaster.MasterHostConfig{}
+			hostCfg.StateDriver = etcdDriver
+			state = hostCfg
+		} else {
+			return fmt.Errorf("Only get and list operations are supported for hosts")
+		}
 	case CLI_CONSTRUCT_VLAN_RSRC:
 		fallthrough
 	case CLI_CONSTRUCT_VXLAN_RSRC:
@@ -518,7 +619,21 @@ func main() {
 	}
 	opts.idStr = flagSet.Arg(0)
 
-	if opts.cfgDesired || opts.cfgDeletions || opts.cfgAdditions || opts.cfgHostBindings {
+	if opts.metricsListen != "" {
+		err = serveMetrics(&opts)
+	} else if opts.cfgSchema {
+		err = printCfgSchema()
+	} else if opts.cfgValidate {
+		err = validateJsonCfg(&opts)
+	} else if opts.audit {
+		err = auditResources(&opts, os.Stdout)
+	} else if opts.usage {
+		err = tenantUsage(&opts, os.Stdout)
+	} else if opts.quota {
+		err = tenantQuotas(&opts, os.Stdout)
+	} else if opts.cfgExport {
+		err = exportJsonCfg(&opts)
+	} else if opts.cfgDesired || opts.cfgDeletions || opts.cfgAdditions || opts.cfgHostBindings {
 		err = executeJsonCfg(&opts)
 	} else {
 		err = executeOpts(&opts)
@@ -0,0 +1,410 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netmaster"
+)
+
+// a plan is the set of changes that applying a json config would make to the
+// state, computed without writing anything
+
+const (
+	PLAN_OPER_CREATE = "create"
+	PLAN_OPER_DELETE = "delete"
+	PLAN_OPER_UPDATE = "update"
+
+	PLAN_CONSTRUCT_HOST   = "host"
+	PLAN_CONSTRUCT_TENANT = "tenant"
+	PLAN_CONSTRUCT_NW     = "network"
+	PLAN_CONSTRUCT_EP     = "endpoint"
+)
+
+type planItem struct {
+	oper      string
+	construct string
+	id        string
+	// resources allocated or released, and other side effects of the change
+	details []string
+}
+
+type cfgPlan struct {
+	items []planItem
+}
+
+func (p *cfgPlan) add(oper, construct, id string, details ...string) {
+	p.items = append(p.items, planItem{oper: oper, construct: construct,
+		id: id, details: details})
+}
+
+func (p *cfgPlan) count(oper string) int {
+	count := 0
+	for _, item := range p.items {
+		if item.oper == oper {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *cfgPlan) isDestructive() bool {
+	return p.count(PLAN_OPER_DELETE) > 0
+}
+
+func (p *cfgPlan) print(w io.Writer) {
+	for _, item := range p.items {
+		fmt.Fprintf(w, "%-6s %-8s %s\n", item.oper, item.construct, item.id)
+		for _, detail := range item.details {
+			fmt.Fprintf(w, "         - %s\n", detail)
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete\n",
+		p.count(PLAN_OPER_CREATE), p.count(PLAN_OPER_UPDATE),
+		p.count(PLAN_OPER_DELETE))
+}
+
+// current state of all the constructs that a json config operates on
+type cfgState struct {
+	hosts     map[string]*netmaster.MasterHostConfig
+	tenants   map[string]*gstate.Cfg
+	masterNws map[string]*netmaster.MasterNwConfig
+	nws       map[string]*drivers.OvsCfgNetworkState
+	eps       map[string]*drivers.OvsCfgEndpointState
+
+	// sorted keys of the above, for a stable plan
+	hostNames []string
+	tenantIds []string
+	nwIds     []string
+	epIds     []string
+}
+
+func readAllStates(st core.State) ([]core.State, error) {
+	states, err := st.ReadAll()
+	if core.ErrIfKeyExists(err) != nil {
+		return nil, err
+	} else if err != nil {
+		states = []core.State{}
+	}
+	return states, nil
+}
+
+func readCfgState(stateDriver core.StateDriver) (*cfgState, error) {
+	cs := &cfgState{
+		hosts:     make(map[string]*netmaster.MasterHostConfig),
+		tenants:   make(map[string]*gstate.Cfg),
+		masterNws: make(map[string]*netmaster.MasterNwConfig),
+		nws:       make(map[string]*drivers.OvsCfgNetworkState),
+		eps:       make(map[string]*drivers.OvsCfgEndpointState),
+	}
+
+	readHost := &netmaster.MasterHostConfig{}
+	readHost.StateDriver = stateDriver
+	hostCfgs, err := readAllStates(readHost)
+	if err != nil {
+		return nil, err
+	}
+	for _, hostCfg := range hostCfgs {
+		cfg := hostCfg.(*netmaster.MasterHostConfig)
+		cs.hosts[cfg.Name] = cfg
+		cs.hostNames = append(cs.hostNames, cfg.Name)
+	}
+	sort.Strings(cs.hostNames)
+
+	readGlbl := &gstate.Cfg{}
+	readGlbl.StateDriver = stateDriver
+	gCfgs, err := readAllStates(readGlbl)
+	if err != nil {
+		return nil, err
+	}
+	for _, gCfg := range gCfgs {
+		cfg := gCfg.(*gstate.Cfg)
+		cs.tenants[cfg.Tenant] = cfg
+		cs.tenantIds = append(cs.tenantIds, cfg.Tenant)
+	}
+	sort.Strings(cs.tenantIds)
+
+	readMasterNet := &netmaster.MasterNwConfig{}
+	readMasterNet.StateDriver = stateDriver
+	masterNwCfgs, err := readAllStates(readMasterNet)
+	if err != nil {
+		return nil, err
+	}
+	for _, nwCfg := range masterNwCfgs {
+		cfg := nwCfg.(*netmaster.MasterNwConfig)
+		cs.masterNws[cfg.Id] = cfg
+	}
+
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = stateDriver
+	nwCfgs, err := readAllStates(readNet)
+	if err != nil {
+		return nil, err
+	}
+	for _, nwCfg := range nwCfgs {
+		cfg := nwCfg.(*drivers.OvsCfgNetworkState)
+		cs.nws[cfg.Id] = cfg
+		cs.nwIds = append(cs.nwIds, cfg.Id)
+	}
+	sort.Strings(cs.nwIds)
+
+	readEp := &drivers.OvsCfgEndpointState{}
+	readEp.StateDriver = stateDriver
+	epCfgs, err := readAllStates(readEp)
+	if err != nil {
+		return nil, err
+	}
+	for _, epCfg := range epCfgs {
+		cfg := epCfg.(*drivers.OvsCfgEndpointState)
+		cs.eps[cfg.Id] = cfg
+		cs.epIds = append(cs.epIds, cfg.Id)
+	}
+	sort.Strings(cs.epIds)
+
+	return cs, nil
+}
+
+func hostChanges(host *netmaster.ConfigHost,
+	cfg *netmaster.MasterHostConfig) (changes []string) {
+	if host.Intf != cfg.Intf {
+		changes = append(changes, fmt.Sprintf("intf %q => %q", cfg.Intf, host.Intf))
+	}
+	if host.VtepIp != cfg.VtepIp {
+		changes = append(changes, fmt.Sprintf("vtep ip %q => %q",
+			cfg.VtepIp, host.VtepIp))
+	}
+	if host.NetId != cfg.NetId {
+		changes = append(changes, fmt.Sprintf("net id %q => %q",
+			cfg.NetId, host.NetId))
+	}
+	return
+}
+
+func netReleases(nwMasterCfg *netmaster.MasterNwConfig,
+	nwCfg *drivers.OvsCfgNetworkState) (details []string) {
+	if nwCfg.PktTagType == "vlan" {
+		details = append(details, fmt.Sprintf("release vlan %d", nwCfg.PktTag))
+	} else if nwCfg.PktTagType == "vxlan" && nwCfg.PktTag == 0 {
+		// the hosts release the local vlans of their own
+		details = append(details, fmt.Sprintf("release vxlan %d",
+			nwCfg.ExtPktTag))
+	} else if nwCfg.PktTagType == "vxlan" {
+		details = append(details, fmt.Sprintf("release vxlan %d, local vlan %d",
+			nwCfg.ExtPktTag, nwCfg.PktTag))
+	}
+	if nwMasterCfg == nil || nwMasterCfg.SubnetIp == "" {
+		details = append(details, fmt.Sprintf("release subnet %s/%d",
+			nwCfg.SubnetIp, nwCfg.SubnetLen))
+	}
+	return
+}
+
+func netAllocations(tenant *netmaster.ConfigTenant,
+	network *netmaster.ConfigNetwork) (details []string) {
+	pktTagType := network.PktTagType
+	if pktTagType == "" {
+		pktTagType = tenant.DefaultNetType
+	}
+	if network.PktTag == "" {
+		if pktTagType == "vxlan" {
+			details = append(details, fmt.Sprintf(
+				"allocate vxlan and local vlan from tenant %s pool", tenant.Name))
+		} else {
+			details = append(details, fmt.Sprintf(
+				"allocate vlan from tenant %s pool", tenant.Name))
+		}
+	} else {
+		details = append(details, fmt.Sprintf("use %s %s", pktTagType,
+			network.PktTag))
+	}
+	if network.SubnetCIDR == "" {
+		details = append(details, fmt.Sprintf(
+			"allocate subnet from tenant %s pool", tenant.Name))
+	} else {
+		details = append(details, fmt.Sprintf("use subnet %s", network.SubnetCIDR))
+	}
+	return
+}
+
+func epAllocations(network *netmaster.ConfigNetwork,
+	ep *netmaster.ConfigEp) (details []string) {
+	if ep.IpAddress == "" {
+		details = append(details, fmt.Sprintf("allocate ip from network %s",
+			network.Name))
+	} else {
+		details = append(details, fmt.Sprintf("reserve ip %s", ep.IpAddress))
+	}
+	if ep.Host != "" {
+		details = append(details, fmt.Sprintf("bind to host %s", ep.Host))
+	}
+	return
+}
+
+// mirrors deleteDelta
+func planDeleteDelta(cs *cfgState, allCfg *netmaster.Config, plan *cfgPlan) {
+	for _, id := range cs.epIds {
+		if epCfg := cs.eps[id]; !epPresent(allCfg, id) {
+			plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_EP, id,
+				fmt.Sprintf("release ip %s in network %s", epCfg.IpAddress,
+					epCfg.NetId))
+		}
+	}
+
+	for _, id := range cs.nwIds {
+		if nwCfg := cs.nws[id]; !netPresent(allCfg, id) {
+			plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_NW, id,
+				netReleases(cs.masterNws[id], nwCfg)...)
+		}
+	}
+
+	for _, id := range cs.tenantIds {
+		if gCfg := cs.tenants[id]; !tenantPresent(allCfg, id) {
+			plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_TENANT, id,
+				fmt.Sprintf("release vlan pool %q, vxlan pool %q, subnet pool %s/%d",
+					gCfg.Auto.Vlans, gCfg.Auto.Vxlans, gCfg.Auto.SubnetPool,
+					gCfg.Auto.SubnetLen))
+		}
+	}
+
+	for _, name := range cs.hostNames {
+		if hostCfg := cs.hosts[name]; !hostPresent(allCfg, name) {
+			var details []string
+			if hostCfg.VtepIp != "" {
+				details = append(details, fmt.Sprintf("remove vtep %s from all networks",
+					hostCfg.VtepIp))
+			}
+			if hostCfg.Intf != "" {
+				details = append(details, fmt.Sprintf("remove infra intf %s",
+					hostCfg.Intf))
+			}
+			plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_HOST, name, details...)
+		}
+	}
+}
+
+// mirrors processAdditions
+func planAdditions(cs *cfgState, allCfg *netmaster.Config, plan *cfgPlan) {
+	for _, host := range allCfg.Hosts {
+		hostCfg, ok := cs.hosts[host.Name]
+		if !ok {
+			plan.add(PLAN_OPER_CREATE, PLAN_CONSTRUCT_HOST, host.Name)
+		} else if changes := hostChanges(&host, hostCfg); len(changes) > 0 {
+			plan.add(PLAN_OPER_UPDATE, PLAN_CONSTRUCT_HOST, host.Name, changes...)
+		}
+	}
+
+	for _, tenant := range allCfg.Tenants {
+		if _, ok := cs.tenants[tenant.Name]; !ok {
+			plan.add(PLAN_OPER_CREATE, PLAN_CONSTRUCT_TENANT, tenant.Name,
+				fmt.Sprintf("reserve vlan pool %q, vxlan pool %q, subnet pool %q",
+					tenant.Vlans, tenant.Vxlans, tenant.SubnetPool))
+		}
+
+		for _, network := range tenant.Networks {
+			if _, ok := cs.nws[network.Name]; !ok {
+				plan.add(PLAN_OPER_CREATE, PLAN_CONSTRUCT_NW, network.Name,
+					netAllocations(&tenant, &network)...)
+			}
+
+			for _, ep := range network.Endpoints {
+				epId := getEpName(&network, &ep)
+				if _, ok := cs.eps[epId]; !ok {
+					plan.add(PLAN_OPER_CREATE, PLAN_CONSTRUCT_EP, epId,
+						epAllocations(&network, &ep)...)
+				}
+			}
+		}
+	}
+}
+
+// mirrors processDeletions
+func planDeletions(cs *cfgState, allCfg *netmaster.Config, plan *cfgPlan) {
+	for _, host := range allCfg.Hosts {
+		if _, ok := cs.hosts[host.Name]; ok {
+			plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_HOST, host.Name)
+		}
+	}
+
+	for _, tenant := range allCfg.Tenants {
+		for _, network := range tenant.Networks {
+			for _, ep := range network.Endpoints {
+				epId := getEpName(&network, &ep)
+				if epCfg, ok := cs.eps[epId]; ok {
+					plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_EP, epId,
+						fmt.Sprintf("release ip %s in network %s",
+							epCfg.IpAddress, epCfg.NetId))
+				}
+			}
+
+			if len(network.Endpoints) > 0 {
+				continue
+			}
+			if nwCfg, ok := cs.nws[network.Name]; ok {
+				plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_NW, network.Name,
+					netReleases(cs.masterNws[network.Name], nwCfg)...)
+			}
+		}
+
+		if len(tenant.Networks) > 0 {
+			continue
+		}
+		if _, ok := cs.tenants[tenant.Name]; ok {
+			plan.add(PLAN_OPER_DELETE, PLAN_CONSTRUCT_TENANT, tenant.Name)
+		}
+	}
+}
+
+func computePlan(stateDriver core.StateDriver, allCfg *netmaster.Config,
+	defOpts *cliOpts) (*cfgPlan, error) {
+	cs, err := readCfgState(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &cfgPlan{}
+	if defOpts.cfgDesired {
+		planDeleteDelta(cs, allCfg, plan)
+	}
+	if defOpts.cfgDeletions {
+		planDeletions(cs, allCfg, plan)
+	} else {
+		planAdditions(cs, allCfg, plan)
+	}
+
+	return plan, nil
+}
+
+// asks the user to confirm a destructive plan; anything but an explicit 'yes'
+// is treated as a rejection
+func confirmPlan(plan *cfgPlan, in io.Reader, out io.Writer) bool {
+	plan.print(out)
+	fmt.Fprintf(out, "This plan deletes %d construct(s). "+
+		"Type 'yes' to apply it: ", plan.count(PLAN_OPER_DELETE))
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,58 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/contiv/netplugin/netmaster"
+)
+
+// a limit of zero is listed as unlimited
+func limitString(limit uint) string {
+	if limit == 0 {
+		return "-"
+	}
+	return strconv.Itoa(int(limit))
+}
+
+func renderQuotas(quotas []netmaster.QuotaUsage, w io.Writer, format string) error {
+	result := &listResult{columns: []string{"RESOURCE", "USED", "LIMIT"}}
+	for _, quota := range quotas {
+		result.add(quota, quota.Resource, strconv.Itoa(int(quota.Used)),
+			limitString(quota.Limit))
+	}
+
+	return result.render(w, format)
+}
+
+func tenantQuotas(defOpts *cliOpts, w io.Writer) error {
+	stateDriver, err := initEtcd(defOpts)
+	if err != nil {
+		log.Fatalf("Failed to init etcd driver. Error: %s", err)
+	}
+
+	quotas, err := netmaster.GetTenantQuotas(stateDriver, defOpts.tenant)
+	if err != nil {
+		log.Printf("error '%s' getting the quotas of tenant %s \n", err,
+			defOpts.tenant)
+		return err
+	}
+
+	return renderQuotas(quotas, w, defOpts.output)
+}
@@ -0,0 +1,69 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/netmaster"
+)
+
+// the allocated values are listed as value(owner), or just the value when the
+// owner isn't known
+func allocatedString(values []core.AllocatedValue) string {
+	strs := []string{}
+	for _, val := range values {
+		if val.Owner == "" {
+			strs = append(strs, val.Value)
+		} else {
+			strs = append(strs, fmt.Sprintf("%s(%s)", val.Value, val.Owner))
+		}
+	}
+	return strings.Join(strs, ",")
+}
+
+func renderUsage(usages []core.ResourceUsage, w io.Writer, format string) error {
+	result := &listResult{columns: []string{"RESOURCE", "ID", "CAPACITY",
+		"USED", "FREE", "ALLOCATED"}}
+	for _, usage := range usages {
+		result.add(usage, usage.Description, usage.Id,
+			strconv.Itoa(int(usage.Capacity)), strconv.Itoa(int(usage.Used)),
+			strconv.Itoa(int(usage.Free)), allocatedString(usage.Allocated))
+	}
+
+	return result.render(w, format)
+}
+
+func tenantUsage(defOpts *cliOpts, w io.Writer) error {
+	stateDriver, err := initEtcd(defOpts)
+	if err != nil {
+		log.Fatalf("Failed to init etcd driver. Error: %s", err)
+	}
+
+	usages, err := netmaster.GetTenantUsage(stateDriver, defOpts.tenant)
+	if err != nil {
+		log.Printf("error '%s' getting the usage of tenant %s \n", err,
+			defOpts.tenant)
+		return err
+	}
+
+	return renderUsage(usages, w, defOpts.output)
+}
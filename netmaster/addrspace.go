@@ -0,0 +1,266 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netutils"
+)
+
+// index of the ip address space used by the tenants' subnet pools and the
+// networks' subnets. All the tenants share a single address space, except
+// the ones marked as isolated vrf which get an address space of their own.
+// A subnet is rejected if it overlaps another subnet of the same address
+// space; the only exception being the subnets allocated from a tenant's pool,
+// which are contained in the pool by construction. A static subnet that is
+// one of the pool's subnets, e.g. a pinned one, is reserved out of the pool
+// and indexed as allocated from it.
+
+const (
+	POOL_OWNER = "subnet pool"
+)
+
+type addrSpaceSubnet struct {
+	tenant string
+	// describes the subnet's user in the conflict errors
+	owner    string
+	ipNet    *net.IPNet
+	isolated bool
+	// auto-allocated from the tenant's subnet pool
+	fromPool bool
+	isPool   bool
+}
+
+type addrSpace struct {
+	subnets []addrSpaceSubnet
+}
+
+func netsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func (s *addrSpaceSubnet) conflicts(other *addrSpaceSubnet) bool {
+	if s.tenant != other.tenant && (s.isolated || other.isolated) {
+		return false
+	}
+	if s.tenant == other.tenant &&
+		((s.fromPool && other.isPool) || (s.isPool && other.fromPool)) {
+		return false
+	}
+	return netsOverlap(s.ipNet, other.ipNet)
+}
+
+func newAddrSpaceSubnet(tenant, owner, cidr string, isolated bool) (*addrSpaceSubnet, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return &addrSpaceSubnet{tenant: tenant, owner: owner, ipNet: ipNet,
+		isolated: isolated}, nil
+}
+
+// check returns an error describing the first subnet that the passed subnet
+// conflicts with
+func (as *addrSpace) check(subnet *addrSpaceSubnet) error {
+	for _, other := range as.subnets {
+		if subnet.conflicts(&other) {
+			return &core.Error{Desc: fmt.Sprintf(
+				"%s %s of tenant %s overlaps %s %s of tenant %s",
+				subnet.owner, subnet.ipNet, subnet.tenant,
+				other.owner, other.ipNet, other.tenant)}
+		}
+	}
+	return nil
+}
+
+func (as *addrSpace) add(subnet *addrSpaceSubnet) error {
+	err := as.check(subnet)
+	if err != nil {
+		return err
+	}
+	as.subnets = append(as.subnets, *subnet)
+	return nil
+}
+
+// removePool drops a tenant's pool from the index, to check the tenant's
+// resized pool in its place
+func (as *addrSpace) removePool(tenant string) {
+	subnets := as.subnets[:0]
+	for _, subnet := range as.subnets {
+		if !subnet.isPool || subnet.tenant != tenant {
+			subnets = append(subnets, subnet)
+		}
+	}
+	as.subnets = subnets
+}
+
+func netOwner(netId string) string {
+	return fmt.Sprintf("subnet of network %s", netId)
+}
+
+// readAddrSpace builds the index of the address space in use from the state
+func readAddrSpace(stateDriver core.StateDriver) (*addrSpace, error) {
+	as := &addrSpace{}
+	isolated := make(map[string]bool)
+	tenants := make(map[string]*gstate.Cfg)
+
+	readGlbl := &gstate.Cfg{}
+	readGlbl.StateDriver = stateDriver
+	gCfgs, err := readAllOrNone(readGlbl)
+	if err != nil {
+		return nil, err
+	}
+	for _, gCfg := range gCfgs {
+		cfg := gCfg.(*gstate.Cfg)
+		isolated[cfg.Tenant] = cfg.Deploy.IsolatedVrf
+		tenants[cfg.Tenant] = cfg
+		if cfg.Auto.SubnetPool == "" {
+			continue
+		}
+		subnet, err := newAddrSpaceSubnet(cfg.Tenant, POOL_OWNER,
+			fmt.Sprintf("%s/%d", cfg.Auto.SubnetPool, cfg.Auto.SubnetLen),
+			cfg.Deploy.IsolatedVrf)
+		if err != nil {
+			return nil, err
+		}
+		subnet.isPool = true
+		as.subnets = append(as.subnets, *subnet)
+	}
+
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = stateDriver
+	nwCfgs, err := readAllOrNone(readNet)
+	if err != nil {
+		return nil, err
+	}
+	for _, nwCfg := range nwCfgs {
+		cfg := nwCfg.(*drivers.OvsCfgNetworkState)
+		if cfg.SubnetIp == "" {
+			continue
+		}
+		subnet, err := newAddrSpaceSubnet(cfg.Tenant, netOwner(cfg.Id),
+			fmt.Sprintf("%s/%d", cfg.SubnetIp, cfg.SubnetLen),
+			isolated[cfg.Tenant])
+		if err != nil {
+			log.Printf("error '%s' indexing subnet of network %s \n",
+				err, cfg.Id)
+			continue
+		}
+		nwMasterCfg := &MasterNwConfig{}
+		nwMasterCfg.StateDriver = stateDriver
+		if nwMasterCfg.Read(cfg.Id) == nil && nwMasterCfg.SubnetIp == "" {
+			subnet.fromPool = true
+		} else if gCfg, ok := tenants[cfg.Tenant]; ok {
+			subnet.fromPool = gCfg.SubnetInPool(cfg.SubnetIp, cfg.SubnetLen)
+		}
+		as.subnets = append(as.subnets, *subnet)
+
+		// the subnets a network grew by always come from the pool
+		for _, extraSubnet := range cfg.ExtraSubnets {
+			subnet, err = newAddrSpaceSubnet(cfg.Tenant, netOwner(cfg.Id),
+				extraSubnet, isolated[cfg.Tenant])
+			if err != nil {
+				log.Printf("error '%s' indexing subnet %s of network %s \n",
+					err, extraSubnet, cfg.Id)
+				continue
+			}
+			subnet.fromPool = true
+			as.subnets = append(as.subnets, *subnet)
+		}
+	}
+
+	return as, nil
+}
+
+func tenantPoolSubnet(tenant *ConfigTenant) (*addrSpaceSubnet, error) {
+	if tenant.SubnetPool == "" {
+		return nil, nil
+	}
+	subnet, err := newAddrSpaceSubnet(tenant.Name, POOL_OWNER,
+		tenant.SubnetPool, tenant.IsolatedVrf)
+	if err != nil {
+		return nil, err
+	}
+	subnet.isPool = true
+	return subnet, nil
+}
+
+func networkSubnet(tenantName string, isolated bool,
+	network *ConfigNetwork) (*addrSpaceSubnet, error) {
+	if network.SubnetCIDR == "" {
+		return nil, nil
+	}
+	return newAddrSpaceSubnet(tenantName, netOwner(network.Name),
+		network.SubnetCIDR, isolated)
+}
+
+// subnetInTenantPool tells if a static subnet is one of the subnets allocated
+// out of the tenant's subnet pool
+func subnetInTenantPool(tenant *ConfigTenant, cidr string) bool {
+	poolIp, poolLen, err := netutils.ParseCIDR(tenant.SubnetPool)
+	if err != nil {
+		return false
+	}
+	subnetIp, subnetLen, err := netutils.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	gCfg := &gstate.Cfg{Auto: gstate.AutoParams{SubnetPool: poolIp,
+		SubnetLen: poolLen, AllocSubnetLen: tenant.AllocSubnetLen}}
+	return gCfg.SubnetInPool(subnetIp, subnetLen)
+}
+
+// validateAddrSpace checks the pools and static subnets of a configuration
+// for overlaps amongst themselves
+func validateAddrSpace(cfg *Config) error {
+	as := &addrSpace{}
+
+	for _, tenant := range cfg.Tenants {
+		subnet, err := tenantPoolSubnet(&tenant)
+		if err != nil {
+			return err
+		}
+		if subnet != nil {
+			if err = as.add(subnet); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, tenant := range cfg.Tenants {
+		for _, network := range tenant.Networks {
+			subnet, err := networkSubnet(tenant.Name, tenant.IsolatedVrf, &network)
+			if err != nil {
+				return err
+			}
+			if subnet != nil {
+				subnet.fromPool = subnetInTenantPool(&tenant,
+					network.SubnetCIDR)
+				if err = as.add(subnet); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+)
+
+func newTestTenant(name, subnetPool string, isolated bool) *ConfigTenant {
+	return &ConfigTenant{Name: name, DefaultNetType: "vlan",
+		SubnetPool: subnetPool, AllocSubnetLen: 24, Vlans: "11-28",
+		IsolatedVrf: isolated}
+}
+
+func TestOverlappingTenantPools(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	err := CreateTenant(fakeDriver, newTestTenant("tenant-one", "11.1.0.0/16", false))
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	err = CreateTenant(fakeDriver, newTestTenant("tenant-two", "11.1.128.0/17", false))
+	if err == nil || !strings.Contains(err.Error(), "overlaps") {
+		t.Fatalf("overlapping subnet pool accepted, err '%v' \n", err)
+	}
+
+	err = CreateTenant(fakeDriver, newTestTenant("tenant-three", "11.0.0.0/8", false))
+	if err == nil {
+		t.Fatalf("subnet pool containing another tenant's pool accepted \n")
+	}
+
+	err = CreateTenant(fakeDriver, newTestTenant("tenant-four", "11.2.0.0/16", false))
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant with a disjoint pool \n", err)
+	}
+}
+
+func TestOverlappingIsolatedVrfTenants(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	err := CreateTenant(fakeDriver, newTestTenant("tenant-one", "11.1.0.0/16", false))
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	tenant := newTestTenant("tenant-two", "11.1.0.0/16", true)
+	err = CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating isolated vrf tenant \n", err)
+	}
+
+	// within its vrf the subnets must still be unique
+	tenant.Networks = []ConfigNetwork{
+		{Name: "orange", SubnetCIDR: "12.1.1.0/24"},
+		{Name: "purple", SubnetCIDR: "12.1.1.128/25"},
+	}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err == nil || !strings.Contains(err.Error(), "network orange") {
+		t.Fatalf("overlapping subnets within a vrf accepted, err '%v' \n", err)
+	}
+}
+
+func TestOverlappingNetworkSubnets(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenantOne := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenantTwo := newTestTenant("tenant-two", "11.2.0.0/16", false)
+	for _, tenant := range []*ConfigTenant{tenantOne, tenantTwo} {
+		err := CreateTenant(fakeDriver, tenant)
+		if err != nil {
+			t.Fatalf("error '%s' creating tenant \n", err)
+		}
+	}
+
+	// auto-allocated subnets come from the tenant's own pool
+	tenantOne.Networks = []ConfigNetwork{{Name: "orange"}, {Name: "purple"}}
+	err := CreateNetworks(fakeDriver, tenantOne)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	// static subnet in another tenant's pool
+	tenantTwo.Networks = []ConfigNetwork{{Name: "green", SubnetCIDR: "11.1.5.0/24"}}
+	err = CreateNetworks(fakeDriver, tenantTwo)
+	if err == nil || !strings.Contains(err.Error(), "subnet pool") {
+		t.Fatalf("subnet in another tenant's pool accepted, err '%v' \n", err)
+	}
+
+	// static subnet in the tenant's own pool collides with auto-allocation,
+	// unless it is one
+	// of the pool's subnets and not in use
+	for _, static := range []struct {
+		tenant *ConfigTenant
+		cidr   string
+	}{{tenantTwo, "11.2.5.0/25"}, {tenantOne, "11.1.0.0/24"}} {
+		static.tenant.Networks = []ConfigNetwork{{Name: "green",
+			SubnetCIDR: static.cidr}}
+		err = CreateNetworks(fakeDriver, static.tenant)
+		if err == nil {
+			t.Fatalf("static subnet %s in the tenant's own pool accepted \n",
+				static.cidr)
+		}
+	}
+	tenantOne.Networks = []ConfigNetwork{{Name: "green",
+		SubnetCIDR: "11.1.2.0/24"}, {Name: "blue"}}
+	err = CreateNetworks(fakeDriver, tenantOne)
+	if err != nil {
+		t.Fatalf("error '%s' creating network with a subnet of the pool \n",
+			err)
+	}
+	nwCfg := &drivers.OvsCfgNetworkState{}
+	nwCfg.StateDriver = fakeDriver
+	err = nwCfg.Read("blue")
+	if err != nil || nwCfg.SubnetIp != "11.1.3.0" {
+		t.Fatalf("error '%v' reading network, got %+v, expected the subnet "+
+			"of the pool to be reserved \n", err, nwCfg)
+	}
+
+	tenantTwo.Networks = []ConfigNetwork{{Name: "green", SubnetCIDR: "12.1.1.0/24"}}
+	err = CreateNetworks(fakeDriver, tenantTwo)
+	if err != nil {
+		t.Fatalf("error '%s' creating network with a disjoint subnet \n", err)
+	}
+}
+
+func TestValidateConfigOverlaps(t *testing.T) {
+	cfg := &Config{Tenants: []ConfigTenant{
+		*newTestTenant("tenant-one", "11.1.0.0/16", false),
+		*newTestTenant("tenant-two", "11.1.0.0/16", false),
+	}}
+	err := ValidateConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "tenant-one") {
+		t.Fatalf("overlapping pools passed validation, err '%v' \n", err)
+	}
+
+	cfg.Tenants[1].IsolatedVrf = true
+	err = ValidateConfig(cfg)
+	if err != nil {
+		t.Fatalf("error '%s' validating overlapping isolated vrf pools \n", err)
+	}
+
+	cfg.Tenants[0].Networks = []ConfigNetwork{{Name: "orange",
+		SubnetCIDR: "12.1.1.0/24"}}
+	cfg.Tenants[1].Networks = []ConfigNetwork{{Name: "purple",
+		SubnetCIDR: "12.1.0.0/16"}}
+	err = ValidateConfig(cfg)
+	if err != nil {
+		t.Fatalf("error '%s' validating overlapping subnets in distinct vrfs \n", err)
+	}
+
+	cfg.Tenants[1].IsolatedVrf = false
+	cfg.Tenants[1].SubnetPool = "11.2.0.0/16"
+	err = ValidateConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "network purple") {
+		t.Fatalf("overlapping subnets passed validation, err '%v' \n", err)
+	}
+}
@@ -0,0 +1,430 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/contiv/netplugin/resources"
+	"github.com/jainvipin/bitset"
+)
+
+// audit of the allocated resources. The values marked in use by the tenants'
+// vlan, vxlan and subnet resources and by the networks' ip resources are
+// cross-referenced with the values used by the network and endpoint states:
+// - a value in use that no state uses is leaked, e.g. when netmaster stops
+//   between allocating a vlan and writing the network.
+// - a value used by a state that is marked free can be handed out again.
+// - a value used by more than one state is allocated twice.
+// The first two are repaired by rewriting the resource's free values from the
+// states; a double allocation needs an operator to pick the owner, so it is
+// only reported. Values used by the states outside the auto-allocation ranges,
+// like static vlans, aren't tracked by the resources and are ignored.
+
+const (
+	AUDIT_LEAKED   = "leaked"
+	AUDIT_UNMARKED = "in use but free"
+	AUDIT_DOUBLE   = "allocated twice"
+)
+
+type AuditFinding struct {
+	Tenant   string `json:"tenant"`
+	Resource string `json:"resource"`
+	// id of the resource, the tenant or the network
+	ResourceId string   `json:"resourceId"`
+	Value      string   `json:"value"`
+	Problem    string   `json:"problem"`
+	UsedBy     []string `json:"usedBy,omitempty"`
+	Repaired   bool     `json:"repaired"`
+}
+
+type AuditReport struct {
+	Findings []AuditFinding `json:"findings"`
+}
+
+// users of the values of a resource, by the value's bit in the resource
+type bitUsers map[uint][]string
+
+func (u bitUsers) add(bit uint, user string) {
+	u[bit] = append(u[bit], user)
+}
+
+// auditBits compares the free bits of a resource with the bits used by the
+// states. It returns the free bits expected from the states and whether they
+// differ from the resource's.
+func (rep *AuditReport) auditBits(finding AuditFinding, pool, free *bitset.BitSet,
+	users bitUsers, bitValue func(uint) string) (*bitset.BitSet, bool) {
+	expFree := pool.Clone()
+	for bit := range users {
+		expFree.Clear(bit)
+	}
+
+	changed := false
+	for bit, ok := pool.NextSet(0); ok; bit, ok = pool.NextSet(bit + 1) {
+		f := finding
+		f.Value = bitValue(bit)
+		f.UsedBy = users[bit]
+		switch {
+		case !free.Test(bit) && expFree.Test(bit):
+			f.Problem = AUDIT_LEAKED
+		case free.Test(bit) && !expFree.Test(bit):
+			f.Problem = AUDIT_UNMARKED
+		default:
+			continue
+		}
+		changed = true
+		rep.Findings = append(rep.Findings, f)
+	}
+
+	bits := []int{}
+	for bit, owners := range users {
+		if len(owners) > 1 && pool.Test(bit) {
+			bits = append(bits, int(bit))
+		}
+	}
+	sort.Ints(bits)
+	for _, bit := range bits {
+		f := finding
+		f.Value = bitValue(uint(bit))
+		f.UsedBy = users[uint(bit)]
+		f.Problem = AUDIT_DOUBLE
+		rep.Findings = append(rep.Findings, f)
+	}
+
+	return expFree, changed
+}
+
+// markRepaired marks the repairable findings from 'start' on as repaired
+func (rep *AuditReport) markRepaired(start int) {
+	for i := start; i < len(rep.Findings); i++ {
+		if rep.Findings[i].Problem != AUDIT_DOUBLE {
+			rep.Findings[i].Repaired = true
+		}
+	}
+}
+
+func tagValue(base uint) func(uint) string {
+	return func(bit uint) string {
+		return fmt.Sprintf("%d", bit+base)
+	}
+}
+
+func auditVlans(stateDriver core.StateDriver, gCfg *gstate.Cfg,
+	nwCfgs []*drivers.OvsCfgNetworkState, repair bool, rep *AuditReport) error {
+	rsrc := &resources.AutoVlanCfgResource{}
+	rsrc.StateDriver = stateDriver
+	err := rsrc.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+	oper := &resources.AutoVlanOperResource{}
+	oper.StateDriver = stateDriver
+	err = oper.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+
+	users := bitUsers{}
+	for _, nwCfg := range nwCfgs {
+		if nwCfg.PktTagType == "vlan" && nwCfg.PktTag > 0 {
+			users.add(uint(nwCfg.PktTag), nwCfg.Id)
+		}
+	}
+
+	start := len(rep.Findings)
+	expFree, changed := rep.auditBits(AuditFinding{Tenant: gCfg.Tenant,
+		Resource: resources.AUTO_VLAN_RSRC, ResourceId: gCfg.Tenant},
+		rsrc.Vlans, oper.FreeVlans, users, tagValue(0))
+	if !changed || !repair {
+		return nil
+	}
+
+	oper.FreeVlans = expFree
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+	rep.markRepaired(start)
+	return nil
+}
+
+func auditVxlans(stateDriver core.StateDriver, gCfg *gstate.Cfg,
+	nwCfgs []*drivers.OvsCfgNetworkState, repair bool, rep *AuditReport) error {
+	rsrc := &resources.AutoVxlanCfgResource{}
+	rsrc.StateDriver = stateDriver
+	err := rsrc.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+	oper := &resources.AutoVxlanOperResource{}
+	oper.StateDriver = stateDriver
+	err = oper.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+	gOper := &gstate.Oper{}
+	gOper.StateDriver = stateDriver
+	err = gOper.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+
+	vxlanUsers := bitUsers{}
+	vlanUsers := bitUsers{}
+	for _, nwCfg := range nwCfgs {
+		if nwCfg.PktTagType != "vxlan" {
+			continue
+		}
+		if uint(nwCfg.ExtPktTag) >= gOper.FreeVxlansStart {
+			vxlanUsers.add(uint(nwCfg.ExtPktTag)-gOper.FreeVxlansStart, nwCfg.Id)
+		}
+		if nwCfg.PktTag > 0 {
+			vlanUsers.add(uint(nwCfg.PktTag), nwCfg.Id)
+		}
+	}
+
+	start := len(rep.Findings)
+	finding := AuditFinding{Tenant: gCfg.Tenant,
+		Resource: resources.AUTO_VXLAN_RSRC, ResourceId: gCfg.Tenant}
+	expFreeVxlans, vxlansChanged := rep.auditBits(finding, rsrc.Vxlans,
+		oper.FreeVxlans, vxlanUsers, tagValue(gOper.FreeVxlansStart))
+	finding.Resource = resources.AUTO_VXLAN_RSRC + " local vlan"
+	expFreeVlans, vlansChanged := rep.auditBits(finding, rsrc.LocalVlans,
+		oper.FreeLocalVlans, vlanUsers, tagValue(0))
+	if !(vxlansChanged || vlansChanged) || !repair {
+		return nil
+	}
+
+	oper.FreeVxlans = expFreeVxlans
+	oper.FreeLocalVlans = expFreeVlans
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+	rep.markRepaired(start)
+	return nil
+}
+
+func auditSubnets(stateDriver core.StateDriver, gCfg *gstate.Cfg,
+	nwCfgs []*drivers.OvsCfgNetworkState, repair bool, rep *AuditReport) error {
+	rsrc := &resources.AutoSubnetCfgResource{}
+	rsrc.StateDriver = stateDriver
+	err := rsrc.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+	oper := &resources.AutoSubnetOperResource{}
+	oper.StateDriver = stateDriver
+	err = oper.Read(gCfg.Tenant)
+	if err != nil {
+		return err
+	}
+
+	// static subnets in the pool are reserved out of it, so the networks'
+	// subnets in the pool, including the ones they grew by, are the allocated
+	// ones
+	users := bitUsers{}
+	for _, nwCfg := range nwCfgs {
+		for _, cidr := range nwCfg.Subnets() {
+			subnetIp, subnetLen, err := netutils.ParseCIDR(cidr)
+			if err != nil || subnetLen != rsrc.AllocSubnetLen {
+				continue
+			}
+			subnet, err := netutils.GetIpNumber(rsrc.SubnetPool.String(),
+				rsrc.SubnetPoolLen, rsrc.AllocSubnetLen, subnetIp)
+			if err == nil {
+				users.add(subnet, nwCfg.Id)
+			}
+		}
+	}
+
+	pool := netutils.CreateBitset(rsrc.AllocSubnetLen - rsrc.SubnetPoolLen).Complement()
+	start := len(rep.Findings)
+	expFree, changed := rep.auditBits(AuditFinding{Tenant: gCfg.Tenant,
+		Resource: resources.AUTO_SUBNET_RSRC, ResourceId: gCfg.Tenant},
+		pool, oper.FreeSubnets, users, func(bit uint) string {
+			subnetIp, _ := netutils.GetSubnetIp(rsrc.SubnetPool.String(),
+				rsrc.SubnetPoolLen, rsrc.AllocSubnetLen, bit)
+			return fmt.Sprintf("%s/%d", subnetIp, rsrc.AllocSubnetLen)
+		})
+	if !changed || !repair {
+		return nil
+	}
+
+	oper.FreeSubnets = expFree
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+	rep.markRepaired(start)
+	return nil
+}
+
+// auditEpIps audits the ip resource of one of the network's subnets against
+// the addresses of the network's endpoints
+func auditEpIps(stateDriver core.StateDriver, nwCfg *drivers.OvsCfgNetworkState,
+	rsrcId string, epCfgs []*drivers.OvsCfgEndpointState, repair bool,
+	rep *AuditReport) error {
+	rsrc := &resources.AutoIpCfgResource{}
+	rsrc.StateDriver = stateDriver
+	err := rsrc.Read(rsrcId)
+	if err != nil {
+		// networks created before the ip resource have nothing to audit
+		if core.ErrIfKeyExists(err) != nil {
+			return err
+		}
+		return nil
+	}
+	oper := &resources.AutoIpOperResource{}
+	oper.StateDriver = stateDriver
+	err = oper.Read(rsrcId)
+	if err != nil {
+		return err
+	}
+
+	users := bitUsers{}
+	for _, epCfg := range epCfgs {
+		if epCfg.NetId != nwCfg.Id || epCfg.IpAddress == "" {
+			continue
+		}
+		for _, ipAddress := range append([]string{epCfg.IpAddress},
+			epCfg.SecondaryIps...) {
+			hostId, err := netutils.GetIpNumber(rsrc.SubnetIp.String(),
+				rsrc.SubnetLen, 32, ipAddress)
+			if err == nil && !rsrc.Reserved.Test(hostId) {
+				users.add(hostId, epCfg.Id)
+			}
+		}
+	}
+
+	// the reserved addresses are never free
+	pool := netutils.CreateBitset(32 - rsrc.SubnetLen).Complement()
+	for hostId, ok := rsrc.Reserved.NextSet(0); ok; hostId, ok = rsrc.Reserved.NextSet(hostId + 1) {
+		pool.Clear(hostId)
+	}
+	start := len(rep.Findings)
+	expFree, changed := rep.auditBits(AuditFinding{Tenant: nwCfg.Tenant,
+		Resource: resources.AUTO_IP_RSRC, ResourceId: rsrcId},
+		pool, oper.FreeIps, users, func(hostId uint) string {
+			ip, _ := netutils.GetSubnetIp(rsrc.SubnetIp.String(),
+				rsrc.SubnetLen, 32, hostId)
+			return ip
+		})
+	if !changed || !repair {
+		return nil
+	}
+
+	oper.FreeIps = expFree
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+	rep.markRepaired(start)
+	return nil
+}
+
+// AuditResources reports the leaked, the unmarked and the doubly allocated
+// values of the tenants' and the networks' resources, and repairs the first
+// two when asked to
+func AuditResources(stateDriver core.StateDriver, repair bool) (*AuditReport, error) {
+	if repair {
+		if err := checkLeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = stateDriver
+	states, err := readAllOrNone(readNet)
+	if err != nil {
+		return nil, err
+	}
+	tenantNets := make(map[string][]*drivers.OvsCfgNetworkState)
+	nwCfgs := []*drivers.OvsCfgNetworkState{}
+	for _, state := range states {
+		nwCfg := state.(*drivers.OvsCfgNetworkState)
+		tenantNets[nwCfg.Tenant] = append(tenantNets[nwCfg.Tenant], nwCfg)
+		nwCfgs = append(nwCfgs, nwCfg)
+	}
+
+	readEp := &drivers.OvsCfgEndpointState{}
+	readEp.StateDriver = stateDriver
+	states, err = readAllOrNone(readEp)
+	if err != nil {
+		return nil, err
+	}
+	epCfgs := []*drivers.OvsCfgEndpointState{}
+	for _, state := range states {
+		epCfgs = append(epCfgs, state.(*drivers.OvsCfgEndpointState))
+	}
+
+	readGlbl := &gstate.Cfg{}
+	readGlbl.StateDriver = stateDriver
+	states, err = readAllOrNone(readGlbl)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &AuditReport{Findings: []AuditFinding{}}
+	for _, state := range states {
+		gCfg := state.(*gstate.Cfg)
+		nets := tenantNets[gCfg.Tenant]
+		if gCfg.Auto.Vlans != "" {
+			err = auditVlans(stateDriver, gCfg, nets, repair, rep)
+			if err != nil {
+				log.Printf("error '%s' auditing vlans of tenant %s \n",
+					err, gCfg.Tenant)
+				return nil, err
+			}
+		}
+		if gCfg.Auto.Vxlans != "" {
+			err = auditVxlans(stateDriver, gCfg, nets, repair, rep)
+			if err != nil {
+				log.Printf("error '%s' auditing vxlans of tenant %s \n",
+					err, gCfg.Tenant)
+				return nil, err
+			}
+		}
+		if net.ParseIP(gCfg.Auto.SubnetPool) != nil {
+			err = auditSubnets(stateDriver, gCfg, nets, repair, rep)
+			if err != nil {
+				log.Printf("error '%s' auditing subnets of tenant %s \n",
+					err, gCfg.Tenant)
+				return nil, err
+			}
+		}
+	}
+
+	for _, nwCfg := range nwCfgs {
+		for _, rsrcId := range netIpRsrcIds(nwCfg) {
+			err = auditEpIps(stateDriver, nwCfg, rsrcId, epCfgs, repair, rep)
+			if err != nil {
+				log.Printf("error '%s' auditing ips %s of network %s \n",
+					err, rsrcId, nwCfg.Id)
+				return nil, err
+			}
+		}
+	}
+
+	return rep, nil
+}
@@ -0,0 +1,108 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"testing"
+
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/resources"
+)
+
+func verifyAuditFindings(t *testing.T, rep *AuditReport, repaired bool,
+	expFindings []AuditFinding) {
+	if len(rep.Findings) != len(expFindings) {
+		t.Fatalf("audit found %+v, expected %+v \n", rep.Findings, expFindings)
+	}
+	for i, f := range rep.Findings {
+		exp := expFindings[i]
+		if f.Resource != exp.Resource || f.Value != exp.Value ||
+			f.Problem != exp.Problem || f.Repaired != repaired {
+			t.Fatalf("audit found %+v, expected %+v repaired %v \n",
+				f, exp, repaired)
+		}
+	}
+}
+
+func TestAuditResources(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}, {Name: "purple"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	_, err = createTestEp(tenant, "myContainer1", "")
+	if err != nil {
+		t.Fatalf("error '%s' creating ep \n", err)
+	}
+
+	// leak a vlan and an ip, and free the vlan of a network
+	ra := &resources.EtcdResourceManager{Etcd: fakeDriver}
+	gCfg := &gstate.Cfg{}
+	gCfg.StateDriver = fakeDriver
+	err = gCfg.Read(tenant.Name)
+	if err != nil {
+		t.Fatalf("error '%s' reading tenant cfg \n", err)
+	}
+	_, err = gCfg.AllocVlan(ra, "")
+	if err != nil {
+		t.Fatalf("error '%s' allocating vlan \n", err)
+	}
+	err = gCfg.FreeVlan(ra, 12)
+	if err != nil {
+		t.Fatalf("error '%s' freeing vlan \n", err)
+	}
+	_, err = ra.AllocateResourceVal("orange", resources.AUTO_IP_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating ip \n", err)
+	}
+
+	expFindings := []AuditFinding{
+		{Resource: resources.AUTO_VLAN_RSRC, Value: "12", Problem: AUDIT_UNMARKED},
+		{Resource: resources.AUTO_VLAN_RSRC, Value: "13", Problem: AUDIT_LEAKED},
+		{Resource: resources.AUTO_IP_RSRC, Value: "11.1.0.2", Problem: AUDIT_LEAKED},
+	}
+	rep, err := AuditResources(fakeDriver, false)
+	if err != nil {
+		t.Fatalf("error '%s' auditing resources \n", err)
+	}
+	verifyAuditFindings(t, rep, false, expFindings)
+
+	rep, err = AuditResources(fakeDriver, true)
+	if err != nil {
+		t.Fatalf("error '%s' repairing resources \n", err)
+	}
+	verifyAuditFindings(t, rep, true, expFindings)
+
+	rep, err = AuditResources(fakeDriver, false)
+	if err != nil {
+		t.Fatalf("error '%s' auditing repaired resources \n", err)
+	}
+	verifyAuditFindings(t, rep, false, []AuditFinding{})
+
+	// the leaked vlan is allocated again
+	vlan, err := gCfg.AllocVlan(ra, "")
+	if err != nil || vlan != 13 {
+		t.Fatalf("error '%v' allocating vlan, allocated %d expected 13 \n",
+			err, vlan)
+	}
+}
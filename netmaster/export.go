@@ -0,0 +1,258 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+)
+
+// reconstruction of the intent from the state, in the form accepted by
+// netdcli -cfg, so that it can be versioned, diffed and restored
+
+func readAllOrNone(st core.State) ([]core.State, error) {
+	states, err := st.ReadAll()
+	if core.ErrIfKeyExists(err) != nil {
+		return nil, err
+	} else if err != nil {
+		states = []core.State{}
+	}
+	return states, nil
+}
+
+func exportHosts(stateDriver core.StateDriver) ([]ConfigHost, error) {
+	readHost := &MasterHostConfig{}
+	readHost.StateDriver = stateDriver
+	hostCfgs, err := readAllOrNone(readHost)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := []ConfigHost{}
+	for _, hostCfg := range hostCfgs {
+		cfg := hostCfg.(*MasterHostConfig)
+		hosts = append(hosts, ConfigHost{Name: cfg.Name, Intf: cfg.Intf,
+			VtepIp: cfg.VtepIp, NetId: cfg.NetId})
+	}
+	sort.Sort(hostsByName(hosts))
+
+	return hosts, nil
+}
+
+// exportEndpoints exports the endpoints of a network. Only the addresses of
+// the network's first subnet can be pinned, the ones of the subnets the
+// network grew by are allocated again.
+func exportEndpoints(epCfgs []core.State, nwCfg *drivers.OvsCfgNetworkState,
+	netId string, pinAuto bool) []ConfigEp {
+	inFirstSubnet := func(ipAddress string) bool {
+		rsrcId, err := ipRsrcIdOf(nwCfg, ipAddress)
+		return err == nil && rsrcId == nwCfg.Id
+	}
+
+	eps := []ConfigEp{}
+	for _, epCfg := range epCfgs {
+		cfg := epCfg.(*drivers.OvsCfgEndpointState)
+		// vtep and infra interface eps are derived from the host config
+		if cfg.NetId != netId || cfg.ContName == "" {
+			continue
+		}
+
+		ep := ConfigEp{Container: cfg.ContName, Host: cfg.HomingHost,
+			AttachUUID: cfg.AttachUUID, PublishedPorts: cfg.PublishedPorts}
+		if pinAuto && inFirstSubnet(cfg.IpAddress) {
+			ep.IpAddress = cfg.IpAddress
+		}
+		for _, ipAddress := range cfg.SecondaryIps {
+			if pinAuto && inFirstSubnet(ipAddress) {
+				ep.SecondaryIps = append(ep.SecondaryIps, ipAddress)
+			} else {
+				ep.SecondaryIpCount++
+			}
+		}
+		eps = append(eps, ep)
+	}
+	sort.Sort(epsByContainer(eps))
+
+	return eps
+}
+
+func exportNetwork(nwMasterCfg *MasterNwConfig, nwCfg *drivers.OvsCfgNetworkState,
+	epCfgs []core.State, pinAuto bool) ConfigNetwork {
+	network := ConfigNetwork{Name: nwMasterCfg.Id,
+		PktTagType:       nwMasterCfg.PktTagType,
+		PktTag:           nwMasterCfg.PktTag,
+		LocalVlan:        nwMasterCfg.LocalVlan,
+		DefaultGw:        nwMasterCfg.DefaultGw,
+		OutboundNat:      nwMasterCfg.OutboundNat,
+		ReservedIps:      nwMasterCfg.ReservedIps,
+		ExcludedIpRanges: nwMasterCfg.ExcludedIpRanges,
+		IpAllocStart:     nwMasterCfg.IpAllocStart,
+		IpAllocEnd:       nwMasterCfg.IpAllocEnd}
+
+	if nwMasterCfg.SubnetIp != "" {
+		network.SubnetCIDR = fmt.Sprintf("%s/%d", nwMasterCfg.SubnetIp,
+			nwMasterCfg.SubnetLen)
+	}
+
+	if pinAuto {
+		network.PktTagType = nwCfg.PktTagType
+		if network.PktTag == "" && nwCfg.PktTagType == "vlan" {
+			network.PktTag = strconv.Itoa(nwCfg.PktTag)
+		} else if nwCfg.PktTagType == "vxlan" {
+			if network.PktTag == "" {
+				network.PktTag = strconv.Itoa(nwCfg.ExtPktTag)
+			}
+			// the host-local vlans are picked by the hosts again
+			if network.LocalVlan == "" && nwCfg.PktTag != 0 {
+				network.LocalVlan = strconv.Itoa(nwCfg.PktTag)
+			}
+		}
+		if network.SubnetCIDR == "" {
+			network.SubnetCIDR = fmt.Sprintf("%s/%d", nwCfg.SubnetIp,
+				nwCfg.SubnetLen)
+		}
+	}
+
+	network.Endpoints = exportEndpoints(epCfgs, nwCfg, network.Name, pinAuto)
+
+	return network
+}
+
+func exportTenants(stateDriver core.StateDriver, pinAuto bool) ([]ConfigTenant, error) {
+	readGlbl := &gstate.Cfg{}
+	readGlbl.StateDriver = stateDriver
+	gCfgs, err := readAllOrNone(readGlbl)
+	if err != nil {
+		return nil, err
+	}
+
+	readMasterNet := &MasterNwConfig{}
+	readMasterNet.StateDriver = stateDriver
+	nwMasterCfgs, err := readAllOrNone(readMasterNet)
+	if err != nil {
+		return nil, err
+	}
+
+	readEp := &drivers.OvsCfgEndpointState{}
+	readEp.StateDriver = stateDriver
+	epCfgs, err := readAllOrNone(readEp)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := []ConfigTenant{}
+	for _, gCfg := range gCfgs {
+		cfg := gCfg.(*gstate.Cfg)
+		tenant := ConfigTenant{Name: cfg.Tenant,
+			DefaultNetType:     cfg.Deploy.DefaultNetType,
+			AllocSubnetLen:     cfg.Auto.AllocSubnetLen,
+			Vlans:              cfg.Auto.Vlans,
+			Vxlans:             cfg.Auto.Vxlans,
+			IsolatedVrf:        cfg.Deploy.IsolatedVrf,
+			DistributedRouting: cfg.Deploy.Vrf != 0,
+			MacPool:            cfg.Auto.MacPool,
+			MacFromIp:          cfg.Auto.MacFromIp,
+			AllocStrategy:      cfg.Auto.AllocStrategy,
+			MaxNetworks:        cfg.Quota.MaxNetworks,
+			MaxEndpoints:       cfg.Quota.MaxEndpoints,
+			MaxVlans:           cfg.Quota.MaxVlans,
+			MaxVxlans:          cfg.Quota.MaxVxlans,
+			MaxSubnets:         cfg.Quota.MaxSubnets,
+			Networks:           []ConfigNetwork{}}
+		if cfg.Auto.SubnetPool != "" {
+			tenant.SubnetPool = fmt.Sprintf("%s/%d", cfg.Auto.SubnetPool,
+				cfg.Auto.SubnetLen)
+		}
+
+		for _, nwMasterCfg := range nwMasterCfgs {
+			masterCfg := nwMasterCfg.(*MasterNwConfig)
+			if masterCfg.Tenant != tenant.Name {
+				continue
+			}
+
+			// the master config outlives a deleted network, skip the
+			// networks that are no longer operational
+			nwCfg := &drivers.OvsCfgNetworkState{}
+			nwCfg.StateDriver = stateDriver
+			if nwCfg.Read(masterCfg.Id) != nil {
+				continue
+			}
+
+			tenant.Networks = append(tenant.Networks,
+				exportNetwork(masterCfg, nwCfg, epCfgs, pinAuto))
+		}
+		sort.Sort(networksByName(tenant.Networks))
+
+		tenants = append(tenants, tenant)
+	}
+	sort.Sort(tenantsByName(tenants))
+
+	return tenants, nil
+}
+
+// ExportConfig reconstructs the configuration that results in the current
+// state. With pinAuto set the auto-allocated vlans, subnets and endpoint
+// addresses are included in the configuration, so that reapplying it on an
+// empty state reproduces the same allocations.
+func ExportConfig(stateDriver core.StateDriver, pinAuto bool) (*Config, error) {
+	var err error
+
+	allCfg := &Config{InfraNetworks: []ConfigInfraNetwork{}}
+	allCfg.HostVlans, err = GetHostVlans(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+	allCfg.Hosts, err = exportHosts(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	allCfg.Tenants, err = exportTenants(stateDriver, pinAuto)
+	if err != nil {
+		return nil, err
+	}
+
+	return allCfg, nil
+}
+
+type hostsByName []ConfigHost
+
+func (s hostsByName) Len() int           { return len(s) }
+func (s hostsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s hostsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type tenantsByName []ConfigTenant
+
+func (s tenantsByName) Len() int           { return len(s) }
+func (s tenantsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s tenantsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type networksByName []ConfigNetwork
+
+func (s networksByName) Len() int           { return len(s) }
+func (s networksByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s networksByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type epsByContainer []ConfigEp
+
+func (s epsByContainer) Len() int           { return len(s) }
+func (s epsByContainer) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s epsByContainer) Less(i, j int) bool { return s[i].Container < s[j].Container }
@@ -0,0 +1,134 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var exportCfgBytes = []byte(`{
+    "Hosts" : [{
+        "Name"                      : "host1",
+        "Intf"                      : "eth2"
+    }],
+    "Tenants" : [{
+        "Name"                      : "tenant-one",
+        "DefaultNetType"            : "vlan",
+        "SubnetPool"                : "11.1.0.0/16",
+        "AllocSubnetLen"            : 24,
+        "Vlans"                     : "11-28",
+        "Networks"  : [{
+            "Name"                  : "orange",
+            "Endpoints" : [{
+                "Host"              : "host1",
+                "Container"         : "myContainer2"
+            },
+            {
+                "Host"              : "host1",
+                "Container"         : "myContainer1"
+            }]
+        },
+        {
+            "Name"                  : "purple",
+            "PktTag"                : "20",
+            "SubnetCIDR"            : "12.1.1.0/24",
+            "DefaultGw"             : "12.1.1.254",
+            "Endpoints" : [{
+                "Host"              : "host1",
+                "Container"         : "myContainer3"
+            }]
+        }]
+    }]}`)
+
+func TestExportConfig(t *testing.T) {
+	applyConfig(t, exportCfgBytes)
+
+	allCfg, err := ExportConfig(fakeDriver, false)
+	if err != nil {
+		t.Fatalf("error '%s' exporting config \n", err)
+	}
+
+	if len(allCfg.Hosts) != 1 || allCfg.Hosts[0].Name != "host1" ||
+		allCfg.Hosts[0].Intf != "eth2" {
+		t.Fatalf("unexpected hosts %+v \n", allCfg.Hosts)
+	}
+	if len(allCfg.Tenants) != 1 {
+		t.Fatalf("unexpected tenants %+v \n", allCfg.Tenants)
+	}
+	tenant := allCfg.Tenants[0]
+	if tenant.Name != "tenant-one" || tenant.SubnetPool != "11.1.0.0/16" ||
+		tenant.Vlans != "11-28" || tenant.AllocSubnetLen != 24 {
+		t.Fatalf("unexpected tenant %+v \n", tenant)
+	}
+	if len(tenant.Networks) != 2 {
+		t.Fatalf("unexpected networks %+v \n", tenant.Networks)
+	}
+
+	orange := tenant.Networks[0]
+	if orange.Name != "orange" || orange.PktTag != "" || orange.SubnetCIDR != "" {
+		t.Fatalf("auto allocated values exported for %+v \n", orange)
+	}
+	if len(orange.Endpoints) != 2 ||
+		orange.Endpoints[0].Container != "myContainer1" ||
+		orange.Endpoints[0].Host != "host1" ||
+		orange.Endpoints[0].IpAddress != "" {
+		t.Fatalf("unexpected endpoints %+v \n", orange.Endpoints)
+	}
+
+	purple := tenant.Networks[1]
+	if purple.PktTag != "20" || purple.SubnetCIDR != "12.1.1.0/24" ||
+		purple.DefaultGw != "12.1.1.254" || len(purple.Endpoints) != 1 {
+		t.Fatalf("static values not exported for %+v \n", purple)
+	}
+}
+
+func TestExportConfigPinned(t *testing.T) {
+	applyConfig(t, exportCfgBytes)
+
+	allCfg, err := ExportConfig(fakeDriver, true)
+	if err != nil {
+		t.Fatalf("error '%s' exporting config \n", err)
+	}
+
+	orange := allCfg.Tenants[0].Networks[0]
+	if orange.PktTagType != "vlan" || orange.PktTag == "" ||
+		orange.SubnetCIDR == "" {
+		t.Fatalf("auto allocated values not pinned for %+v \n", orange)
+	}
+	for _, ep := range orange.Endpoints {
+		if ep.IpAddress == "" {
+			t.Fatalf("ip address not pinned for %+v \n", ep)
+		}
+	}
+
+	// restoring the pinned config on an empty state reproduces it
+	cfgBytes, err := json.Marshal(allCfg)
+	if err != nil {
+		t.Fatalf("error '%s' marshalling config \n", err)
+	}
+	applyConfig(t, cfgBytes)
+
+	restoredCfg, err := ExportConfig(fakeDriver, true)
+	if err != nil {
+		t.Fatalf("error '%s' exporting restored config \n", err)
+	}
+	if !reflect.DeepEqual(allCfg, restoredCfg) {
+		t.Fatalf("restored config %+v differs from exported config %+v \n",
+			restoredCfg, allCfg)
+	}
+}
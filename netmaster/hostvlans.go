@@ -0,0 +1,186 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/resources"
+)
+
+// hostVlanTenant returns a tenant whose vxlans have no local vlans of their
+// own, relying on the hosts to pick them
+func hostVlanTenant(stateDriver core.StateDriver) (string, error) {
+	readVxlanRsrc := &resources.AutoVxlanCfgResource{}
+	readVxlanRsrc.StateDriver = stateDriver
+	vxlanRsrcs, err := readAllOrNone(readVxlanRsrc)
+	if err != nil {
+		return "", err
+	}
+	for _, rsrc := range vxlanRsrcs {
+		cfg := rsrc.(*resources.AutoVxlanCfgResource)
+		if cfg.HostLocalVlans {
+			return cfg.Id, nil
+		}
+	}
+	return "", nil
+}
+
+// hostVlanUsages reports the usage of the host vlans on every host with local
+// vlans, along with the local vlans the host picked for the given networks.
+// The host vlans are shared by the tenants, the vlans used on a host count
+// the networks of every tenant.
+func hostVlanUsages(stateDriver core.StateDriver,
+	netIds map[string]bool) ([]core.ResourceUsage, error) {
+	hostVlans, err := drivers.ReadHostVlans(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	readOper := &drivers.OvsOperHostVlanState{}
+	readOper.StateDriver = stateDriver
+	opers, err := readAllOrNone(readOper)
+	if err != nil {
+		return nil, err
+	}
+	usages := []core.ResourceUsage{}
+	for _, state := range opers {
+		oper := state.(*drivers.OvsOperHostVlanState)
+		usage := core.ResourceUsage{Id: oper.Id,
+			Description: resources.LOCAL_VLAN_POOL,
+			Capacity:    hostVlans.Count(), Used: uint(len(oper.Vlans)),
+			Allocated: []core.AllocatedValue{}}
+		if usage.Capacity > usage.Used {
+			usage.Free = usage.Capacity - usage.Used
+		}
+		for netId, vlan := range oper.Vlans {
+			if netIds[netId] {
+				usage.Allocated = append(usage.Allocated, core.AllocatedValue{
+					Value: strconv.Itoa(int(vlan)), Owner: netId})
+			}
+		}
+		sort.Sort(valuesByOwner(usage.Allocated))
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// checkHostVlansInUse fails if a host uses a local vlan out of the new host
+// vlans
+func checkHostVlansInUse(stateDriver core.StateDriver,
+	cfg *drivers.OvsCfgHostVlansState) error {
+	newVlans, err := cfg.Bitset()
+	if err != nil {
+		return err
+	}
+
+	readOper := &drivers.OvsOperHostVlanState{}
+	readOper.StateDriver = stateDriver
+	opers, err := readAllOrNone(readOper)
+	if err != nil {
+		return err
+	}
+	for _, state := range opers {
+		oper := state.(*drivers.OvsOperHostVlanState)
+		for netId, vlan := range oper.Vlans {
+			if !newVlans.Test(vlan) {
+				return &core.Error{Desc: fmt.Sprintf(
+					"local vlan %d of network %s is in use on host %s",
+					vlan, netId, oper.Id)}
+			}
+		}
+	}
+	return nil
+}
+
+// SetHostVlans sets aside the vlans the hosts pick the local vlans of the
+// vxlan networks from, an empty range has the local vlans allocated along
+// with the vxlans. The host vlans can't overlap the tenants' vlans and local
+// vlans, and the local vlans in use on the hosts must remain in the new range.
+func SetHostVlans(stateDriver core.StateDriver, vlans string) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
+	cfg := &drivers.OvsCfgHostVlansState{}
+	cfg.StateDriver = stateDriver
+	err := cfg.Read("")
+	if core.ErrIfKeyExists(err) != nil {
+		return err
+	}
+	if cfg.Vlans == vlans {
+		return nil
+	}
+	cfg.Vlans = vlans
+
+	if vlans == "" {
+		tenant, err := hostVlanTenant(stateDriver)
+		if err != nil {
+			return err
+		}
+		if tenant != "" {
+			return &core.Error{Desc: fmt.Sprintf(
+				"tenant %s relies on the host vlans for its vxlans", tenant)}
+		}
+	}
+
+	newVlans, err := cfg.Bitset()
+	if err != nil {
+		return err
+	}
+	tenantVlans, err := gstate.TenantVlans(stateDriver)
+	if err != nil {
+		return err
+	}
+	if vlan, found := newVlans.Intersection(tenantVlans).NextSet(0); found {
+		return &core.Error{Desc: fmt.Sprintf(
+			"host vlan %d is used by a tenant", vlan)}
+	}
+
+	err = checkHostVlansInUse(stateDriver, cfg)
+	if err != nil {
+		log.Printf("error '%s' setting the host vlans to %q \n", err, vlans)
+		return err
+	}
+
+	if vlans == "" {
+		return cfg.Clear()
+	}
+	return cfg.Write()
+}
+
+// GetHostVlans returns the vlans set aside for the hosts' local vlans
+func GetHostVlans(stateDriver core.StateDriver) (string, error) {
+	cfg := &drivers.OvsCfgHostVlansState{}
+	cfg.StateDriver = stateDriver
+	err := cfg.Read("")
+	if core.ErrIfKeyExists(err) != nil {
+		return "", err
+	}
+	return cfg.Vlans, nil
+}
+
+type valuesByOwner []core.AllocatedValue
+
+func (s valuesByOwner) Len() int           { return len(s) }
+func (s valuesByOwner) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s valuesByOwner) Less(i, j int) bool { return s[i].Owner < s[j].Owner }
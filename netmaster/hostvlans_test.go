@@ -0,0 +1,100 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/resources"
+)
+
+func TestHostVlans(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	err := SetHostVlans(fakeDriver, "3000-3001")
+	if err != nil {
+		t.Fatalf("error '%s' setting the host vlans \n", err)
+	}
+
+	// the tenants' vlans are kept out of the host vlans
+	badTenant := newTestTenant("tenant-two", "11.2.0.0/16", false)
+	badTenant.Vlans = "2990-3000"
+	err = CreateTenant(fakeDriver, badTenant)
+	if err == nil {
+		t.Fatalf("created a tenant with vlans set aside for the hosts \n")
+	}
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.DefaultNetType = "vxlan"
+	tenant.Vxlans = "10001-10010"
+	err = CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	// the network leaves the pick of its local vlan to the hosts
+	nwCfg := &drivers.OvsCfgNetworkState{}
+	nwCfg.StateDriver = fakeDriver
+	err = nwCfg.Read("orange")
+	if err != nil || nwCfg.ExtPktTag != 10001 || nwCfg.PktTag != 0 {
+		t.Fatalf("error '%v' reading network, got %+v \n", err, nwCfg)
+	}
+	vlan, err := drivers.AllocHostVlan(fakeDriver, "host1", "orange")
+	if err != nil || vlan != 3000 {
+		t.Fatalf("error '%v' allocating the host vlan, got %d \n", err, vlan)
+	}
+
+	// the usage of the local vlans is reported per host
+	usages, err := GetTenantUsage(fakeDriver, tenant.Name)
+	if err != nil {
+		t.Fatalf("error '%s' getting tenant usage \n", err)
+	}
+	hostUsages := []core.ResourceUsage{}
+	for _, usage := range usages {
+		if usage.Description == resources.LOCAL_VLAN_POOL {
+			hostUsages = append(hostUsages, usage)
+		}
+	}
+	expUsage := core.ResourceUsage{Id: "host1",
+		Description: resources.LOCAL_VLAN_POOL, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{{Value: "3000", Owner: "orange"}}}
+	if len(hostUsages) != 1 || !reflect.DeepEqual(hostUsages[0], expUsage) {
+		t.Fatalf("local vlan usages %+v, expected %+v \n", hostUsages, expUsage)
+	}
+
+	for _, vlans := range []string{"", "3001-3010", "20-3010"} {
+		err = SetHostVlans(fakeDriver, vlans)
+		if err == nil {
+			t.Fatalf("host vlans changed to %q, expected to fail \n", vlans)
+		}
+	}
+	err = SetHostVlans(fakeDriver, "3000-3010")
+	if err != nil {
+		t.Fatalf("error '%s' growing the host vlans \n", err)
+	}
+	vlans, err := GetHostVlans(fakeDriver)
+	if err != nil || vlans != "3000-3010" {
+		t.Fatalf("error '%v' getting the host vlans, got %q \n", err, vlans)
+	}
+}
@@ -20,56 +20,103 @@ package netmaster
 // A host is a node where containers are deplyed
 // this structure keeps track of the host properties
 type ConfigHost struct {
-	Name   string
-	Intf   string
-	VtepIp string
-	NetId  string
+	Name   string `yaml:"Name"`
+	Intf   string `yaml:"Intf"`
+	VtepIp string `yaml:"VtepIp"`
+	NetId  string `yaml:"NetId"`
 }
 
 type ConfigInfraNetwork struct {
-	Name       string
-	PktTagType string
-	PktTag     string
+	Name       string `yaml:"Name"`
+	PktTagType string `yaml:"PktTagType"`
+	PktTag     string `yaml:"PktTag"`
 }
 
 // An endpoint is a leg into a network
 type ConfigEp struct {
-	Container  string
-	Host       string
-	AttachUUID string
-	IpAddress  string
+	Container  string `yaml:"Container"`
+	Host       string `yaml:"Host"`
+	AttachUUID string `yaml:"AttachUUID"`
+	IpAddress  string `yaml:"IpAddress"`
+	// addresses besides IpAddress, static ones and a number of allocated
+	// ones; allocated addresses come from any of the network's subnets
+	SecondaryIps     []string `yaml:"SecondaryIps"`
+	SecondaryIpCount uint     `yaml:"SecondaryIpCount"`
+	// container ports published on the ports of the endpoint's host, as
+	// 'hostPort:containerPort[/protocol]', the protocol being tcp (default)
+	// or udp; the network must have outbound nat
+	PublishedPorts []string `yaml:"PublishedPorts"`
 }
 
 // network is a multi-destination isolated containment of endpoints
 // or it is an endpoint group
 type ConfigNetwork struct {
-	Name string
+	Name string `yaml:"Name"`
 
 	// overrides for various functions when auto allocation is not desired
-	PktTagType string
-	PktTag     string
-	SubnetCIDR string
-	DefaultGw  string
+	PktTagType string `yaml:"PktTagType"`
+	PktTag     string `yaml:"PktTag"`
+	SubnetCIDR string `yaml:"SubnetCIDR"`
+	DefaultGw  string `yaml:"DefaultGw"`
+	// local vlan of a vxlan network with a static vxlan in PktTag, picked
+	// from the tenant's local vlans when not specified
+	LocalVlan string `yaml:"LocalVlan"`
+	// masquerade the endpoints' traffic to the outside world behind the
+	// address of their host, through a gateway at DefaultGw, by default the
+	// first address of the network's subnet
+	OutboundNat bool `yaml:"OutboundNat"`
+
+	// addresses of a static subnet kept out of the endpoints' allocation,
+	// ranges are specified as 'start-end'
+	ReservedIps      []string `yaml:"ReservedIps"`
+	ExcludedIpRanges []string `yaml:"ExcludedIpRanges"`
+	// limit the auto-allocation of the endpoints' addresses to a part of
+	// a static subnet
+	IpAllocStart string `yaml:"IpAllocStart"`
+	IpAllocEnd   string `yaml:"IpAllocEnd"`
 
 	// eps associated with the network
-	Endpoints []ConfigEp
+	Endpoints []ConfigEp `yaml:"Endpoints"`
 }
 
 // a tenant keeps the global tenant specific policy and networks within
 type ConfigTenant struct {
-	Name           string
-	DefaultNetType string
-	SubnetPool     string
-	AllocSubnetLen uint
-	Vlans          string
-	Vxlans         string
+	Name           string `yaml:"Name"`
+	DefaultNetType string `yaml:"DefaultNetType"`
+	SubnetPool     string `yaml:"SubnetPool"`
+	AllocSubnetLen uint   `yaml:"AllocSubnetLen"`
+	Vlans          string `yaml:"Vlans"`
+	Vxlans         string `yaml:"Vxlans"`
+	// an isolated vrf tenant's subnets may overlap other tenants' subnets
+	IsolatedVrf bool `yaml:"IsolatedVrf"`
+	// route between the tenant's networks on every host, through a gateway
+	// at each network's DefaultGw, by default the first address of its subnet
+	DistributedRouting bool `yaml:"DistributedRouting"`
+	// pool of the endpoints' macs, e.g. '02:02:ac:00:00:00/32', optionally
+	// deriving an endpoint's mac from its ip
+	MacPool   string `yaml:"MacPool"`
+	MacFromIp bool   `yaml:"MacFromIp"`
+	// strategy to pick the networks' vlans, vxlans and subnets with, one of
+	// lowest-first (default), round-robin, random and sticky
+	AllocStrategy string `yaml:"AllocStrategy"`
+	// the most networks, endpoints, vlan and vxlan networks, and networks
+	// with a subnet the tenant may have; zero is unlimited
+	MaxNetworks  uint `yaml:"MaxNetworks"`
+	MaxEndpoints uint `yaml:"MaxEndpoints"`
+	MaxVlans     uint `yaml:"MaxVlans"`
+	MaxVxlans    uint `yaml:"MaxVxlans"`
+	MaxSubnets   uint `yaml:"MaxSubnets"`
 
-	Networks []ConfigNetwork
+	Networks []ConfigNetwork `yaml:"Networks"`
 }
 
 // top level configuration
 type Config struct {
-	InfraNetworks []ConfigInfraNetwork
-	Hosts         []ConfigHost
-	Tenants       []ConfigTenant
+	// vlans set aside for the hosts to pick the local vlans of the vxlan
+	// networks from, e.g. '3000-4000'; when not specified the local vlans
+	// are allocated cluster wide along with the vxlans
+	HostVlans     string               `yaml:"HostVlans"`
+	InfraNetworks []ConfigInfraNetwork `yaml:"InfraNetworks"`
+	Hosts         []ConfigHost         `yaml:"Hosts"`
+	Tenants       []ConfigTenant       `yaml:"Tenants"`
 }
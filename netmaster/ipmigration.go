@@ -0,0 +1,155 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"log"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/contiv/netplugin/resources"
+)
+
+// the networks created before the networks had an ip resource kept their
+// allocated addresses in an allocation map of their own. Such a network is
+// migrated the first time its endpoints are created or deleted: its ip
+// resource is defined from the stored network and seeded with the addresses
+// of the allocation map and of the network's endpoints. The migration is done
+// once the network is stored without its allocation map; until then it is
+// redone from the start.
+
+// migrateNetIpRsrc defines the ip resource of a network that has none, or
+// that has the one of a migration that didn't complete
+func migrateNetIpRsrc(stateDriver core.StateDriver, ra core.ResourceManager,
+	nwCfg *drivers.OvsCfgNetworkState) error {
+	ipRsrc := &resources.AutoIpCfgResource{}
+	ipRsrc.StateDriver = stateDriver
+	err := ipRsrc.Read(nwCfg.Id)
+	if err == nil {
+		if nwCfg.IpAllocMap == nil {
+			return nil
+		}
+		log.Printf("redoing the migration of network %s \n", nwCfg.Id)
+		err = ra.UndefineResource(nwCfg.Id, resources.AUTO_IP_RSRC)
+		if err != nil {
+			return err
+		}
+	} else if core.ErrIfKeyExists(err) != nil {
+		return err
+	}
+
+	nwMasterCfg := &MasterNwConfig{}
+	nwMasterCfg.StateDriver = stateDriver
+	err = nwMasterCfg.Read(nwCfg.Id)
+	if core.ErrIfKeyExists(err) != nil {
+		return err
+	}
+	ipCfg, err := ipRsrcCfg(nwCfg, nwMasterCfg)
+	if err != nil {
+		return err
+	}
+	err = ra.DefineResource(nwCfg.Id, resources.AUTO_IP_RSRC, ipCfg)
+	if err != nil {
+		return err
+	}
+	log.Printf("migrating the ips of network %s to an ip resource \n",
+		nwCfg.Id)
+
+	err = seedNetIpRsrc(stateDriver, ra, nwCfg, ipCfg)
+	if err != nil {
+		// the addresses not seeded would be handed out again
+		if err1 := ra.UndefineResource(nwCfg.Id,
+			resources.AUTO_IP_RSRC); err1 != nil {
+			log.Printf("error '%s' undefining ip resource of network %s \n",
+				err1, nwCfg.Id)
+		}
+		return err
+	}
+	return nil
+}
+
+// seedNetIpRsrc marks the addresses allocated in a network before it had an
+// ip resource as in use, and drops the network's allocation map
+func seedNetIpRsrc(stateDriver core.StateDriver, ra core.ResourceManager,
+	nwCfg *drivers.OvsCfgNetworkState, ipCfg *resources.AutoIpCfgResource) error {
+	ipAddresses, err := legacyNetIps(stateDriver, nwCfg)
+	if err != nil {
+		return err
+	}
+	for _, ipAddress := range ipAddresses {
+		hostId, err := netutils.GetIpNumber(nwCfg.SubnetIp, nwCfg.SubnetLen, 32,
+			ipAddress)
+		if err != nil || ipCfg.Reserved.Test(hostId) {
+			continue
+		}
+		err = ra.ReserveResourceVal(nwCfg.Id, resources.AUTO_IP_RSRC,
+			net.ParseIP(ipAddress), "")
+		if err != nil {
+			log.Printf("error '%s' migrating ip %s of network %s \n", err,
+				ipAddress, nwCfg.Id)
+			return err
+		}
+	}
+
+	ipAllocMap := nwCfg.IpAllocMap
+	nwCfg.IpAllocMap = nil
+	err = nwCfg.Write()
+	if err != nil {
+		nwCfg.IpAllocMap = ipAllocMap
+	}
+	return err
+}
+
+// legacyNetIps returns the addresses allocated in a network before it had an
+// ip resource, the ones of its allocation map along with its endpoints'
+func legacyNetIps(stateDriver core.StateDriver,
+	nwCfg *drivers.OvsCfgNetworkState) ([]string, error) {
+	allocated := make(map[string]bool)
+	ipAddresses := []string{}
+	add := func(ipAddress string) {
+		if ipAddress != "" && !allocated[ipAddress] {
+			allocated[ipAddress] = true
+			ipAddresses = append(ipAddresses, ipAddress)
+		}
+	}
+
+	if nwCfg.IpAllocMap != nil {
+		for hostId, found := nwCfg.IpAllocMap.NextSet(0); found; hostId,
+			found = nwCfg.IpAllocMap.NextSet(hostId + 1) {
+			ipAddress, err := netutils.GetSubnetIp(nwCfg.SubnetIp,
+				nwCfg.SubnetLen, 32, hostId)
+			if err == nil {
+				add(ipAddress)
+			}
+		}
+	}
+
+	readEp := &drivers.OvsCfgEndpointState{}
+	readEp.StateDriver = stateDriver
+	epCfgs, err := readAllOrNone(readEp)
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range epCfgs {
+		epCfg := state.(*drivers.OvsCfgEndpointState)
+		if epCfg.NetId == nwCfg.Id {
+			add(epCfg.IpAddress)
+		}
+	}
+	return ipAddresses, nil
+}
@@ -0,0 +1,153 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/contiv/netplugin/resources"
+	"github.com/jainvipin/bitset"
+)
+
+// writeLegacyNetwork rewrites a network as stored before the networks had an
+// ip resource, with an allocation map of its addresses
+func writeLegacyNetwork(t *testing.T, netId string, hostIds ...uint) {
+	nwCfg := readTestNetwork(t, netId)
+	ra := &resources.EtcdResourceManager{Etcd: fakeDriver}
+	err := ra.UndefineResource(netId, resources.AUTO_IP_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' undefining ip resource \n", err)
+	}
+
+	ipAllocMap := &bitset.BitSet{}
+	netutils.InitSubnetBitset(ipAllocMap, nwCfg.SubnetLen)
+	for _, hostId := range hostIds {
+		ipAllocMap.Set(hostId)
+	}
+	allocMapJson, err := json.Marshal(ipAllocMap)
+	if err != nil {
+		t.Fatalf("error '%s' marshalling alloc map \n", err)
+	}
+	nwJson := fmt.Sprintf(`{"id":%q,"tenant":%q,"pktTagType":%q,"pktTag":%d,`+
+		`"extPktTag":0,"subnetIp":%q,"subnetLen":%d,"defaultGw":"",`+
+		`"epCount":%d,"ipAllocMap":%s}`, nwCfg.Id, nwCfg.Tenant,
+		nwCfg.PktTagType, nwCfg.PktTag, nwCfg.SubnetIp, nwCfg.SubnetLen,
+		nwCfg.EpCount, allocMapJson)
+	err = fakeDriver.WriteState(drivers.NW_CFG_PATH_PREFIX+netId, nwCfg,
+		func(interface{}) ([]byte, error) { return []byte(nwJson), nil })
+	if err != nil {
+		t.Fatalf("error '%s' writing legacy network \n", err)
+	}
+}
+
+func TestLegacyNetworkMigration(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	createTestEps(t, tenant, ConfigEp{Container: "myContainer1"},
+		ConfigEp{Container: "myContainer2"})
+
+	// 11.1.0.1 and 11.1.0.2 are in use by the endpoints, 11.1.0.3 only in the
+	// allocation map
+	writeLegacyNetwork(t, "orange", 1, 2, 3)
+
+	epCfgs := createTestEps(t, tenant, ConfigEp{Container: "myContainer3"})
+	if epCfgs[0].IpAddress != "11.1.0.4" {
+		t.Fatalf("ep %+v, expected the first address not in use 11.1.0.4 \n",
+			epCfgs[0])
+	}
+	nwCfg := readTestNetwork(t, "orange")
+	if nwCfg.IpAllocMap != nil || nwCfg.EpCount != 3 {
+		t.Fatalf("network %+v, expected it migrated with 3 eps \n", nwCfg)
+	}
+
+	// the endpoints of the network before the migration can be deleted, and
+	// their addresses are allocated again
+	network := ConfigNetwork{Name: "orange",
+		Endpoints: []ConfigEp{{Container: "myContainer1"}}}
+	err = DeleteEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		t.Fatalf("error '%s' deleting ep \n", err)
+	}
+	epCfgs = createTestEps(t, tenant, ConfigEp{Container: "myContainer4"})
+	if epCfgs[0].IpAddress != "11.1.0.1" {
+		t.Fatalf("ep %+v, expected the freed address 11.1.0.1 \n", epCfgs[0])
+	}
+
+	// a legacy network is migrated by deleting its endpoints too
+	writeLegacyNetwork(t, "orange", 1, 2, 3, 4)
+	network.Endpoints = []ConfigEp{{Container: "myContainer2"}}
+	err = DeleteEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		t.Fatalf("error '%s' deleting ep of legacy network \n", err)
+	}
+	epCfgs = createTestEps(t, tenant, ConfigEp{Container: "myContainer5"})
+	if epCfgs[0].IpAddress != "11.1.0.2" {
+		t.Fatalf("ep %+v, expected the freed address 11.1.0.2 \n", epCfgs[0])
+	}
+}
+
+func TestPartialNetworkMigration(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	createTestEps(t, tenant, ConfigEp{Container: "myContainer1"})
+
+	// a migration that stopped after defining the ip resource leaves the
+	// network with its allocation map and an ip resource not seeded
+	writeLegacyNetwork(t, "orange", 1, 2)
+	nwCfg := readTestNetwork(t, "orange")
+	ra := &resources.EtcdResourceManager{Etcd: fakeDriver}
+	err = ra.DefineResource("orange", resources.AUTO_IP_RSRC,
+		subnetIpRsrcCfg(nwCfg.SubnetIp, nwCfg.SubnetLen))
+	if err != nil {
+		t.Fatalf("error '%s' defining ip resource \n", err)
+	}
+
+	epCfgs := createTestEps(t, tenant, ConfigEp{Container: "myContainer2"})
+	if epCfgs[0].IpAddress != "11.1.0.3" {
+		t.Fatalf("ep %+v, expected the first address not in use 11.1.0.3 \n",
+			epCfgs[0])
+	}
+	nwCfg = readTestNetwork(t, "orange")
+	if nwCfg.IpAllocMap != nil {
+		t.Fatalf("network %+v, expected it migrated \n", nwCfg)
+	}
+}
@@ -0,0 +1,200 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/contiv/netplugin/resources"
+)
+
+// addresses of a network's subnet that are not handed out to the endpoints:
+// the reserved addresses (routers, vips) and the excluded ranges (addresses
+// managed outside netplugin) are excluded from the network's ip resource when
+// the network is created. The allocation range further limits the
+// auto-allocation; static endpoint addresses may be anywhere in the subnet
+// except on a reserved or excluded address.
+
+func hasIpReservations(network *ConfigNetwork) bool {
+	return len(network.ReservedIps) > 0 || len(network.ExcludedIpRanges) > 0 ||
+		network.IpAllocStart != "" || network.IpAllocEnd != ""
+}
+
+// a reserved address is a range of a single address
+func reservedIpRanges(reservedIps, excludedIpRanges []string) []string {
+	ipRanges := make([]string, 0, len(reservedIps)+len(excludedIpRanges))
+	ipRanges = append(ipRanges, reservedIps...)
+	return append(ipRanges, excludedIpRanges...)
+}
+
+func checkIpInSubnet(ipNet *net.IPNet, ip string) error {
+	if !ipNet.Contains(net.ParseIP(ip)) {
+		return &core.Error{Desc: fmt.Sprintf("ip %s is outside subnet %s",
+			ip, ipNet)}
+	}
+	return nil
+}
+
+// validateIpReservations checks the reserved addresses, the excluded ranges
+// and the allocation range of a network against the network's subnet
+func validateIpReservations(network *ConfigNetwork) error {
+	if !hasIpReservations(network) {
+		return nil
+	}
+	if network.SubnetCIDR == "" {
+		return errors.New("ip reservations require a static subnet")
+	}
+	_, ipNet, err := net.ParseCIDR(network.SubnetCIDR)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range network.ReservedIps {
+		if net.ParseIP(ip) == nil {
+			return &core.Error{Desc: fmt.Sprintf("invalid reserved ip %s", ip)}
+		}
+		if err = checkIpInSubnet(ipNet, ip); err != nil {
+			return err
+		}
+	}
+
+	for _, ipRange := range network.ExcludedIpRanges {
+		startIp, endIp, err := netutils.ParseIpRange(ipRange)
+		if err != nil {
+			return err
+		}
+		if err = checkIpInSubnet(ipNet, startIp); err != nil {
+			return err
+		}
+		if err = checkIpInSubnet(ipNet, endIp); err != nil {
+			return err
+		}
+	}
+
+	for _, ip := range []string{network.IpAllocStart, network.IpAllocEnd} {
+		if ip == "" {
+			continue
+		}
+		if net.ParseIP(ip) == nil {
+			return &core.Error{Desc: fmt.Sprintf("invalid allocation range ip %s", ip)}
+		}
+		if err = checkIpInSubnet(ipNet, ip); err != nil {
+			return err
+		}
+	}
+	if network.IpAllocStart != "" && network.IpAllocEnd != "" {
+		_, _, err = netutils.ParseIpRange(network.IpAllocStart + "-" +
+			network.IpAllocEnd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateEpIp checks a static endpoint address against the network's subnet
+// and reservations
+func validateEpIp(ipAddress, subnetCIDR string, reservedIps,
+	excludedIpRanges []string) error {
+	_, ipNet, err := net.ParseCIDR(subnetCIDR)
+	if err != nil {
+		return err
+	}
+	if err = checkIpInSubnet(ipNet, ipAddress); err != nil {
+		return err
+	}
+
+	for _, ipRange := range reservedIpRanges(reservedIps, excludedIpRanges) {
+		found, err := netutils.IpRangeContains(ipRange, ipAddress)
+		if err != nil {
+			return err
+		}
+		if found {
+			return &core.Error{Desc: fmt.Sprintf("ip %s is reserved (%s)",
+				ipAddress, ipRange)}
+		}
+	}
+
+	return nil
+}
+
+// subnetIpRsrcCfg returns the config of the ip resource of a subnet, the
+// network and broadcast addresses of which are never allocated
+func subnetIpRsrcCfg(subnetIp string, subnetLen uint) *resources.AutoIpCfgResource {
+	maxHosts := uint(1) << (32 - subnetLen)
+	reserved := netutils.CreateBitset(32 - subnetLen)
+	reserved.Set(0)
+	if maxHosts > 2 {
+		reserved.Set(maxHosts - 1)
+	}
+
+	return &resources.AutoIpCfgResource{
+		SubnetIp:  net.ParseIP(subnetIp),
+		SubnetLen: subnetLen,
+		Reserved:  reserved,
+		AllocEnd:  maxHosts - 1}
+}
+
+// ipRsrcCfg returns the config of the network's ip resource. The network and
+// broadcast addresses, the reserved addresses, the excluded ranges and the
+// default gateway, when it is in the subnet, are never allocated.
+func ipRsrcCfg(nwCfg *drivers.OvsCfgNetworkState,
+	nwMasterCfg *MasterNwConfig) (*resources.AutoIpCfgResource, error) {
+	var err error
+
+	rsrcCfg := subnetIpRsrcCfg(nwCfg.SubnetIp, nwCfg.SubnetLen)
+	reserved := rsrcCfg.Reserved
+
+	for _, ipRange := range reservedIpRanges(nwMasterCfg.ReservedIps,
+		nwMasterCfg.ExcludedIpRanges) {
+		err = netutils.SetIpRangeBits(reserved, nwCfg.SubnetIp,
+			nwCfg.SubnetLen, ipRange)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if nwCfg.DefaultGw != "" {
+		gwId, err := netutils.GetIpNumber(nwCfg.SubnetIp, nwCfg.SubnetLen, 32,
+			nwCfg.DefaultGw)
+		if err == nil {
+			reserved.Set(gwId)
+		}
+	}
+
+	if nwMasterCfg.IpAllocStart != "" {
+		rsrcCfg.AllocStart, err = netutils.GetIpNumber(nwCfg.SubnetIp,
+			nwCfg.SubnetLen, 32, nwMasterCfg.IpAllocStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nwMasterCfg.IpAllocEnd != "" {
+		rsrcCfg.AllocEnd, err = netutils.GetIpNumber(nwCfg.SubnetIp,
+			nwCfg.SubnetLen, 32, nwMasterCfg.IpAllocEnd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rsrcCfg, nil
+}
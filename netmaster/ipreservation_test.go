@@ -0,0 +1,167 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+)
+
+func createTestReservedNetwork(t *testing.T, network ConfigNetwork) *ConfigTenant {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	tenant.Networks = []ConfigNetwork{network}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating network \n", err)
+	}
+
+	return tenant
+}
+
+func createTestEp(tenant *ConfigTenant, container, ipAddress string) (string, error) {
+	network := tenant.Networks[0]
+	ep := ConfigEp{Container: container, Host: "host1", IpAddress: ipAddress}
+	network.Endpoints = []ConfigEp{ep}
+
+	err := CreateEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		return "", err
+	}
+
+	epCfg := &drivers.OvsCfgEndpointState{}
+	epCfg.StateDriver = fakeDriver
+	err = epCfg.Read(getEpName(&network, &ep))
+	if err != nil {
+		return "", err
+	}
+	return epCfg.IpAddress, nil
+}
+
+func TestIpReservations(t *testing.T) {
+	tenant := createTestReservedNetwork(t, ConfigNetwork{Name: "orange",
+		SubnetCIDR: "12.1.1.0/24", DefaultGw: "12.1.1.1",
+		ReservedIps:      []string{"12.1.1.2", "12.1.1.4"},
+		ExcludedIpRanges: []string{"12.1.1.5-12.1.1.9"}})
+
+	for i, expIp := range []string{"12.1.1.3", "12.1.1.10"} {
+		container := fmt.Sprintf("myContainer%d", i+1)
+		ipAddress, err := createTestEp(tenant, container, "")
+		if err != nil {
+			t.Fatalf("error '%s' creating ep %s \n", err, container)
+		}
+		if ipAddress != expIp {
+			t.Fatalf("ep %s allocated ip %s, expected %s \n", container,
+				ipAddress, expIp)
+		}
+	}
+
+	_, err := createTestEp(tenant, "myContainer3", "12.1.1.7")
+	if err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Fatalf("static ip in an excluded range accepted, err '%v' \n", err)
+	}
+
+	_, err = createTestEp(tenant, "myContainer3", "12.1.2.7")
+	if err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Fatalf("static ip outside the subnet accepted, err '%v' \n", err)
+	}
+
+	_, err = createTestEp(tenant, "myContainer3", "12.1.1.10")
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("static ip in use accepted, err '%v' \n", err)
+	}
+
+	ipAddress, err := createTestEp(tenant, "myContainer3", "12.1.1.200")
+	if err != nil || ipAddress != "12.1.1.200" {
+		t.Fatalf("error '%v' creating ep with static ip %s \n", err, ipAddress)
+	}
+}
+
+func TestIpAllocRange(t *testing.T) {
+	tenant := createTestReservedNetwork(t, ConfigNetwork{Name: "orange",
+		SubnetCIDR: "12.1.1.0/24", IpAllocStart: "12.1.1.100",
+		IpAllocEnd: "12.1.1.101"})
+
+	for i, expIp := range []string{"12.1.1.100", "12.1.1.101"} {
+		container := fmt.Sprintf("myContainer%d", i+1)
+		ipAddress, err := createTestEp(tenant, container, "")
+		if err != nil {
+			t.Fatalf("error '%s' creating ep %s \n", err, container)
+		}
+		if ipAddress != expIp {
+			t.Fatalf("ep %s allocated ip %s, expected %s \n", container,
+				ipAddress, expIp)
+		}
+	}
+
+	_, err := createTestEp(tenant, "myContainer3", "")
+	if err == nil || !strings.Contains(err.Error(), "no ips available") {
+		t.Fatalf("allocation beyond the allocation range, err '%v' \n", err)
+	}
+
+	// static addresses may be outside the allocation range
+	ipAddress, err := createTestEp(tenant, "myContainer3", "12.1.1.10")
+	if err != nil || ipAddress != "12.1.1.10" {
+		t.Fatalf("error '%v' creating ep with static ip %s \n", err, ipAddress)
+	}
+}
+
+func TestValidateConfigIpReservations(t *testing.T) {
+	invalidNetworks := map[string]ConfigNetwork{
+		"outside": {Name: "orange", SubnetCIDR: "12.1.1.0/24",
+			ReservedIps: []string{"12.1.2.1"}},
+		"static subnet": {Name: "orange", ReservedIps: []string{"12.1.1.1"}},
+		"start ip": {Name: "orange", SubnetCIDR: "12.1.1.0/24",
+			ExcludedIpRanges: []string{"12.1.1.20-12.1.1.10"}},
+		"bigger": {Name: "orange", SubnetCIDR: "12.1.1.0/24",
+			IpAllocStart: "12.1.1.200", IpAllocEnd: "12.1.1.100"},
+		"reserved": {Name: "orange", SubnetCIDR: "12.1.1.0/24",
+			ExcludedIpRanges: []string{"12.1.1.10-12.1.1.20"},
+			Endpoints:        []ConfigEp{{Container: "c1", IpAddress: "12.1.1.15"}}},
+	}
+
+	for expErr, network := range invalidNetworks {
+		cfg := &Config{Tenants: []ConfigTenant{{Name: "tenant-one",
+			Networks: []ConfigNetwork{network}}}}
+		err := ValidateConfig(cfg)
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Fatalf("unexpected error '%v' validating %+v, expected %q \n",
+				err, network, expErr)
+		}
+	}
+
+	cfg := &Config{Tenants: []ConfigTenant{{Name: "tenant-one",
+		Networks: []ConfigNetwork{{Name: "orange", SubnetCIDR: "12.1.1.0/24",
+			ReservedIps:      []string{"12.1.1.1"},
+			ExcludedIpRanges: []string{"12.1.1.10-12.1.1.20"},
+			IpAllocStart:     "12.1.1.100", IpAllocEnd: "12.1.1.200",
+			Endpoints: []ConfigEp{{Container: "c1",
+				IpAddress: "12.1.1.21"}}}}}}}
+	err := ValidateConfig(cfg)
+	if err != nil {
+		t.Fatalf("error '%s' validating ip reservations \n", err)
+	}
+}
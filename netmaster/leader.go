@@ -0,0 +1,234 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/contiv/netplugin/core"
+)
+
+// leader election amongst the netmaster replicas. The replicas contend for a
+// lease on LEADER_KEY in the state store; the holder of the lease is the
+// leader (active) and the rest are standbys. The leader keeps renewing the
+// lease, if it fails to do so within the failover timeout the lease expires
+// and one of the standbys takes over.
+
+const (
+	LEADER_KEY               = BASE_PATH + "leader"
+	DEFAULT_FAILOVER_TIMEOUT = 30 * time.Second
+	// fraction of the failover timeout by which the leader considers its
+	// lease lost ahead of the state store, to allow for clock drift and the
+	// latency of the renewals
+	LEASE_SAFETY_DIVISOR = 6
+)
+
+var ErrNotLeader = errors.New("not the leader netmaster, refusing to mutate state")
+
+type LeaderElector struct {
+	StateDriver core.StateDriver
+	// identity of this replica, as recorded in the lease
+	Id string
+	// time after which a standby takes over from an unresponsive leader
+	FailoverTimeout time.Duration
+	// called, if set, when this replica becomes the leader and when it
+	// stops being one
+	OnElected func()
+	OnDeposed func()
+
+	mutex    sync.Mutex
+	isLeader bool
+	// time the last successful acquire or renew of the lease was issued
+	renewedAt time.Time
+	stop      chan bool
+	done      chan bool
+}
+
+func (le *LeaderElector) timeout() time.Duration {
+	if le.FailoverTimeout < time.Second {
+		return DEFAULT_FAILOVER_TIMEOUT
+	}
+	return le.FailoverTimeout
+}
+
+func (le *LeaderElector) ttl() uint64 {
+	return uint64(le.timeout() / time.Second)
+}
+
+func (le *LeaderElector) leaseDriver() (core.LeaseDriver, error) {
+	ld, ok := le.StateDriver.(core.LeaseDriver)
+	if !ok {
+		return nil, &core.Error{Desc: fmt.Sprintf(
+			"state driver %T doesn't support leases", le.StateDriver)}
+	}
+	return ld, nil
+}
+
+// IsLeader returns true if this replica holds the lease and the lease can't
+// have expired yet, even if the renewals have stalled
+func (le *LeaderElector) IsLeader() bool {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	deadline := le.renewedAt.Add(le.timeout() - le.timeout()/LEASE_SAFETY_DIVISOR)
+	return le.isLeader && time.Now().Before(deadline)
+}
+
+// returns true if this replica believes it holds the lease, regardless of
+// the local deadline
+func (le *LeaderElector) holdsLease() bool {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	return le.isLeader
+}
+
+func (le *LeaderElector) setLeader(isLeader bool, renewedAt time.Time) {
+	le.mutex.Lock()
+	changed := le.isLeader != isLeader
+	le.isLeader = isLeader
+	if isLeader {
+		le.renewedAt = renewedAt
+	}
+	le.mutex.Unlock()
+
+	if !changed {
+		return
+	}
+	if isLeader {
+		log.Printf("netmaster %s elected as leader \n", le.Id)
+		if le.OnElected != nil {
+			le.OnElected()
+		}
+	} else {
+		log.Printf("netmaster %s is no longer the leader \n", le.Id)
+		if le.OnDeposed != nil {
+			le.OnDeposed()
+		}
+	}
+}
+
+// runs one round of election: the leader renews its lease and a standby
+// tries to acquire it
+func (le *LeaderElector) campaign() error {
+	ld, err := le.leaseDriver()
+	if err != nil {
+		return err
+	}
+
+	// the lease runs from before the request is issued
+	now := time.Now()
+	if le.holdsLease() {
+		err = ld.RenewLease(LEADER_KEY, le.Id, le.ttl())
+		if err != nil {
+			log.Printf("error '%s' renewing leader lease \n", err)
+			le.setLeader(false, now)
+			return err
+		}
+		le.setLeader(true, now)
+		return nil
+	}
+
+	acquired, err := ld.AcquireLease(LEADER_KEY, le.Id, le.ttl())
+	if err != nil {
+		log.Printf("error '%s' acquiring leader lease \n", err)
+		return err
+	}
+	le.setLeader(acquired, now)
+	return nil
+}
+
+// Start begins contending for the leadership in the background. The lease is
+// renewed (or its acquisition retried) thrice within the failover timeout.
+func (le *LeaderElector) Start() error {
+	if le.Id == "" {
+		return errors.New("null netmaster id")
+	}
+	if _, err := le.leaseDriver(); err != nil {
+		return err
+	}
+
+	le.stop = make(chan bool)
+	le.done = make(chan bool)
+	go func() {
+		defer close(le.done)
+		ticker := time.NewTicker(le.timeout() / 3)
+		defer ticker.Stop()
+		for {
+			le.campaign()
+			select {
+			case <-ticker.C:
+			case <-le.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// AwaitLeadership waits up to the passed time for this replica to become the
+// leader, it returns false if it didn't
+func (le *LeaderElector) AwaitLeadership(wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for !le.IsLeader() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// Stop stops contending and gives up the leadership, if held, so that a
+// standby can take over without waiting for the lease to expire
+func (le *LeaderElector) Stop() {
+	if le.stop != nil {
+		close(le.stop)
+		<-le.done
+		le.stop = nil
+	}
+
+	if le.holdsLease() {
+		if ld, err := le.leaseDriver(); err == nil {
+			err = ld.ReleaseLease(LEADER_KEY, le.Id)
+			if err != nil {
+				log.Printf("error '%s' releasing leader lease \n", err)
+			}
+		}
+		le.setLeader(false, time.Time{})
+	}
+}
+
+// the elector that decides whether this netmaster may mutate the state. A nil
+// elector means the caller doesn't take part in the election and the
+// mutations are always allowed.
+var leaderElector *LeaderElector
+
+// SetLeaderElector makes all subsequent netmaster operations that mutate
+// resources and allocations conditional to being the leader
+func SetLeaderElector(le *LeaderElector) {
+	leaderElector = le
+}
+
+func checkLeader() error {
+	if leaderElector != nil && !leaderElector.IsLeader() {
+		return ErrNotLeader
+	}
+	return nil
+}
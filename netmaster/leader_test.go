@@ -0,0 +1,147 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contiv/netplugin/drivers"
+)
+
+func newTestElectors(sd *drivers.FakeStateDriver) (*LeaderElector, *LeaderElector) {
+	active := &LeaderElector{StateDriver: sd, Id: "master1",
+		FailoverTimeout: time.Second}
+	standby := &LeaderElector{StateDriver: sd, Id: "master2",
+		FailoverTimeout: time.Second}
+	return active, standby
+}
+
+func TestLeaderElectionSingleLeader(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	active, standby := newTestElectors(sd)
+
+	if err := active.campaign(); err != nil {
+		t.Fatalf("error '%s' campaigning \n", err)
+	}
+	if err := standby.campaign(); err != nil {
+		t.Fatalf("error '%s' campaigning \n", err)
+	}
+	if !active.IsLeader() || standby.IsLeader() {
+		t.Fatalf("expected only %s to be the leader \n", active.Id)
+	}
+
+	// renewal keeps the leadership with the active replica
+	if err := active.campaign(); err != nil {
+		t.Fatalf("error '%s' renewing leadership \n", err)
+	}
+	if !active.IsLeader() {
+		t.Fatalf("%s lost leadership on renewal \n", active.Id)
+	}
+}
+
+func TestLeaderElectionFailoverOnRelease(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	active, standby := newTestElectors(sd)
+	elected := false
+	standby.OnElected = func() { elected = true }
+
+	active.campaign()
+	standby.campaign()
+	active.Stop()
+
+	if err := standby.campaign(); err != nil {
+		t.Fatalf("error '%s' campaigning \n", err)
+	}
+	if !standby.IsLeader() || !elected {
+		t.Fatalf("%s didn't take over leadership \n", standby.Id)
+	}
+}
+
+func TestLeaderElectionFailoverOnExpiry(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	active, standby := newTestElectors(sd)
+	deposed := false
+	active.OnDeposed = func() { deposed = true }
+
+	active.campaign()
+
+	// the active replica stops renewing and the lease expires
+	time.Sleep(active.FailoverTimeout + 100*time.Millisecond)
+	if err := standby.campaign(); err != nil {
+		t.Fatalf("error '%s' campaigning \n", err)
+	}
+	if !standby.IsLeader() {
+		t.Fatalf("%s didn't take over leadership \n", standby.Id)
+	}
+
+	if err := active.campaign(); err == nil {
+		t.Fatalf("renewal of an expired lease succeeded \n")
+	}
+	if active.IsLeader() || !deposed {
+		t.Fatalf("%s still considers itself the leader \n", active.Id)
+	}
+}
+
+func TestLeadershipLapsesWithoutRenewal(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	active, _ := newTestElectors(sd)
+
+	active.campaign()
+	if !active.AwaitLeadership(0) {
+		t.Fatalf("%s isn't the leader \n", active.Id)
+	}
+
+	// the renewals stall, the leadership lapses locally ahead of the lease
+	time.Sleep(active.FailoverTimeout * 9 / 10)
+	if active.IsLeader() {
+		t.Fatalf("%s is the leader past its lease deadline \n", active.Id)
+	}
+
+	// the lease hasn't expired in the store yet, so a renewal restores it
+	if err := active.campaign(); err != nil {
+		t.Fatalf("error '%s' renewing leadership \n", err)
+	}
+	if !active.IsLeader() {
+		t.Fatalf("%s lost leadership on renewal \n", active.Id)
+	}
+}
+
+func TestStandbyRefusesMutations(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	active, standby := newTestElectors(sd)
+	active.campaign()
+	standby.campaign()
+
+	SetLeaderElector(standby)
+	defer SetLeaderElector(nil)
+
+	err := CreateHost(sd, &ConfigHost{Name: "host1", Intf: "eth2"})
+	if err != ErrNotLeader {
+		t.Fatalf("standby mutated state, err '%v' \n", err)
+	}
+
+	SetLeaderElector(active)
+	err = CreateHost(sd, &ConfigHost{Name: "host1", Intf: "eth2"})
+	if err != nil {
+		t.Fatalf("error '%s' creating host on leader \n", err)
+	}
+}
@@ -0,0 +1,45 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/metrics"
+	"github.com/contiv/netplugin/resources"
+)
+
+// RegisterMetrics exports the usage of every tenant's vlan, vxlan and subnet
+// pools, as derived from the resources in the state store
+func RegisterMetrics(stateDriver core.StateDriver) error {
+	return metrics.Register(&resources.PoolCollector{StateDriver: stateDriver})
+}
+
+// ServeMetrics registers the netmaster metrics and serves them over http on
+// listenAddr. It blocks until the http server exits.
+func ServeMetrics(stateDriver core.StateDriver, listenAddr string) error {
+	err := RegisterMetrics(stateDriver)
+	if err != nil {
+		log.Printf("error '%s' registering netmaster metrics \n", err)
+		return err
+	}
+
+	mux := http.NewServeMux()
+	metrics.AddHandler(mux)
+	return http.ListenAndServe(listenAddr, mux)
+}
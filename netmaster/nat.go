@@ -0,0 +1,37 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"errors"
+)
+
+// validateNatNetwork checks a network with outbound nat. The hosts route the
+// network's subnets in their main table, so the subnets may not overlap the
+// subnets of other tenants, as the ones of an isolated vrf tenant may.
+func validateNatNetwork(network *ConfigNetwork, isolatedVrf,
+	hasSubnet bool) error {
+	if !network.OutboundNat {
+		return nil
+	}
+	if isolatedVrf {
+		return errors.New("outbound nat is not supported in an isolated vrf")
+	}
+	if !hasSubnet {
+		return errors.New("outbound nat requires a subnet")
+	}
+	return validateNetworkGw(network)
+}
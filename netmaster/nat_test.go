@@ -0,0 +1,75 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"testing"
+)
+
+func TestOutboundNat(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenants := []*ConfigTenant{
+		newTestTenant("tenant-one", "11.1.0.0/16", false),
+		newTestTenant("tenant-two", "11.2.0.0/16", true)}
+	for _, tenant := range tenants {
+		err := CreateTenant(fakeDriver, tenant)
+		if err != nil {
+			t.Fatalf("error '%s' creating tenant \n", err)
+		}
+	}
+
+	tenants[0].Networks = []ConfigNetwork{{Name: "orange", OutboundNat: true},
+		{Name: "purple"}}
+	err := CreateNetworks(fakeDriver, tenants[0])
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	// a network with outbound nat gets a gateway at the first address of its
+	// subnet, outside the tenant's vrf
+	nwCfg := readTestNetwork(t, "orange")
+	if !nwCfg.OutboundNat || nwCfg.DefaultGw != "11.1.0.1" || nwCfg.Vrf != 0 {
+		t.Fatalf("network %+v, expected outbound nat through 11.1.0.1 \n",
+			nwCfg)
+	}
+	nwCfg = readTestNetwork(t, "purple")
+	if nwCfg.OutboundNat || nwCfg.DefaultGw != "" {
+		t.Fatalf("network %+v, expected no outbound nat \n", nwCfg)
+	}
+	ip, err := createTestEp(tenants[0], "myContainer1", "")
+	if err != nil || ip != "11.1.0.2" {
+		t.Fatalf("error '%v' creating ep, got ip %s expected 11.1.0.2 \n",
+			err, ip)
+	}
+
+	// the subnets of an isolated vrf may overlap other tenants' subnets
+	tenants[1].Networks = []ConfigNetwork{{Name: "blue", OutboundNat: true}}
+	err = CreateNetworks(fakeDriver, tenants[1])
+	if err == nil {
+		t.Fatalf("created outbound nat network in an isolated vrf \n")
+	}
+
+	cfg, err := ExportConfig(fakeDriver, false)
+	if err != nil {
+		t.Fatalf("error '%s' exporting config \n", err)
+	}
+	for _, network := range cfg.Tenants[0].Networks {
+		if network.OutboundNat != (network.Name == "orange") {
+			t.Fatalf("exported network %+v, wrong outbound nat \n", network)
+		}
+	}
+}
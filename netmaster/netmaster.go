@@ -17,6 +17,7 @@ package netmaster
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"strconv"
@@ -51,6 +52,19 @@ func Init(stateDriver *core.StateDriver, cfg *Config) error {
 	return nil
 }
 
+// XXX: instead of initing resource-manager always, just init and
+// store it once. Also the type of resource-manager should be picked up
+// based on configuration.
+func newResourceManager(stateDriver core.StateDriver) (*resources.EtcdResourceManager,
+	error) {
+	ra := &resources.EtcdResourceManager{Etcd: stateDriver}
+	err := ra.Init()
+	if err != nil {
+		return nil, err
+	}
+	return ra, nil
+}
+
 func checkPktTagType(pktTagType string) error {
 	if pktTagType != "" && pktTagType != "vlan" && pktTagType != "vxlan" {
 		return errors.New("invalid pktTagType")
@@ -94,42 +108,83 @@ func validateTenantConfig(tenant *ConfigTenant) error {
 		}
 	}
 
+	if tenant.MacPool != "" {
+		_, _, err = netutils.ParseMacPool(tenant.MacPool)
+		if err != nil {
+			return err
+		}
+	} else if tenant.MacFromIp {
+		return errors.New("deriving macs from ips requires a mac pool")
+	}
+
+	err = resources.ValidateAllocStrategy(tenant.AllocStrategy)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func CreateTenant(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
+	err := validateTenantConfig(tenant)
+	if err != nil {
+		return err
+	}
+
 	gOper := &gstate.Oper{}
 	gOper.StateDriver = stateDriver
-	err := gOper.Read(tenant.Name)
+	err = gOper.Read(tenant.Name)
 	if err == nil {
-		return err
+		return resizeTenantPools(stateDriver, tenant)
 	}
 
-	err = validateTenantConfig(tenant)
+	poolSubnet, err := tenantPoolSubnet(tenant)
 	if err != nil {
 		return err
 	}
+	if poolSubnet != nil {
+		as, err := readAddrSpace(stateDriver)
+		if err != nil {
+			return err
+		}
+		err = as.check(poolSubnet)
+		if err != nil {
+			log.Printf("error '%s' validating tenant '%s' \n", err, tenant.Name)
+			return err
+		}
+	}
 
 	gCfg := &gstate.Cfg{}
 	gCfg.StateDriver = stateDriver
 	gCfg.Version = gstate.VersionBeta1
 	gCfg.Tenant = tenant.Name
 	gCfg.Deploy.DefaultNetType = tenant.DefaultNetType
+	gCfg.Deploy.IsolatedVrf = tenant.IsolatedVrf
+	if tenant.DistributedRouting {
+		gCfg.Deploy.Vrf, err = allocVrf(stateDriver)
+		if err != nil {
+			return err
+		}
+	}
 	gCfg.Auto.SubnetPool, gCfg.Auto.SubnetLen, _ = netutils.ParseCIDR(tenant.SubnetPool)
 	gCfg.Auto.Vlans = tenant.Vlans
 	gCfg.Auto.Vxlans = tenant.Vxlans
 	gCfg.Auto.AllocSubnetLen = tenant.AllocSubnetLen
+	gCfg.Auto.MacPool = tenant.MacPool
+	gCfg.Auto.MacFromIp = tenant.MacFromIp
+	gCfg.Auto.AllocStrategy = tenant.AllocStrategy
+	gCfg.Quota = tenantQuota(tenant)
 	err = gCfg.Write()
 	if err != nil {
 		log.Printf("error '%s' updating tenant '%s' \n", err, tenant.Name)
 	}
 
-	// XXX: instead of initing resource-manager always, just init and
-	// store it once. Also the type of resource-manager should be picked up
-	// based on configuration.
-	ra := &resources.EtcdResourceManager{Etcd: stateDriver}
-	err = ra.Init()
+	ra, err := newResourceManager(stateDriver)
 	if err != nil {
 		return err
 	}
@@ -143,7 +198,82 @@ func CreateTenant(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 	return err
 }
 
+// resizeTenantPools changes the subnet pool, the vlans and the vxlans of an
+// existing tenant, keeping the allocated values
+func resizeTenantPools(stateDriver core.StateDriver, tenant *ConfigTenant) error {
+	gCfg := &gstate.Cfg{}
+	gCfg.StateDriver = stateDriver
+	err := gCfg.Read(tenant.Name)
+	if err != nil {
+		log.Printf("error '%s' reading tenant cfg state \n", err)
+		return err
+	}
+
+	auto := gCfg.Auto
+	auto.SubnetPool, auto.SubnetLen, _ = netutils.ParseCIDR(tenant.SubnetPool)
+	auto.AllocSubnetLen = tenant.AllocSubnetLen
+	auto.Vlans = tenant.Vlans
+	auto.Vxlans = tenant.Vxlans
+	auto.MacPool = tenant.MacPool
+	auto.MacFromIp = tenant.MacFromIp
+	auto.AllocStrategy = tenant.AllocStrategy
+
+	// the quotas apply to the networks and endpoints created from now on,
+	// lowering them keeps the ones in excess
+	if quota := tenantQuota(tenant); quota != gCfg.Quota {
+		gCfg.Quota = quota
+		err = gCfg.Write()
+		if err != nil {
+			log.Printf("error '%s' updating quotas of tenant '%s' \n",
+				err, tenant.Name)
+			return err
+		}
+	}
+	if auto == gCfg.Auto {
+		return nil
+	}
+
+	if auto.SubnetPool != gCfg.Auto.SubnetPool ||
+		auto.SubnetLen != gCfg.Auto.SubnetLen {
+		poolSubnet, err := tenantPoolSubnet(tenant)
+		if err != nil {
+			return err
+		}
+		as, err := readAddrSpace(stateDriver)
+		if err != nil {
+			return err
+		}
+		as.removePool(tenant.Name)
+		if poolSubnet != nil {
+			err = as.check(poolSubnet)
+			if err != nil {
+				log.Printf("error '%s' resizing pool of tenant '%s' \n",
+					err, tenant.Name)
+				return err
+			}
+		}
+	}
+
+	ra, err := newResourceManager(stateDriver)
+	if err != nil {
+		return err
+	}
+
+	err = gCfg.ResizePools(core.ResourceManager(ra), &auto)
+	if err != nil {
+		log.Printf("error '%s' resizing pools of tenant '%s' \n",
+			err, tenant.Name)
+		return err
+	}
+
+	return nil
+}
+
 func DeleteTenantId(stateDriver core.StateDriver, tenantId string) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	gOper := &gstate.Oper{}
 	gOper.StateDriver = stateDriver
 	err := gOper.Read(tenantId)
@@ -302,6 +432,10 @@ func deleteVlanIf(stateDriver core.StateDriver, hostName string) error {
 }
 
 func CreateHost(stateDriver core.StateDriver, host *ConfigHost) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	err := validateHostConfig(host)
 	if err != nil {
 		log.Printf("error '%s' validating host config \n", err)
@@ -353,6 +487,10 @@ func CreateHost(stateDriver core.StateDriver, host *ConfigHost) error {
 }
 
 func DeleteHostId(stateDriver core.StateDriver, hostName string) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	hostCfg := &MasterHostConfig{}
 	hostCfg.StateDriver = stateDriver
 	hostCfg.Name = hostName
@@ -412,7 +550,7 @@ func validateNetworkConfig(tenant *ConfigTenant) error {
 
 	for _, network := range tenant.Networks {
 		if network.Name == "" {
-			errors.New("null network name")
+			return errors.New("null network name")
 		}
 
 		err = checkPktTagType(network.PktTagType)
@@ -421,10 +559,26 @@ func validateNetworkConfig(tenant *ConfigTenant) error {
 		}
 
 		if network.PktTag != "" {
-			_, err = strconv.Atoi(network.PktTag)
+			pktTag, err := strconv.Atoi(network.PktTag)
 			if err != nil {
 				return err
 			}
+			if network.PktTagType == "vlan" && (pktTag <= 0 || pktTag >= 4095) {
+				return errors.New("invalid vlan")
+			}
+		}
+
+		if network.LocalVlan != "" {
+			if network.PktTag == "" || network.PktTagType == "vlan" {
+				return errors.New("a local vlan requires a static vxlan")
+			}
+			vlan, err := strconv.Atoi(network.LocalVlan)
+			if err != nil {
+				return err
+			}
+			if vlan <= 0 || vlan >= 4095 {
+				return errors.New("invalid local vlan")
+			}
 		}
 
 		if network.SubnetCIDR != "" {
@@ -439,12 +593,21 @@ func validateNetworkConfig(tenant *ConfigTenant) error {
 				return errors.New("invalid IP")
 			}
 		}
+
+		err = validateIpReservations(&network)
+		if err != nil {
+			return err
+		}
 	}
 
 	return err
 }
 
 func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	var extPktTag, pktTag uint
 
 	gCfg := gstate.Cfg{}
@@ -455,11 +618,7 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 		return err
 	}
 
-	// XXX: instead of initing resource-manager always, just init and
-	// store it once. Also the type of resource-manager should be picked up
-	// based on configuration.
-	tempRa := &resources.EtcdResourceManager{Etcd: stateDriver}
-	err = tempRa.Init()
+	tempRa, err := newResourceManager(stateDriver)
 	if err != nil {
 		return err
 	}
@@ -471,6 +630,16 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 		return err
 	}
 
+	as, err := readAddrSpace(stateDriver)
+	if err != nil {
+		return err
+	}
+
+	quotaUsage, err := readQuotaUsage(stateDriver, &gCfg)
+	if err != nil {
+		return err
+	}
+
 	for _, network := range tenant.Networks {
 		nwCfg := &drivers.OvsCfgNetworkState{}
 		nwCfg.StateDriver = stateDriver
@@ -479,6 +648,45 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 			continue
 		}
 
+		pktTagType := network.PktTagType
+		if pktTagType == "" {
+			pktTagType = gCfg.Deploy.DefaultNetType
+		}
+		hasSubnet := network.SubnetCIDR != "" || gCfg.Auto.SubnetPool != ""
+		err = quotaUsage.checkNetwork(pktTagType, hasSubnet)
+		if err != nil {
+			log.Printf("error '%s' creating network %s \n", err, network.Name)
+			return err
+		}
+		if gCfg.Deploy.Vrf != 0 {
+			err = validateNetworkGw(&network)
+			if err != nil {
+				log.Printf("error '%s' routing network %s \n", err,
+					network.Name)
+				return err
+			}
+		}
+		err = validateNatNetwork(&network, gCfg.Deploy.IsolatedVrf, hasSubnet)
+		if err != nil {
+			log.Printf("error '%s' creating network %s \n", err, network.Name)
+			return err
+		}
+
+		subnet, err := networkSubnet(tenant.Name, gCfg.Deploy.IsolatedVrf,
+			&network)
+		if err != nil {
+			return err
+		}
+		if subnet != nil {
+			subnetIp, subnetLen, _ := netutils.ParseCIDR(network.SubnetCIDR)
+			subnet.fromPool = gCfg.SubnetInPool(subnetIp, subnetLen)
+			err = as.add(subnet)
+			if err != nil {
+				log.Printf("error '%s' validating network config \n", err)
+				return err
+			}
+		}
+
 		// construct and update network state
 		nwMasterCfg := &MasterNwConfig{}
 		nwMasterCfg.StateDriver = stateDriver
@@ -486,8 +694,14 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 		nwMasterCfg.Id = network.Name
 		nwMasterCfg.PktTagType = network.PktTagType
 		nwMasterCfg.PktTag = network.PktTag
+		nwMasterCfg.LocalVlan = network.LocalVlan
 		nwMasterCfg.SubnetIp, nwMasterCfg.SubnetLen, _ = netutils.ParseCIDR(network.SubnetCIDR)
 		nwMasterCfg.DefaultGw = network.DefaultGw
+		nwMasterCfg.OutboundNat = network.OutboundNat
+		nwMasterCfg.ReservedIps = network.ReservedIps
+		nwMasterCfg.ExcludedIpRanges = network.ExcludedIpRanges
+		nwMasterCfg.IpAllocStart = network.IpAllocStart
+		nwMasterCfg.IpAllocEnd = network.IpAllocEnd
 
 		nwCfg = &drivers.OvsCfgNetworkState{Tenant: nwMasterCfg.Tenant,
 			PktTagType: nwMasterCfg.PktTagType,
@@ -500,12 +714,12 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 		}
 		if nwMasterCfg.PktTag == "" {
 			if nwCfg.PktTagType == "vlan" {
-				pktTag, err = gCfg.AllocVlan(ra)
+				pktTag, err = gCfg.AllocVlan(ra, nwCfg.Id)
 				if err != nil {
 					return err
 				}
 			} else if nwCfg.PktTagType == "vxlan" {
-				extPktTag, pktTag, err = gCfg.AllocVxlan(ra)
+				extPktTag, pktTag, err = gCfg.AllocVxlan(ra, nwCfg.Id)
 				if err != nil {
 					return err
 				}
@@ -513,31 +727,65 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 
 			nwCfg.ExtPktTag = int(extPktTag)
 			nwCfg.PktTag = int(pktTag)
-		} else if nwMasterCfg.PktTagType == "vxlan" {
-			// XXX: take local vlan as config, instead of allocating it
-			// independently. Return erro for now, if user tries this config
-			return &core.Error{Desc: "Not handled. Need to introduce local-vlan config"}
+		} else if nwCfg.PktTagType == "vxlan" {
+			vxlan, _ := strconv.Atoi(nwMasterCfg.PktTag)
+			localVlan, _ := strconv.Atoi(nwMasterCfg.LocalVlan)
+			pktTag, err = gCfg.ReserveVxlan(ra, uint(vxlan), uint(localVlan),
+				nwCfg.Id)
+			if err != nil {
+				log.Printf("error '%s' reserving vxlan %d \n", err, vxlan)
+				return err
+			}
+			nwCfg.ExtPktTag = vxlan
 			nwCfg.PktTag = int(pktTag)
-			nwCfg.ExtPktTag, _ = strconv.Atoi(nwMasterCfg.PktTag)
-		} else if nwMasterCfg.PktTagType == "vlan" {
-			nwCfg.PktTag, _ = strconv.Atoi(nwMasterCfg.PktTag)
-			// XXX: do configuration check, to make sure it is allowed
+		} else if nwCfg.PktTagType == "vlan" {
+			vlan, _ := strconv.Atoi(nwMasterCfg.PktTag)
+			err = gCfg.ReserveVlan(ra, uint(vlan), nwCfg.Id)
+			if err != nil {
+				log.Printf("error '%s' reserving vlan %d \n", err, vlan)
+				return err
+			}
+			nwCfg.PktTag = vlan
 		}
 
 		if nwCfg.SubnetIp == "" {
 			nwCfg.SubnetLen = gCfg.Auto.AllocSubnetLen
-			nwCfg.SubnetIp, err = gCfg.AllocSubnet(ra)
+			nwCfg.SubnetIp, err = gCfg.AllocSubnet(ra, nwCfg.Id)
+			if err != nil {
+				return err
+			}
+		} else if subnet.fromPool {
+			// a static subnet of the pool, e.g. a pinned one, is taken out
+			// of the pool so that it isn't allocated to another network
+			err = gCfg.ReserveSubnet(ra, nwCfg.SubnetIp, nwCfg.Id)
 			if err != nil {
+				log.Printf("error '%s' reserving subnet %s \n", err,
+					network.SubnetCIDR)
 				return err
 			}
 		}
 
 		nwCfg.DefaultGw = network.DefaultGw
-		if nwCfg.DefaultGw == "" {
-			// TBD: allocate per global policy
+		nwCfg.OutboundNat = network.OutboundNat
+		if (gCfg.Deploy.Vrf != 0 || nwCfg.OutboundNat) && nwCfg.SubnetIp != "" {
+			nwCfg.DefaultGw, err = networkGw(nwCfg)
+			if err != nil {
+				log.Printf("error '%s' routing network %s \n", err, nwCfg.Id)
+				return err
+			}
+			nwCfg.Vrf = gCfg.Deploy.Vrf
+		}
+
+		ipCfg, err := ipRsrcCfg(nwCfg, nwMasterCfg)
+		if err != nil {
+			log.Printf("error '%s' reserving ips \n", err)
+			return err
+		}
+		err = ra.DefineResource(nwCfg.Id, resources.AUTO_IP_RSRC, ipCfg)
+		if err != nil {
+			return err
 		}
 
-		netutils.InitSubnetBitset(&nwCfg.IpAllocMap, nwCfg.SubnetLen)
 		err = nwCfg.Write()
 		if err != nil {
 			return err
@@ -567,6 +815,7 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 				}
 			}
 		}
+		quotaUsage.addNetwork(pktTagType, hasSubnet)
 	}
 
 	return err
@@ -575,11 +824,7 @@ func CreateNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 func freeNetworkResources(stateDriver core.StateDriver, nwMasterCfg *MasterNwConfig,
 	nwCfg *drivers.OvsCfgNetworkState, gCfg *gstate.Cfg) (err error) {
 
-	// XXX: instead of initing resource-manager always, just init and
-	// store it once. Also the type of resource-manager should be picked up
-	// based on configuration.
-	tempRa := &resources.EtcdResourceManager{Etcd: stateDriver}
-	err = tempRa.Init()
+	tempRa, err := newResourceManager(stateDriver)
 	if err != nil {
 		return err
 	}
@@ -599,8 +844,19 @@ func freeNetworkResources(stateDriver core.StateDriver, nwMasterCfg *MasterNwCon
 		}
 	}
 
-	if nwMasterCfg.SubnetIp == "" {
-		log.Printf("freeing subnet %s/%s \n", nwCfg.SubnetIp,
+	err = ra.UndefineResource(nwCfg.Id, resources.AUTO_IP_RSRC)
+	if err != nil {
+		log.Printf("error '%s' freeing ips of network %s \n", err, nwCfg.Id)
+	}
+
+	err = freeNetSubnets(ra, gCfg, nwCfg)
+	if err != nil {
+		return err
+	}
+
+	if nwMasterCfg.SubnetIp == "" ||
+		gCfg.SubnetInPool(nwCfg.SubnetIp, nwCfg.SubnetLen) {
+		log.Printf("freeing subnet %s/%d \n", nwCfg.SubnetIp,
 			nwCfg.SubnetLen)
 		err = gCfg.FreeSubnet(ra, nwCfg.SubnetIp)
 		if err != nil {
@@ -612,6 +868,10 @@ func freeNetworkResources(stateDriver core.StateDriver, nwMasterCfg *MasterNwCon
 }
 
 func DeleteNetworkId(stateDriver core.StateDriver, netId string) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	nwMasterCfg := &MasterNwConfig{}
 	nwMasterCfg.StateDriver = stateDriver
 	err := nwMasterCfg.Read(netId)
@@ -651,6 +911,10 @@ func DeleteNetworkId(stateDriver core.StateDriver, netId string) error {
 }
 
 func DeleteNetworks(stateDriver core.StateDriver, tenant *ConfigTenant) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	gCfg := &gstate.Cfg{}
 	gCfg.StateDriver = stateDriver
 
@@ -710,14 +974,16 @@ func validateEndpointConfig(stateDriver core.StateDriver, tenant *ConfigTenant)
 
 	for _, network := range tenant.Networks {
 		if network.Name == "" {
-			errors.New("null network name")
+			return errors.New("null network name")
 		}
 
 		for _, ep := range network.Endpoints {
-			if ep.Container == "" {
-				return errors.New("invalid container name for the endpoint")
+			err = validateEndpoint(&ep)
+			if err != nil {
+				return err
 			}
-			if ep.IpAddress != "" {
+			ipAddresses := staticEpIps(&ep)
+			if len(ipAddresses) > 0 {
 				nwMasterCfg := &MasterNwConfig{}
 				nwMasterCfg.StateDriver = stateDriver
 				err = nwMasterCfg.Read(network.Name)
@@ -726,13 +992,18 @@ func validateEndpointConfig(stateDriver core.StateDriver, tenant *ConfigTenant)
 						err)
 					return err
 				}
-				if nwMasterCfg.SubnetIp != "" {
+				if nwMasterCfg.SubnetIp == "" {
 					log.Printf("validate: found endpoint with ip for " +
 						"auto-allocated net \n")
 					return errors.New("found ep with ip for auto-allocated net")
 				}
-				if net.ParseIP(ep.IpAddress) == nil {
-					return errors.New("invalid ep IP")
+				for _, ipAddress := range ipAddresses {
+					err = validateEpIp(ipAddress, fmt.Sprintf("%s/%d",
+						nwMasterCfg.SubnetIp, nwMasterCfg.SubnetLen),
+						nwMasterCfg.ReservedIps, nwMasterCfg.ExcludedIpRanges)
+					if err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -748,49 +1019,113 @@ func getEpName(net *ConfigNetwork, ep *ConfigEp) string {
 		return ep.Host + "-native-intf"
 	}
 }
-func allocSetEpIp(ep *ConfigEp, epCfg *drivers.OvsCfgEndpointState,
-	nwCfg *drivers.OvsCfgNetworkState) (err error) {
 
-	var ipAddrValue uint = 0
-	var found bool
+// freeEpIps frees addresses of an endpoint that is not created after all
+func freeEpIps(ra core.ResourceManager, nwCfg *drivers.OvsCfgNetworkState,
+	ipAddresses []string) {
+	for _, ipAddress := range ipAddresses {
+		err := freeNetIp(ra, nwCfg, ipAddress)
+		if err != nil {
+			log.Printf("error '%s' freeing ip %s of network %s \n", err,
+				ipAddress, nwCfg.Id)
+		}
+	}
+}
+
+// allocSetEpIp allocates or reserves the endpoint's address and its
+// secondary addresses, the allocated ones coming from any of the network's
+// subnets. On an error, the addresses and the subnets the network grew by
+// for them are freed.
+func allocSetEpIp(ra core.ResourceManager, gCfg *gstate.Cfg, quota *quotaUsage,
+	ep *ConfigEp, epCfg *drivers.OvsCfgEndpointState,
+	nwCfg *drivers.OvsCfgNetworkState) (err error) {
+	ipAddresses := []string{}
+	numSubnets := len(nwCfg.ExtraSubnets)
+	defer func() {
+		if err == nil {
+			return
+		}
+		freeEpIps(ra, nwCfg, ipAddresses)
+		if err1 := shrinkNetwork(ra, gCfg, quota, nwCfg, numSubnets); err1 != nil {
+			log.Printf("error '%s' freeing the subnets network %s grew by \n",
+				err1, nwCfg.Id)
+		}
+	}()
 
 	ipAddress := ep.IpAddress
 	if ipAddress == "" {
-		if ipAddrValue, found = nwCfg.IpAllocMap.NextClear(0); !found {
+		ipAddress, err = allocNetIp(ra, gCfg, quota, nwCfg)
+		if err != nil {
 			log.Printf("auto allocation failed - address exhaustion "+
-				"in subnet %s/%d \n", nwCfg.SubnetIp, nwCfg.SubnetLen)
-			return
+				"in network %s \n", nwCfg.Id)
+			return err
 		}
-		ipAddress, err = netutils.GetSubnetIp(
-			nwCfg.SubnetIp, nwCfg.SubnetLen, 32, ipAddrValue)
+	} else {
+		err = reserveNetIp(ra, nwCfg, ipAddress)
 		if err != nil {
-			log.Printf("create eps: error acquiring subnet ip '%s' \n",
-				err)
-			return
+			log.Printf("create eps: error '%s' reserving ip %s in subnet "+
+				"%s/%d \n", err, ipAddress, nwCfg.SubnetIp, nwCfg.SubnetLen)
+			return err
 		}
-	} else if ipAddress != "" && nwCfg.SubnetIp != "" {
-		ipAddrValue, err = netutils.GetIpNumber(
-			nwCfg.SubnetIp, nwCfg.SubnetLen, 32, ipAddress)
+	}
+	ipAddresses = append(ipAddresses, ipAddress)
+	epCfg.IpAddress = ipAddress
+
+	epCfg.SecondaryIps = []string{}
+	for _, ipAddress = range ep.SecondaryIps {
+		err = reserveNetIp(ra, nwCfg, ipAddress)
 		if err != nil {
-			log.Printf("create eps: error getting host id from hostIp "+
-				"%s Subnet %s/%d err '%s'\n",
-				ipAddress, nwCfg.SubnetIp, nwCfg.SubnetLen, err)
-			return
+			log.Printf("create eps: error '%s' reserving secondary ip %s \n",
+				err, ipAddress)
+			return err
 		}
+		ipAddresses = append(ipAddresses, ipAddress)
+		epCfg.SecondaryIps = append(epCfg.SecondaryIps, ipAddress)
+	}
+	for i := uint(0); i < ep.SecondaryIpCount; i++ {
+		ipAddress, err = allocNetIp(ra, gCfg, quota, nwCfg)
+		if err != nil {
+			log.Printf("auto allocation of secondary ip failed - address "+
+				"exhaustion in network %s \n", nwCfg.Id)
+			return err
+		}
+		ipAddresses = append(ipAddresses, ipAddress)
+		epCfg.SecondaryIps = append(epCfg.SecondaryIps, ipAddress)
 	}
-	epCfg.IpAddress = ipAddress
-	nwCfg.IpAllocMap.Set(ipAddrValue)
 
-	return
+	return nil
 }
 
 func CreateEndpoints(stateDriver core.StateDriver, tenant *ConfigTenant) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	err := validateEndpointConfig(stateDriver, tenant)
 	if err != nil {
 		log.Printf("error '%s' validating network config \n", err)
 		return err
 	}
 
+	tempRa, err := newResourceManager(stateDriver)
+	if err != nil {
+		return err
+	}
+	ra := core.ResourceManager(tempRa)
+
+	gCfg := &gstate.Cfg{}
+	gCfg.StateDriver = stateDriver
+	err = gCfg.Read(tenant.Name)
+	if err != nil {
+		log.Printf("error '%s' reading tenant cfg state \n", err)
+		return err
+	}
+
+	quotaUsage, err := readQuotaUsage(stateDriver, gCfg)
+	if err != nil {
+		return err
+	}
+
 	for _, network := range tenant.Networks {
 		nwMasterCfg := MasterNwConfig{}
 		nwMasterCfg.StateDriver = stateDriver
@@ -809,6 +1144,12 @@ func CreateEndpoints(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 				err, network.Name)
 			return err
 		}
+		err = migrateNetIpRsrc(stateDriver, ra, nwCfg)
+		if err != nil {
+			log.Printf("create eps: error '%s' migrating network %s \n",
+				err, network.Name)
+			return err
+		}
 
 		for _, ep := range network.Endpoints {
 			epCfg := &drivers.OvsCfgEndpointState{}
@@ -820,23 +1161,58 @@ func CreateEndpoints(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 				continue
 			}
 
+			err = quotaUsage.checkEndpoint()
+			if err != nil {
+				log.Printf("error '%s' creating ep %s \n", err, epCfg.Id)
+				return err
+			}
+
 			epCfg.NetId = network.Name
 			epCfg.ContName = ep.Container
 			epCfg.AttachUUID = ep.AttachUUID
 			epCfg.HomingHost = ep.Host
+			epCfg.PublishedPorts, err = publishedPorts(&ep)
+			if err == nil {
+				err = checkPublishedPorts(stateDriver, nwCfg, epCfg)
+			}
+			if err != nil {
+				log.Printf("error '%s' publishing ports of ep %s \n", err,
+					epCfg.Id)
+				return err
+			}
 
-			err = allocSetEpIp(&ep, epCfg, nwCfg)
+			err = allocSetEpIp(ra, gCfg, quotaUsage, &ep, epCfg, nwCfg)
 			if err != nil {
 				log.Printf("error '%s' allocating and/or reserving IP\n", err)
 				return err
 			}
 
+			// the endpoint's addresses and mac are freed when it isn't
+			// created, no endpoint state refers to them
+			epIps := append([]string{epCfg.IpAddress}, epCfg.SecondaryIps...)
+			if gCfg.Auto.MacPool != "" {
+				epCfg.MacAddress, err = gCfg.AllocMac(ra, epCfg.IpAddress)
+				if err != nil {
+					log.Printf("error '%s' allocating mac \n", err)
+					freeEpIps(ra, nwCfg, epIps)
+					return err
+				}
+			}
+
 			err = epCfg.Write()
 			if err != nil {
 				log.Printf("error '%s' when writing nw config \n", err)
+				freeEpIps(ra, nwCfg, epIps)
+				if epCfg.MacAddress != "" {
+					if err1 := gCfg.FreeMac(ra, epCfg.MacAddress); err1 != nil {
+						log.Printf("error '%s' freeing mac %s \n", err1,
+							epCfg.MacAddress)
+					}
+				}
 				return err
 			}
 			nwCfg.EpCount += 1
+			quotaUsage.endpoints++
 		}
 
 		err = nwCfg.Write()
@@ -849,23 +1225,53 @@ func CreateEndpoints(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 	return err
 }
 
-func freeEndpointResources(epCfg *drivers.OvsCfgEndpointState,
-	nwCfg *drivers.OvsCfgNetworkState) error {
-	ipAddrValue, err := netutils.GetIpNumber(
-		nwCfg.SubnetIp, nwCfg.SubnetLen, 32, epCfg.IpAddress)
+func freeEndpointResources(stateDriver core.StateDriver,
+	epCfg *drivers.OvsCfgEndpointState, nwCfg *drivers.OvsCfgNetworkState) error {
+
+	tempRa, err := newResourceManager(stateDriver)
+	if err != nil {
+		return err
+	}
+	ra := core.ResourceManager(tempRa)
+
+	err = migrateNetIpRsrc(stateDriver, ra, nwCfg)
 	if err != nil {
-		log.Printf("error getting host id from hostIp %s "+
-			"Subnet %s/%d err '%s'\n",
-			epCfg.IpAddress, nwCfg.SubnetIp, nwCfg.SubnetLen, err)
+		log.Printf("error '%s' migrating network %s \n", err, nwCfg.Id)
 		return err
 	}
-	nwCfg.IpAllocMap.Clear(ipAddrValue)
+	for _, ipAddress := range append([]string{epCfg.IpAddress},
+		epCfg.SecondaryIps...) {
+		err = freeNetIp(ra, nwCfg, ipAddress)
+		if err != nil {
+			log.Printf("error '%s' freeing ip %s of network %s \n",
+				err, ipAddress, nwCfg.Id)
+			return err
+		}
+	}
+
+	if epCfg.MacAddress != "" {
+		gCfg := &gstate.Cfg{}
+		gCfg.StateDriver = stateDriver
+		err = gCfg.Read(nwCfg.Tenant)
+		if err == nil {
+			err = gCfg.FreeMac(ra, epCfg.MacAddress)
+		}
+		if err != nil {
+			log.Printf("error '%s' freeing mac %s \n", err, epCfg.MacAddress)
+			return err
+		}
+	}
+
 	nwCfg.EpCount -= 1
 
 	return nil
 }
 
 func DeleteEndpointId(stateDriver core.StateDriver, epId string) error {
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	epCfg := &drivers.OvsCfgEndpointState{}
 	epCfg.StateDriver = stateDriver
 	err := epCfg.Read(epId)
@@ -880,7 +1286,7 @@ func DeleteEndpointId(stateDriver core.StateDriver, epId string) error {
 		return err
 	}
 
-	err = freeEndpointResources(epCfg, nwCfg)
+	err = freeEndpointResources(stateDriver, epCfg, nwCfg)
 	if err != nil {
 		return err
 	}
@@ -902,6 +1308,10 @@ func DeleteEndpointId(stateDriver core.StateDriver, epId string) error {
 
 func DeleteEndpoints(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	err := validateEndpointConfig(stateDriver, tenant)
 	if err != nil {
 		log.Printf("error '%s' validating network config \n", err)
@@ -936,7 +1346,7 @@ func DeleteEndpoints(stateDriver core.StateDriver, tenant *ConfigTenant) error {
 				continue
 			}
 
-			err = freeEndpointResources(epCfg, nwCfg)
+			err = freeEndpointResources(stateDriver, epCfg, nwCfg)
 			if err != nil {
 				continue
 			}
@@ -973,6 +1383,10 @@ func validateEpBindings(epBindings *[]ConfigEp) error {
 
 func CreateEpBindings(stateDriver core.StateDriver, epBindings *[]ConfigEp) error {
 
+	if err := checkLeader(); err != nil {
+		return err
+	}
+
 	err := validateEpBindings(epBindings)
 	if err != nil {
 		log.Printf("error '%s' validating the ep bindings \n", err)
@@ -290,3 +290,300 @@ func TestVxlanConfigWithLateHostBindings(t *testing.T) {
 
 	verifyKeys(t, keys)
 }
+
+func readTestEpMac(t *testing.T, epId string) string {
+	epCfg := &drivers.OvsCfgEndpointState{}
+	epCfg.StateDriver = fakeDriver
+	err := epCfg.Read(epId)
+	if err != nil {
+		t.Fatalf("error '%s' reading ep %s \n", err, epId)
+	}
+	return epCfg.MacAddress
+}
+
+func TestEndpointMacFromIp(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.MacPool = "02:02:00:00:00:00/32"
+	tenant.MacFromIp = true
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	network := ConfigNetwork{Name: "orange", SubnetCIDR: "12.1.1.0/24"}
+	tenant.Networks = []ConfigNetwork{network}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating network \n", err)
+	}
+
+	ep := ConfigEp{Container: "myContainer1", Host: "host1",
+		IpAddress: "12.1.1.5"}
+	network.Endpoints = []ConfigEp{ep}
+	tenant.Networks = []ConfigNetwork{network}
+	err = CreateEndpoints(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating ep \n", err)
+	}
+
+	epId := getEpName(&network, &ep)
+	macAddr := readTestEpMac(t, epId)
+	if macAddr != "02:02:00:00:01:05" {
+		t.Fatalf("ep allocated mac %s, expected 02:02:00:00:01:05 \n", macAddr)
+	}
+
+	// the mac is back in the pool once the endpoint is deleted
+	err = DeleteEndpointId(fakeDriver, epId)
+	if err != nil {
+		t.Fatalf("error '%s' deleting ep \n", err)
+	}
+	err = CreateEndpoints(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' recreating ep \n", err)
+	}
+	macAddr = readTestEpMac(t, epId)
+	if macAddr != "02:02:00:00:01:05" {
+		t.Fatalf("ep reallocated mac %s, expected 02:02:00:00:01:05 \n", macAddr)
+	}
+}
+
+func TestEndpointMacExhaustion(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	// a single mac in the pool
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.MacPool = "02:02:00:00:00:00/48"
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange",
+		SubnetCIDR: "12.1.1.0/24"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating network \n", err)
+	}
+
+	_, err = createTestEp(tenant, "myContainer1", "12.1.1.5")
+	if err != nil {
+		t.Fatalf("error '%s' creating ep \n", err)
+	}
+	_, err = createTestEp(tenant, "myContainer2", "12.1.1.6")
+	if err == nil {
+		t.Fatalf("created ep beyond the mac pool \n")
+	}
+
+	// the address of the endpoint that failed isn't left in use
+	err = DeleteEndpointId(fakeDriver, "orange-myContainer1")
+	if err != nil {
+		t.Fatalf("error '%s' deleting ep \n", err)
+	}
+	ip, err := createTestEp(tenant, "myContainer2", "12.1.1.6")
+	if err != nil || ip != "12.1.1.6" {
+		t.Fatalf("error '%v' creating ep, got ip %s \n", err, ip)
+	}
+}
+
+func TestTenantPoolResize(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/23", false)
+	tenant.Vlans = "11-12"
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}, {Name: "purple"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	tenant.Vlans = "12-20"
+	err = CreateTenant(fakeDriver, tenant)
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("shrinking the vlans below the ones in use, err '%v' \n", err)
+	}
+
+	tenant.Vlans = "11-13"
+	tenant.SubnetPool = "11.1.0.0/22"
+	err = CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' expanding the pools \n", err)
+	}
+
+	tenant.Networks = []ConfigNetwork{{Name: "green"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating network in the expanded pools \n", err)
+	}
+
+	nwCfg := &drivers.OvsCfgNetworkState{}
+	nwCfg.StateDriver = fakeDriver
+	err = nwCfg.Read("green")
+	if err != nil {
+		t.Fatalf("error '%s' reading network \n", err)
+	}
+	if nwCfg.PktTag != 13 || nwCfg.SubnetIp != "11.1.2.0" {
+		t.Fatalf("network allocated vlan %d subnet %s, expected 13 and 11.1.2.0 \n",
+			nwCfg.PktTag, nwCfg.SubnetIp)
+	}
+}
+
+func TestStaticVlanNetwork(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	tenant.Networks = []ConfigNetwork{{Name: "orange", PktTag: "11"},
+		{Name: "purple"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	// the static vlan is kept out of the auto allocation
+	nwCfg := &drivers.OvsCfgNetworkState{}
+	nwCfg.StateDriver = fakeDriver
+	err = nwCfg.Read("purple")
+	if err != nil || nwCfg.PktTag != 12 {
+		t.Fatalf("error '%v' reading network, got %+v, expected vlan 12 \n",
+			err, nwCfg)
+	}
+
+	for _, vlan := range []string{"11", "12", "30", "4095"} {
+		tenant.Networks = []ConfigNetwork{{Name: "blue", PktTag: vlan,
+			PktTagType: "vlan"}}
+		err = CreateNetworks(fakeDriver, tenant)
+		if err == nil {
+			t.Fatalf("created network with vlan %s \n", vlan)
+		}
+	}
+
+	// the static vlan is released along with the network
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = DeleteNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' deleting network \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "blue", PktTag: "11"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' reusing the released vlan \n", err)
+	}
+}
+
+func TestStaticVxlanNetwork(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.DefaultNetType = "vxlan"
+	tenant.Vxlans = "10001-10010"
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	tenant.Networks = []ConfigNetwork{{Name: "orange", PktTag: "10005"},
+		{Name: "purple", PktTag: "10006", LocalVlan: "5"}, {Name: "green"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	// the static vxlans and local vlans are kept out of the auto allocation
+	expTags := map[string][2]int{"orange": {10005, 1}, "purple": {10006, 5},
+		"green": {10001, 2}}
+	for netId, tags := range expTags {
+		nwCfg := &drivers.OvsCfgNetworkState{}
+		nwCfg.StateDriver = fakeDriver
+		err = nwCfg.Read(netId)
+		if err != nil || nwCfg.ExtPktTag != tags[0] || nwCfg.PktTag != tags[1] {
+			t.Fatalf("error '%v' reading network %s, got %+v, expected "+
+				"vxlan %d local vlan %d \n", err, netId, nwCfg, tags[0], tags[1])
+		}
+	}
+
+	for _, network := range []ConfigNetwork{{Name: "blue", PktTag: "10020"},
+		{Name: "blue", PktTag: "10005"},
+		{Name: "blue", PktTag: "10007", LocalVlan: "5"}} {
+		tenant.Networks = []ConfigNetwork{network}
+		err = CreateNetworks(fakeDriver, tenant)
+		if err == nil {
+			t.Fatalf("created network with vxlan %s local vlan %q \n",
+				network.PktTag, network.LocalVlan)
+		}
+	}
+
+	// the static vxlan is released along with the network
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = DeleteNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' deleting network \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "blue", PktTag: "10005",
+		LocalVlan: "1"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' reusing the released vxlan \n", err)
+	}
+}
+
+func TestTenantPoolResizeConflicts(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/23", false)
+	tenant.Vlans = "11-12"
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	other := newTestTenant("tenant-two", "11.2.0.0/23", false)
+	other.Vlans = "20-21"
+	err = CreateTenant(fakeDriver, other)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	err = SetHostVlans(fakeDriver, "100-110")
+	if err != nil {
+		t.Fatalf("error '%s' setting host vlans \n", err)
+	}
+
+	tenant.Vlans = "11-20"
+	err = CreateTenant(fakeDriver, tenant)
+	if err == nil || !strings.Contains(err.Error(), "another tenant") {
+		t.Fatalf("expanding into another tenant's vlans, err '%v' \n", err)
+	}
+	tenant.Vlans = "11-12,105-106"
+	err = CreateTenant(fakeDriver, tenant)
+	if err == nil || !strings.Contains(err.Error(), "set aside") {
+		t.Fatalf("expanding into the host vlans, err '%v' \n", err)
+	}
+	tenant.Vlans = "11-13"
+
+	tenant.MacPool = "02:02:00:00:00:00/32"
+	err = CreateTenant(fakeDriver, tenant)
+	if err == nil || !strings.Contains(err.Error(), "mac pool") {
+		t.Fatalf("changing the mac pool, err '%v' \n", err)
+	}
+	tenant.MacPool = ""
+
+	tenant.AllocStrategy = "round-robin"
+	err = CreateTenant(fakeDriver, tenant)
+	if err == nil || !strings.Contains(err.Error(), "allocation strategy") {
+		t.Fatalf("changing the allocation strategy, err '%v' \n", err)
+	}
+	tenant.AllocStrategy = ""
+
+	err = CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' expanding the vlans \n", err)
+	}
+}
@@ -0,0 +1,203 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/contiv/netplugin/resources"
+)
+
+// a network of a subnet of the tenant's subnet pool grows by another subnet of
+// the pool when its addresses run out, the allocation of addresses spilling
+// into the new subnet; the networks of other static subnets don't grow. Each
+// subnet has an ip resource of its own, the one of the network's first subnet
+// is keyed by the network id and the others by the network id and the subnet.
+// The subnets a network grew by are kept until the network is deleted.
+
+// subnetIpRsrcId returns the id of the ip resource of one of the subnets a
+// network grew by
+func subnetIpRsrcId(netId, subnetIp string) string {
+	return netId + "-" + subnetIp
+}
+
+// netIpRsrcIds returns the ids of the ip resources of the network's subnets,
+// in the order the addresses are allocated from
+func netIpRsrcIds(nwCfg *drivers.OvsCfgNetworkState) []string {
+	rsrcIds := []string{nwCfg.Id}
+	for _, subnet := range nwCfg.ExtraSubnets {
+		subnetIp, _, _ := netutils.ParseCIDR(subnet)
+		rsrcIds = append(rsrcIds, subnetIpRsrcId(nwCfg.Id, subnetIp))
+	}
+	return rsrcIds
+}
+
+// ipRsrcIdOf returns the id of the ip resource of the network's subnet an
+// address belongs to
+func ipRsrcIdOf(nwCfg *drivers.OvsCfgNetworkState, ipAddress string) (string,
+	error) {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return "", &core.Error{Desc: fmt.Sprintf("invalid ip %q", ipAddress)}
+	}
+	for _, subnet := range nwCfg.ExtraSubnets {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err == nil && ipNet.Contains(ip) {
+			return subnetIpRsrcId(nwCfg.Id, ipNet.IP.String()), nil
+		}
+	}
+	return nwCfg.Id, nil
+}
+
+// growNetwork adds a subnet of the tenant's subnet pool to the network,
+// returning the id of the ip resource of the new subnet
+func growNetwork(ra core.ResourceManager, gCfg *gstate.Cfg, quota *quotaUsage,
+	nwCfg *drivers.OvsCfgNetworkState) (string, error) {
+	err := quota.checkSubnet()
+	if err != nil {
+		return "", err
+	}
+
+	subnetIp, err := gCfg.AllocSubnet(ra, nwCfg.Id)
+	if err != nil {
+		return "", err
+	}
+	rsrcId := subnetIpRsrcId(nwCfg.Id, subnetIp)
+	err = ra.DefineResource(rsrcId, resources.AUTO_IP_RSRC,
+		subnetIpRsrcCfg(subnetIp, gCfg.Auto.AllocSubnetLen))
+	if err != nil {
+		gCfg.FreeSubnet(ra, subnetIp)
+		return "", err
+	}
+
+	log.Printf("network %s grew by subnet %s/%d \n", nwCfg.Id, subnetIp,
+		gCfg.Auto.AllocSubnetLen)
+	nwCfg.ExtraSubnets = append(nwCfg.ExtraSubnets,
+		fmt.Sprintf("%s/%d", subnetIp, gCfg.Auto.AllocSubnetLen))
+	quota.subnets++
+
+	// the subnet is recorded right away, so that it is freed along with the
+	// network whatever happens to the endpoint that needed it
+	err = nwCfg.Write()
+	if err != nil {
+		return "", err
+	}
+	return rsrcId, nil
+}
+
+// allocNetIp allocates an address from the first of the network's subnets
+// with addresses left, growing the network when none has
+func allocNetIp(ra core.ResourceManager, gCfg *gstate.Cfg, quota *quotaUsage,
+	nwCfg *drivers.OvsCfgNetworkState) (string, error) {
+	var ip interface{}
+	var err error
+
+	for _, rsrcId := range netIpRsrcIds(nwCfg) {
+		ip, err = ra.AllocateResourceVal(rsrcId, resources.AUTO_IP_RSRC)
+		if err == nil {
+			return ip.(net.IP).String(), nil
+		}
+	}
+	if !gCfg.SubnetInPool(nwCfg.SubnetIp, nwCfg.SubnetLen) {
+		return "", err
+	}
+
+	rsrcId, err := growNetwork(ra, gCfg, quota, nwCfg)
+	if err != nil {
+		return "", err
+	}
+	ip, err = ra.AllocateResourceVal(rsrcId, resources.AUTO_IP_RSRC)
+	if err != nil {
+		return "", err
+	}
+	return ip.(net.IP).String(), nil
+}
+
+// reserveNetIp takes a static address out of the network's subnet it belongs
+// to
+func reserveNetIp(ra core.ResourceManager, nwCfg *drivers.OvsCfgNetworkState,
+	ipAddress string) error {
+	rsrcId, err := ipRsrcIdOf(nwCfg, ipAddress)
+	if err != nil {
+		return err
+	}
+	return ra.ReserveResourceVal(rsrcId, resources.AUTO_IP_RSRC,
+		net.ParseIP(ipAddress), "")
+}
+
+// freeNetIp frees an address back to the network's subnet it belongs to
+func freeNetIp(ra core.ResourceManager, nwCfg *drivers.OvsCfgNetworkState,
+	ipAddress string) error {
+	rsrcId, err := ipRsrcIdOf(nwCfg, ipAddress)
+	if err != nil {
+		return err
+	}
+	return ra.DeallocateResourceVal(rsrcId, resources.AUTO_IP_RSRC,
+		net.ParseIP(ipAddress))
+}
+
+// shrinkNetwork frees the subnets the network grew by beyond its first
+// numSubnets ones, like the ones grown for an endpoint that failed to be
+// created
+func shrinkNetwork(ra core.ResourceManager, gCfg *gstate.Cfg, quota *quotaUsage,
+	nwCfg *drivers.OvsCfgNetworkState, numSubnets int) error {
+	if len(nwCfg.ExtraSubnets) <= numSubnets {
+		return nil
+	}
+
+	grown := nwCfg.ExtraSubnets[numSubnets:]
+	err := freeSubnets(ra, gCfg, nwCfg.Id, grown)
+	if err != nil {
+		return err
+	}
+	quota.subnets -= uint(len(grown))
+	nwCfg.ExtraSubnets = nwCfg.ExtraSubnets[:numSubnets]
+	return nwCfg.Write()
+}
+
+// freeNetSubnets frees the subnets the network grew by back to the tenant's
+// subnet pool
+func freeNetSubnets(ra core.ResourceManager, gCfg *gstate.Cfg,
+	nwCfg *drivers.OvsCfgNetworkState) error {
+	return freeSubnets(ra, gCfg, nwCfg.Id, nwCfg.ExtraSubnets)
+}
+
+func freeSubnets(ra core.ResourceManager, gCfg *gstate.Cfg, nwId string,
+	subnets []string) error {
+	for _, subnet := range subnets {
+		subnetIp, _, err := netutils.ParseCIDR(subnet)
+		if err != nil {
+			return err
+		}
+		err = ra.UndefineResource(subnetIpRsrcId(nwId, subnetIp),
+			resources.AUTO_IP_RSRC)
+		if err != nil {
+			log.Printf("error '%s' freeing ips of subnet %s \n", err, subnet)
+		}
+		log.Printf("freeing subnet %s \n", subnet)
+		err = gCfg.FreeSubnet(ra, subnetIp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+)
+
+func createTestEps(t *testing.T, tenant *ConfigTenant,
+	eps ...ConfigEp) []*drivers.OvsCfgEndpointState {
+	network := tenant.Networks[0]
+	network.Endpoints = eps
+	err := CreateEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		t.Fatalf("error '%s' creating eps \n", err)
+	}
+
+	epCfgs := []*drivers.OvsCfgEndpointState{}
+	for _, ep := range eps {
+		epCfg := &drivers.OvsCfgEndpointState{}
+		epCfg.StateDriver = fakeDriver
+		err = epCfg.Read(getEpName(&network, &ep))
+		if err != nil {
+			t.Fatalf("error '%s' reading ep \n", err)
+		}
+		epCfgs = append(epCfgs, epCfg)
+	}
+	return epCfgs
+}
+
+func readTestNetwork(t *testing.T, netId string) *drivers.OvsCfgNetworkState {
+	nwCfg := &drivers.OvsCfgNetworkState{}
+	nwCfg.StateDriver = fakeDriver
+	err := nwCfg.Read(netId)
+	if err != nil {
+		t.Fatalf("error '%s' reading network \n", err)
+	}
+	return nwCfg
+}
+
+func TestNetworkGrowth(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	// two addresses per subnet
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.AllocSubnetLen = 30
+	tenant.MaxSubnets = 2
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	epCfgs := createTestEps(t, tenant, ConfigEp{Container: "myContainer1"},
+		ConfigEp{Container: "myContainer2", SecondaryIpCount: 2})
+	if epCfgs[0].IpAddress != "11.1.0.1" || epCfgs[1].IpAddress != "11.1.0.2" ||
+		!reflect.DeepEqual(epCfgs[1].SecondaryIps,
+			[]string{"11.1.0.5", "11.1.0.6"}) {
+		t.Fatalf("allocated %+v and %+v, expected the allocation to spill "+
+			"into a new subnet \n", epCfgs[0], epCfgs[1])
+	}
+	nwCfg := readTestNetwork(t, "orange")
+	if !reflect.DeepEqual(nwCfg.Subnets(),
+		[]string{"11.1.0.0/30", "11.1.0.4/30"}) || nwCfg.EpCount != 2 {
+		t.Fatalf("network %+v, expected it to grow by 11.1.0.4/30 \n", nwCfg)
+	}
+
+	// the network can't grow beyond the tenant's quota of subnets
+	network := ConfigNetwork{Name: "orange",
+		Endpoints: []ConfigEp{{Container: "myContainer3"}}}
+	err = CreateEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	verifyQuotaExceeded(t, err, QUOTA_SUBNETS)
+
+	// the addresses freed in the grown subnet are allocated again
+	network.Endpoints = []ConfigEp{{Container: "myContainer2"}}
+	err = DeleteEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		t.Fatalf("error '%s' deleting ep \n", err)
+	}
+	epCfgs = createTestEps(t, tenant, ConfigEp{Container: "myContainer3",
+		SecondaryIpCount: 1}, ConfigEp{Container: "myContainer4"})
+	if epCfgs[0].IpAddress != "11.1.0.2" ||
+		!reflect.DeepEqual(epCfgs[0].SecondaryIps, []string{"11.1.0.5"}) ||
+		epCfgs[1].IpAddress != "11.1.0.6" {
+		t.Fatalf("allocated %+v and %+v, expected the freed ips \n",
+			epCfgs[0], epCfgs[1])
+	}
+
+	// the subnets the network grew by are freed along with it
+	network.Endpoints = []ConfigEp{{Container: "myContainer1"},
+		{Container: "myContainer3"}, {Container: "myContainer4"}}
+	err = DeleteEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		t.Fatalf("error '%s' deleting eps \n", err)
+	}
+	err = DeleteNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' deleting network \n", err)
+	}
+	quotas, err := GetTenantQuotas(fakeDriver, tenant.Name)
+	if err != nil || quotas[4].Used != 0 {
+		t.Fatalf("error '%v' getting quotas %+v, expected no subnets \n",
+			err, quotas)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "purple"}, {Name: "blue"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	nwCfg = readTestNetwork(t, "blue")
+	if nwCfg.SubnetIp != "11.1.0.4" {
+		t.Fatalf("network %+v, expected the freed subnet 11.1.0.4 \n", nwCfg)
+	}
+}
+
+func TestNetworkGrowthRollback(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.AllocSubnetLen = 30
+	tenant.MaxSubnets = 2
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	createTestEps(t, tenant, ConfigEp{Container: "myContainer1"})
+
+	// the third secondary ip needs a subnet beyond the quota, the addresses
+	// and the subnet allocated for the endpoint are freed
+	network := ConfigNetwork{Name: "orange", Endpoints: []ConfigEp{
+		{Container: "myContainer2", SecondaryIpCount: 3}}}
+	err = CreateEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	verifyQuotaExceeded(t, err, QUOTA_SUBNETS)
+	nwCfg := readTestNetwork(t, "orange")
+	if !reflect.DeepEqual(nwCfg.Subnets(), []string{"11.1.0.0/30"}) {
+		t.Fatalf("network %+v, expected the grown subnet to be freed \n",
+			nwCfg)
+	}
+
+	epCfgs := createTestEps(t, tenant, ConfigEp{Container: "myContainer2",
+		SecondaryIpCount: 2})
+	if epCfgs[0].IpAddress != "11.1.0.2" ||
+		!reflect.DeepEqual(epCfgs[0].SecondaryIps,
+			[]string{"11.1.0.5", "11.1.0.6"}) {
+		t.Fatalf("allocated %+v, expected the freed ips \n", epCfgs[0])
+	}
+}
+
+func TestSecondaryIps(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := createTestReservedNetwork(t, ConfigNetwork{Name: "orange",
+		SubnetCIDR: "12.1.1.0/24", ReservedIps: []string{"12.1.1.2"}})
+
+	epCfgs := createTestEps(t, tenant, ConfigEp{Container: "myContainer1",
+		IpAddress: "12.1.1.10", SecondaryIps: []string{"12.1.1.11"},
+		SecondaryIpCount: 1})
+	if !reflect.DeepEqual(epCfgs[0].SecondaryIps,
+		[]string{"12.1.1.11", "12.1.1.1"}) {
+		t.Fatalf("ep %+v, expected secondary ips 12.1.1.11 and 12.1.1.1 \n",
+			epCfgs[0])
+	}
+
+	for _, ipAddress := range []string{"12.1.1.11", "12.1.1.2", "12.1.2.1"} {
+		network := tenant.Networks[0]
+		network.Endpoints = []ConfigEp{{Container: "myContainer2",
+			SecondaryIps: []string{ipAddress}}}
+		err := CreateEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+			Networks: []ConfigNetwork{network}})
+		if err == nil {
+			t.Fatalf("created ep with secondary ip %s \n", ipAddress)
+		}
+	}
+
+	// the secondary ips are freed along with the endpoint
+	network := tenant.Networks[0]
+	network.Endpoints = []ConfigEp{{Container: "myContainer1"}}
+	err := DeleteEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+		Networks: []ConfigNetwork{network}})
+	if err != nil {
+		t.Fatalf("error '%s' deleting ep \n", err)
+	}
+	ip, err := createTestEp(tenant, "myContainer2", "12.1.1.11")
+	if err != nil || ip != "12.1.1.11" {
+		t.Fatalf("error '%v' reusing the freed secondary ip, got %s \n",
+			err, ip)
+	}
+}
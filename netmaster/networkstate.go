@@ -36,12 +36,19 @@ const (
 
 type MasterNwConfig struct {
 	state.CommonState
-	Tenant     string `json:"tenant"`
-	PktTagType string `json:"pktTagType"`
-	PktTag     string `json:"pktTag"`
-	SubnetIp   string `json:"subnetIp"`
-	SubnetLen  uint   `json:"subnetLen"`
-	DefaultGw  string `json:"defaultGw"`
+	Tenant      string `json:"tenant"`
+	PktTagType  string `json:"pktTagType"`
+	PktTag      string `json:"pktTag"`
+	LocalVlan   string `json:"localVlan"`
+	SubnetIp    string `json:"subnetIp"`
+	SubnetLen   uint   `json:"subnetLen"`
+	DefaultGw   string `json:"defaultGw"`
+	OutboundNat bool   `json:"outboundNat"`
+	// addresses kept out of the endpoints' allocation
+	ReservedIps      []string `json:"reservedIps"`
+	ExcludedIpRanges []string `json:"excludedIpRanges"`
+	IpAllocStart     string   `json:"ipAllocStart"`
+	IpAllocEnd       string   `json:"ipAllocEnd"`
 }
 
 func (s MasterNwConfig) Key() string {
@@ -0,0 +1,211 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/netutils"
+)
+
+// parsing and offline validation of the intent files. The intent can be
+// written in json or yaml, and is decoded strictly: an unknown or misspelled
+// field is reported along with its line. The field names of a json intent
+// are matched regardless of their case, as they always were, the ones of a
+// yaml intent are matched exactly.
+
+const (
+	jsonUnknownFieldPrefix = "json: unknown field "
+)
+
+// isJson tells a json intent, an object or a list, from a yaml one
+func isJson(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && (data[0] == '{' || data[0] == '[')
+}
+
+// jsonErrLine returns the line of a json intent a decoding error is at, 0 if
+// it can't be told
+func jsonErrLine(data []byte, err error) int {
+	offset := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		// the decoder reports no offset for an unknown field, the field
+		// is looked up instead
+		if !strings.HasPrefix(err.Error(), jsonUnknownFieldPrefix) {
+			break
+		}
+		field, err := strconv.Unquote(strings.TrimPrefix(err.Error(),
+			jsonUnknownFieldPrefix))
+		if err == nil {
+			offset = int64(bytes.Index(data, []byte(strconv.Quote(field))))
+		}
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return 0
+	}
+	return 1 + bytes.Count(data[:offset], []byte("\n"))
+}
+
+func parseJsonStrict(data []byte, out interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(out)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return nil
+		}
+		return errors.New("json: unexpected data after the intent")
+	}
+	if line := jsonErrLine(data, err); line > 0 {
+		return fmt.Errorf("json: line %d: %s", line,
+			strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return err
+}
+
+func parseStrict(data []byte, out interface{}) error {
+	var err error
+	if isJson(data) {
+		err = parseJsonStrict(data, out)
+	} else {
+		err = yaml.UnmarshalStrict(data, out)
+	}
+	if err != nil {
+		return &core.Error{Desc: fmt.Sprintf("error parsing intent: %s", err)}
+	}
+	return nil
+}
+
+// ParseConfig decodes a json or yaml intent into a Config
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	err := parseStrict(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ParseEpBindings decodes a json or yaml list of container to host bindings
+func ParseEpBindings(data []byte) ([]ConfigEp, error) {
+	epBindings := []ConfigEp{}
+	err := parseStrict(data, &epBindings)
+	if err != nil {
+		return nil, err
+	}
+	return epBindings, nil
+}
+
+func validateEndpoint(ep *ConfigEp) error {
+	if ep.Container == "" {
+		return errors.New("invalid container name for the endpoint")
+	}
+	if ep.IpAddress != "" && net.ParseIP(ep.IpAddress) == nil {
+		return errors.New("invalid ep IP")
+	}
+	for _, ipAddress := range ep.SecondaryIps {
+		if net.ParseIP(ipAddress) == nil {
+			return errors.New("invalid ep secondary IP")
+		}
+	}
+	_, err := publishedPorts(ep)
+	return err
+}
+
+// staticEpIps returns the static addresses of an endpoint, its address and
+// its static secondary addresses
+func staticEpIps(ep *ConfigEp) []string {
+	if ep.IpAddress == "" {
+		return ep.SecondaryIps
+	}
+	return append([]string{ep.IpAddress}, ep.SecondaryIps...)
+}
+
+// ValidateConfig performs the validations done when applying the intent,
+// without requiring access to the state. Validations that depend on the
+// state, like that of an endpoint's address against a previously created
+// network, are done against the rest of the intent instead.
+func ValidateConfig(cfg *Config) error {
+	if cfg.HostVlans != "" {
+		_, err := netutils.ParseTagRanges(cfg.HostVlans, "vlan")
+		if err != nil {
+			return &core.Error{Desc: fmt.Sprintf("host vlans: %s", err)}
+		}
+	}
+
+	for _, host := range cfg.Hosts {
+		err := validateHostConfig(&host)
+		if err != nil {
+			return &core.Error{Desc: fmt.Sprintf("host %q: %s", host.Name, err)}
+		}
+	}
+
+	for _, tenant := range cfg.Tenants {
+		err := validateTenantConfig(&tenant)
+		if err != nil {
+			return &core.Error{Desc: fmt.Sprintf("tenant %q: %s", tenant.Name, err)}
+		}
+
+		err = validateNetworkConfig(&tenant)
+		if err != nil {
+			return &core.Error{Desc: fmt.Sprintf("tenant %q: %s", tenant.Name, err)}
+		}
+
+		for _, network := range tenant.Networks {
+			if tenant.DistributedRouting || network.OutboundNat {
+				err = validateNetworkGw(&network)
+				if err != nil {
+					return &core.Error{Desc: fmt.Sprintf("network %q: %s",
+						network.Name, err)}
+				}
+			}
+			for _, ep := range network.Endpoints {
+				err = validateEndpoint(&ep)
+				ipAddresses := staticEpIps(&ep)
+				if err == nil && len(ipAddresses) > 0 && network.SubnetCIDR == "" {
+					err = errors.New("found ep with ip for auto-allocated net")
+				}
+				for _, ipAddress := range ipAddresses {
+					if err == nil {
+						err = validateEpIp(ipAddress, network.SubnetCIDR,
+							network.ReservedIps, network.ExcludedIpRanges)
+					}
+				}
+				if err != nil {
+					return &core.Error{Desc: fmt.Sprintf("network %q endpoint %q: %s",
+						network.Name, ep.Container, err)}
+				}
+			}
+		}
+	}
+
+	return validateAddrSpace(cfg)
+}
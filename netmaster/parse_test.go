@@ -0,0 +1,176 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testJsonIntent = `{
+    "Hosts" : [{
+        "Name"                      : "host1",
+        "VtepIp"                    : "192.168.2.10"
+    }],
+    "Tenants" : [{
+        "Name"                      : "tenant-one",
+        "DefaultNetType"            : "vxlan",
+        "SubnetPool"                : "11.1.0.0/16",
+        "AllocSubnetLen"            : 24,
+        "Vxlans"                    : "10001-14000",
+        "Networks"  : [{
+            "Name"                  : "orange",
+            "SubnetCIDR"            : "12.1.1.0/24",
+            "Endpoints" : [{
+                "Host"              : "host1",
+                "Container"         : "myContainer1",
+                "IpAddress"         : "12.1.1.10"
+            }]
+        }]
+    }]}`
+
+	testYamlIntent = `
+Hosts:
+  - Name: host1
+    VtepIp: 192.168.2.10
+Tenants:
+  - Name: tenant-one
+    DefaultNetType: vxlan
+    SubnetPool: 11.1.0.0/16
+    AllocSubnetLen: 24
+    Vxlans: 10001-14000
+    Networks:
+      - Name: orange
+        SubnetCIDR: 12.1.1.0/24
+        Endpoints:
+          - Host: host1
+            Container: myContainer1
+            IpAddress: 12.1.1.10
+`
+)
+
+func TestParseConfigJsonAndYaml(t *testing.T) {
+	expCfg := &Config{}
+	err := json.Unmarshal([]byte(testJsonIntent), expCfg)
+	if err != nil {
+		t.Fatalf("error '%s' unmarshalling json intent \n", err)
+	}
+
+	jsonCfg, err := ParseConfig([]byte(testJsonIntent))
+	if err != nil {
+		t.Fatalf("error '%s' parsing json intent \n", err)
+	}
+	if !reflect.DeepEqual(expCfg, jsonCfg) {
+		t.Fatalf("parsed json intent %+v, expected %+v \n", jsonCfg, expCfg)
+	}
+
+	yamlCfg, err := ParseConfig([]byte(testYamlIntent))
+	if err != nil {
+		t.Fatalf("error '%s' parsing yaml intent \n", err)
+	}
+	if !reflect.DeepEqual(expCfg, yamlCfg) {
+		t.Fatalf("parsed yaml intent %+v, expected %+v \n", yamlCfg, expCfg)
+	}
+}
+
+func TestParseConfigUnknownField(t *testing.T) {
+	intent := strings.Replace(testJsonIntent, `"Vxlans"`, `"Vxlan"`, 1)
+	_, err := ParseConfig([]byte(intent))
+	if err == nil {
+		t.Fatalf("misspelled field was accepted \n")
+	}
+	if !strings.Contains(err.Error(), "line 11") ||
+		!strings.Contains(err.Error(), "Vxlan") {
+		t.Fatalf("error '%s' doesn't point to the misspelled field \n", err)
+	}
+
+	// the field names of a json intent are matched regardless of their case
+	expCfg, err := ParseConfig([]byte(testJsonIntent))
+	if err != nil {
+		t.Fatalf("error '%s' parsing json intent \n", err)
+	}
+	intent = strings.Replace(testJsonIntent, `"Vxlans"`, `"VXlans"`, 1)
+	cfg, err := ParseConfig([]byte(intent))
+	if err != nil {
+		t.Fatalf("error '%s' parsing json intent with a field's case changed \n",
+			err)
+	}
+	if !reflect.DeepEqual(cfg, expCfg) {
+		t.Fatalf("parsed json intent %+v, expected %+v \n", cfg, expCfg)
+	}
+
+	intent = strings.Replace(testYamlIntent, "IpAddress", "IpAddr", 1)
+	_, err = ParseConfig([]byte(intent))
+	if err == nil || !strings.Contains(err.Error(), "line 17") {
+		t.Fatalf("unexpected error '%v' for misspelled yaml field \n", err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testJsonIntent))
+	if err != nil {
+		t.Fatalf("error '%s' parsing intent \n", err)
+	}
+	err = ValidateConfig(cfg)
+	if err != nil {
+		t.Fatalf("error '%s' validating a valid intent \n", err)
+	}
+
+	invalidIntents := map[string]string{
+		"invalid pool":       `"SubnetPool"                : "11.1.0.0/16"`,
+		"invalid ep ip":      `"IpAddress"         : "12.1.1.10"`,
+		"ip for auto subnet": `"SubnetCIDR"            : "12.1.1.0/24"`,
+		"host without intf":  `"VtepIp"                    : "192.168.2.10"`,
+	}
+	replacements := map[string]string{
+		"invalid pool":       `"SubnetPool"                : "11.1.0.0"`,
+		"invalid ep ip":      `"IpAddress"         : "12.1.1"`,
+		"ip for auto subnet": `"DefaultGw"             : "12.1.1.254"`,
+		"host without intf":  `"NetId"                     : "infra"`,
+	}
+	for name, orig := range invalidIntents {
+		intent := strings.Replace(testJsonIntent, orig, replacements[name], 1)
+		cfg, err := ParseConfig([]byte(intent))
+		if err != nil {
+			t.Fatalf("%s: error '%s' parsing intent \n", name, err)
+		}
+		if ValidateConfig(cfg) == nil {
+			t.Fatalf("%s: invalid intent passed validation \n", name)
+		}
+	}
+}
+
+func TestPublishedSchema(t *testing.T) {
+	schema, err := ConfigSchema()
+	if err != nil {
+		t.Fatalf("error '%s' generating schema \n", err)
+	}
+
+	published, err := ioutil.ReadFile(filepath.Join("..", "docs",
+		"netmaster-config.schema.json"))
+	if err != nil {
+		t.Fatalf("error '%s' reading published schema \n", err)
+	}
+	if string(schema) != string(published) {
+		t.Fatalf("published schema is out of date, regenerate it with " +
+			"'netdcli -cfg-schema' \n")
+	}
+}
@@ -0,0 +1,102 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+)
+
+// the ports an endpoint publishes are translated to the endpoint's address on
+// its host when the endpoint is attached. The replies reach the outside world
+// through the network's gateway on the host, so only the endpoints of a
+// network with outbound nat can publish ports.
+
+// publishedPorts returns the ports an endpoint publishes, as
+// 'hostPort:containerPort/protocol'
+func publishedPorts(ep *ConfigEp) ([]string, error) {
+	var ports []string
+	hostPorts := make(map[string]bool)
+	for _, mapping := range ep.PublishedPorts {
+		hostPort, contPort, protocol, err := netutils.ParsePortMapping(mapping)
+		if err != nil {
+			return nil, err
+		}
+		if hostPorts[hostPortOf(hostPort, protocol)] {
+			return nil, &core.Error{Desc: fmt.Sprintf("host port %s is "+
+				"published twice", hostPortOf(hostPort, protocol))}
+		}
+		hostPorts[hostPortOf(hostPort, protocol)] = true
+		ports = append(ports, fmt.Sprintf("%d:%d/%s", hostPort, contPort,
+			protocol))
+	}
+	return ports, nil
+}
+
+func hostPortOf(hostPort uint, protocol string) string {
+	return fmt.Sprintf("%d/%s", hostPort, protocol)
+}
+
+// checkPublishedPorts checks that an endpoint's network has outbound nat and
+// that no other endpoint of its host publishes the same host ports. The ports
+// of an endpoint without a host are only checked once it is attached, by the
+// host's iptables.
+func checkPublishedPorts(stateDriver core.StateDriver,
+	nwCfg *drivers.OvsCfgNetworkState, epCfg *drivers.OvsCfgEndpointState) error {
+	if len(epCfg.PublishedPorts) == 0 {
+		return nil
+	}
+	if !nwCfg.OutboundNat {
+		return &core.Error{Desc: fmt.Sprintf("network %s has no outbound nat "+
+			"to publish ports through", nwCfg.Id)}
+	}
+	if epCfg.HomingHost == "" {
+		return nil
+	}
+
+	readEp := &drivers.OvsCfgEndpointState{}
+	readEp.StateDriver = stateDriver
+	epCfgs, err := readAllOrNone(readEp)
+	if err != nil {
+		return err
+	}
+
+	published := make(map[string]string)
+	for _, state := range epCfgs {
+		cfg := state.(*drivers.OvsCfgEndpointState)
+		if cfg.HomingHost != epCfg.HomingHost || cfg.Id == epCfg.Id {
+			continue
+		}
+		for _, port := range cfg.PublishedPorts {
+			hostPort, _, protocol, err := netutils.ParsePortMapping(port)
+			if err == nil {
+				published[hostPortOf(hostPort, protocol)] = cfg.Id
+			}
+		}
+	}
+	for _, port := range epCfg.PublishedPorts {
+		hostPort, _, protocol, _ := netutils.ParsePortMapping(port)
+		if epId, found := published[hostPortOf(hostPort, protocol)]; found {
+			return &core.Error{Desc: fmt.Sprintf("host port %s of host %s is "+
+				"published by ep %s", hostPortOf(hostPort, protocol),
+				epCfg.HomingHost, epId)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublishedPorts(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange", OutboundNat: true},
+		{Name: "purple"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+
+	epCfgs := createTestEps(t, tenant, ConfigEp{Container: "myContainer1",
+		Host: "host1", PublishedPorts: []string{"8080:80", "53:53/udp"}},
+		ConfigEp{Container: "myContainer2", Host: "host1",
+			PublishedPorts: []string{"8080:80/udp"}},
+		ConfigEp{Container: "myContainer3", Host: "host2",
+			PublishedPorts: []string{"8080:80"}})
+	if !reflect.DeepEqual(epCfgs[0].PublishedPorts,
+		[]string{"8080:80/tcp", "53:53/udp"}) {
+		t.Fatalf("ep %+v, expected ports 8080:80/tcp and 53:53/udp \n",
+			epCfgs[0])
+	}
+
+	// a host port is published once per host and protocol, and only through
+	// a network with outbound nat
+	for _, network := range []ConfigNetwork{
+		{Name: "orange", Endpoints: []ConfigEp{{Container: "myContainer4",
+			Host: "host1", PublishedPorts: []string{"8080:8080"}}}},
+		{Name: "orange", Endpoints: []ConfigEp{{Container: "myContainer4",
+			PublishedPorts: []string{"8080:80", "8080:8080"}}}},
+		{Name: "orange", Endpoints: []ConfigEp{{Container: "myContainer4",
+			PublishedPorts: []string{"8080"}}}},
+		{Name: "purple", Endpoints: []ConfigEp{{Container: "myContainer4",
+			PublishedPorts: []string{"8081:80"}}}}} {
+		err = CreateEndpoints(fakeDriver, &ConfigTenant{Name: tenant.Name,
+			Networks: []ConfigNetwork{network}})
+		if err == nil {
+			t.Fatalf("published ports of ep %+v \n", network.Endpoints[0])
+		}
+	}
+
+	cfg, err := ExportConfig(fakeDriver, false)
+	if err != nil {
+		t.Fatalf("error '%s' exporting config \n", err)
+	}
+	ep := cfg.Tenants[0].Networks[0].Endpoints[0]
+	if !reflect.DeepEqual(ep.PublishedPorts, epCfgs[0].PublishedPorts) {
+		t.Fatalf("exported ep %+v, expected its published ports \n", ep)
+	}
+}
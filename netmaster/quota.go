@@ -0,0 +1,164 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"fmt"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+)
+
+const (
+	QUOTA_NETWORKS  = "networks"
+	QUOTA_ENDPOINTS = "endpoints"
+	QUOTA_VLANS     = "vlans"
+	QUOTA_VXLANS    = "vxlans"
+	QUOTA_SUBNETS   = "subnets"
+)
+
+// QuotaUsage reports how much of a resource a tenant uses against its quota,
+// a zero limit is unlimited
+type QuotaUsage struct {
+	Resource string `json:"resource"`
+	Used     uint   `json:"used"`
+	Limit    uint   `json:"limit"`
+}
+
+// the use of the quota'd resources by the networks of a tenant
+type quotaUsage struct {
+	tenant    string
+	quota     gstate.QuotaParams
+	networks  uint
+	endpoints uint
+	vlans     uint
+	vxlans    uint
+	subnets   uint
+}
+
+func tenantQuota(tenant *ConfigTenant) gstate.QuotaParams {
+	return gstate.QuotaParams{
+		MaxNetworks:  tenant.MaxNetworks,
+		MaxEndpoints: tenant.MaxEndpoints,
+		MaxVlans:     tenant.MaxVlans,
+		MaxVxlans:    tenant.MaxVxlans,
+		MaxSubnets:   tenant.MaxSubnets}
+}
+
+// readQuotaUsage counts the networks, endpoints, vlan and vxlan networks and
+// subnets of a tenant, including the subnets the networks grew by
+func readQuotaUsage(stateDriver core.StateDriver, gCfg *gstate.Cfg) (*quotaUsage,
+	error) {
+	usage := &quotaUsage{tenant: gCfg.Tenant, quota: gCfg.Quota}
+
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = stateDriver
+	states, err := readAllOrNone(readNet)
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range states {
+		nwCfg := state.(*drivers.OvsCfgNetworkState)
+		if nwCfg.Tenant != gCfg.Tenant {
+			continue
+		}
+		usage.addNetwork(nwCfg.PktTagType, nwCfg.SubnetIp != "")
+		usage.subnets += uint(len(nwCfg.ExtraSubnets))
+		usage.endpoints += uint(nwCfg.EpCount)
+	}
+
+	return usage, nil
+}
+
+func (u *quotaUsage) check(resource string, used, limit uint) error {
+	if limit != 0 && used >= limit {
+		return &core.Error{Desc: fmt.Sprintf(
+			"tenant %s exceeds its quota of %d %s", u.tenant, limit, resource)}
+	}
+	return nil
+}
+
+// checkNetwork fails if one more network of the packet tag type, with a
+// subnet or not, exceeds a quota of the tenant
+func (u *quotaUsage) checkNetwork(pktTagType string, hasSubnet bool) error {
+	err := u.check(QUOTA_NETWORKS, u.networks, u.quota.MaxNetworks)
+	if err != nil {
+		return err
+	}
+	if pktTagType == "vlan" {
+		err = u.check(QUOTA_VLANS, u.vlans, u.quota.MaxVlans)
+	} else if pktTagType == "vxlan" {
+		err = u.check(QUOTA_VXLANS, u.vxlans, u.quota.MaxVxlans)
+	}
+	if err != nil {
+		return err
+	}
+	if hasSubnet {
+		return u.checkSubnet()
+	}
+	return nil
+}
+
+func (u *quotaUsage) addNetwork(pktTagType string, hasSubnet bool) {
+	u.networks++
+	if pktTagType == "vlan" {
+		u.vlans++
+	} else if pktTagType == "vxlan" {
+		u.vxlans++
+	}
+	if hasSubnet {
+		u.subnets++
+	}
+}
+
+// checkSubnet fails if one more subnet, e.g. one a network grows by, exceeds
+// the tenant's quota of subnets
+func (u *quotaUsage) checkSubnet() error {
+	return u.check(QUOTA_SUBNETS, u.subnets, u.quota.MaxSubnets)
+}
+
+func (u *quotaUsage) checkEndpoint() error {
+	return u.check(QUOTA_ENDPOINTS, u.endpoints, u.quota.MaxEndpoints)
+}
+
+// GetTenantQuotas reports the use of the tenant's networks, endpoints, vlan
+// and vxlan networks and subnets against its quotas
+func GetTenantQuotas(stateDriver core.StateDriver, tenant string) ([]QuotaUsage,
+	error) {
+	gCfg := &gstate.Cfg{}
+	gCfg.StateDriver = stateDriver
+	err := gCfg.Read(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := readQuotaUsage(stateDriver, gCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return []QuotaUsage{
+		{Resource: QUOTA_NETWORKS, Used: usage.networks,
+			Limit: gCfg.Quota.MaxNetworks},
+		{Resource: QUOTA_ENDPOINTS, Used: usage.endpoints,
+			Limit: gCfg.Quota.MaxEndpoints},
+		{Resource: QUOTA_VLANS, Used: usage.vlans, Limit: gCfg.Quota.MaxVlans},
+		{Resource: QUOTA_VXLANS, Used: usage.vxlans,
+			Limit: gCfg.Quota.MaxVxlans},
+		{Resource: QUOTA_SUBNETS, Used: usage.subnets,
+			Limit: gCfg.Quota.MaxSubnets}}, nil
+}
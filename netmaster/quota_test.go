@@ -0,0 +1,90 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func verifyQuotaExceeded(t *testing.T, err error, resource string) {
+	if err == nil || !strings.Contains(err.Error(), "quota of") ||
+		!strings.Contains(err.Error(), resource) {
+		t.Fatalf("error '%v', expected the %s quota to be exceeded \n",
+			err, resource)
+	}
+}
+
+func TestTenantQuotas(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.MaxNetworks = 2
+	tenant.MaxEndpoints = 2
+	tenant.MaxVlans = 1
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}, {Name: "purple"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	verifyQuotaExceeded(t, err, QUOTA_VLANS)
+
+	// raising the quota of an existing tenant lets the network in
+	tenant.MaxVlans = 3
+	err = CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' raising the tenant quotas \n", err)
+	}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "green"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	verifyQuotaExceeded(t, err, QUOTA_NETWORKS)
+
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	for _, container := range []string{"myContainer1", "myContainer2"} {
+		_, err = createTestEp(tenant, container, "")
+		if err != nil {
+			t.Fatalf("error '%s' creating ep \n", err)
+		}
+	}
+	_, err = createTestEp(tenant, "myContainer3", "")
+	verifyQuotaExceeded(t, err, QUOTA_ENDPOINTS)
+
+	quotas, err := GetTenantQuotas(fakeDriver, tenant.Name)
+	if err != nil {
+		t.Fatalf("error '%s' getting tenant quotas \n", err)
+	}
+	expQuotas := []QuotaUsage{
+		{Resource: QUOTA_NETWORKS, Used: 2, Limit: 2},
+		{Resource: QUOTA_ENDPOINTS, Used: 2, Limit: 2},
+		{Resource: QUOTA_VLANS, Used: 2, Limit: 3},
+		{Resource: QUOTA_VXLANS, Used: 0, Limit: 0},
+		{Resource: QUOTA_SUBNETS, Used: 2, Limit: 0}}
+	if !reflect.DeepEqual(quotas, expQuotas) {
+		t.Fatalf("quotas %+v, expected %+v \n", quotas, expQuotas)
+	}
+}
@@ -0,0 +1,89 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/netutils"
+)
+
+// the networks of a tenant with distributed routing are routed by every host
+// with endpoints in them, in a vrf of the tenant; the hosts' drivers set up a
+// gateway at each network's default gateway address.
+
+const (
+	// the vrf id is part of the gateways' macs
+	MAX_VRF = 0xffff
+)
+
+// allocVrf returns the lowest vrf id no tenant uses
+func allocVrf(stateDriver core.StateDriver) (uint, error) {
+	readGlbl := &gstate.Cfg{}
+	readGlbl.StateDriver = stateDriver
+	gCfgs, err := readAllOrNone(readGlbl)
+	if err != nil {
+		return 0, err
+	}
+
+	used := make(map[uint]bool)
+	for _, gCfg := range gCfgs {
+		used[gCfg.(*gstate.Cfg).Deploy.Vrf] = true
+	}
+	for vrf := uint(1); vrf <= MAX_VRF; vrf++ {
+		if !used[vrf] {
+			return vrf, nil
+		}
+	}
+	return 0, &core.Error{Desc: "no vrfs available"}
+}
+
+// validateNetworkGw checks the default gateway of a network with a gateway on
+// the hosts, routed or with outbound nat; a static gateway must be in the
+// network's static subnet
+func validateNetworkGw(network *ConfigNetwork) error {
+	if network.DefaultGw == "" {
+		return nil
+	}
+	if network.SubnetCIDR == "" {
+		return errors.New("the default gateway of a routed or outbound nat " +
+			"network requires a static subnet")
+	}
+
+	_, ipNet, err := net.ParseCIDR(network.SubnetCIDR)
+	if err != nil {
+		return err
+	}
+	err = checkIpInSubnet(ipNet, network.DefaultGw)
+	if err != nil {
+		return &core.Error{Desc: fmt.Sprintf("default gateway: %s", err)}
+	}
+	return nil
+}
+
+// networkGw returns the default gateway of a network with a gateway on the
+// hosts, the first address of its subnet unless specified
+func networkGw(nwCfg *drivers.OvsCfgNetworkState) (string, error) {
+	if nwCfg.DefaultGw != "" {
+		return nwCfg.DefaultGw, nil
+	}
+	return netutils.GetSubnetIp(nwCfg.SubnetIp, nwCfg.SubnetLen, 32, 1)
+}
@@ -0,0 +1,96 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"testing"
+)
+
+func TestDistributedRouting(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenants := []*ConfigTenant{
+		newTestTenant("tenant-one", "11.1.0.0/16", false),
+		newTestTenant("tenant-two", "11.2.0.0/16", false),
+		newTestTenant("tenant-three", "11.3.0.0/16", false)}
+	tenants[0].DistributedRouting = true
+	tenants[2].DistributedRouting = true
+	for _, tenant := range tenants {
+		err := CreateTenant(fakeDriver, tenant)
+		if err != nil {
+			t.Fatalf("error '%s' creating tenant \n", err)
+		}
+		tenant.Networks = []ConfigNetwork{{Name: tenant.Name + "-orange"}}
+		err = CreateNetworks(fakeDriver, tenant)
+		if err != nil {
+			t.Fatalf("error '%s' creating networks \n", err)
+		}
+	}
+
+	// the routed networks are in the vrfs of their tenants, with a gateway at
+	// the first address of their subnet
+	for i, vrf := range []uint{1, 0, 2} {
+		nwCfg := readTestNetwork(t, tenants[i].Name+"-orange")
+		if nwCfg.Vrf != vrf {
+			t.Fatalf("network %+v, expected vrf %d \n", nwCfg, vrf)
+		}
+	}
+	nwCfg := readTestNetwork(t, "tenant-one-orange")
+	if nwCfg.DefaultGw != "11.1.0.1" {
+		t.Fatalf("network %+v, expected default gw 11.1.0.1 \n", nwCfg)
+	}
+
+	// the gateway address isn't allocated to the endpoints
+	ip, err := createTestEp(tenants[0], "myContainer1", "")
+	if err != nil || ip != "11.1.0.2" {
+		t.Fatalf("error '%v' creating ep, got ip %s expected 11.1.0.2 \n",
+			err, ip)
+	}
+
+	// a static gateway must be in the network's static subnet
+	for _, network := range []ConfigNetwork{
+		{Name: "purple", SubnetCIDR: "12.1.1.0/24", DefaultGw: "12.1.2.1"},
+		{Name: "blue", DefaultGw: "11.1.1.1"}} {
+		tenants[0].Networks = []ConfigNetwork{network}
+		err = CreateNetworks(fakeDriver, tenants[0])
+		if err == nil {
+			t.Fatalf("created routed network %+v \n", network)
+		}
+	}
+	tenants[0].Networks = []ConfigNetwork{{Name: "purple",
+		SubnetCIDR: "12.1.1.0/24", DefaultGw: "12.1.1.254"}}
+	err = CreateNetworks(fakeDriver, tenants[0])
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	nwCfg = readTestNetwork(t, "purple")
+	if nwCfg.DefaultGw != "12.1.1.254" || nwCfg.Vrf != 1 {
+		t.Fatalf("network %+v, expected default gw 12.1.1.254 in vrf 1 \n",
+			nwCfg)
+	}
+
+	// the export keeps the tenants' routing
+	cfg, err := ExportConfig(fakeDriver, false)
+	if err != nil {
+		t.Fatalf("error '%s' exporting config \n", err)
+	}
+	for _, tenant := range cfg.Tenants {
+		if tenant.DistributedRouting != (tenant.Name != "tenant-two") {
+			t.Fatalf("exported tenant %+v, wrong distributed routing \n",
+				tenant)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// json-schema of the intent, derived from the Config structures so that it
+// doesn't go out of sync with them. A copy is published in the docs directory
+// for the editors and the tools that validate the intent files.
+
+const (
+	SCHEMA_VERSION = "http://json-schema.org/draft-04/schema#"
+)
+
+// fields that must be specified for a construct to be valid
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(ConfigHost{}):         {"Name"},
+	reflect.TypeOf(ConfigInfraNetwork{}): {"Name"},
+	reflect.TypeOf(ConfigEp{}):           {"Container"},
+	reflect.TypeOf(ConfigNetwork{}):      {"Name"},
+	reflect.TypeOf(ConfigTenant{}):       {"Name"},
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array",
+			"items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := field.Tag.Get("yaml")
+			if name == "" {
+				name = field.Name
+			}
+			props[name] = typeSchema(field.Type)
+		}
+		schema := map[string]interface{}{"type": "object",
+			"properties": props, "additionalProperties": false}
+		if required, ok := schemaRequired[t]; ok {
+			schema["required"] = required
+		}
+		return schema
+	}
+
+	return map[string]interface{}{}
+}
+
+// ConfigSchema returns the json-schema of the intent (Config)
+func ConfigSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = SCHEMA_VERSION
+	schema["title"] = "netplugin intent"
+
+	data, err := json.MarshalIndent(schema, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,120 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/gstate"
+	"github.com/contiv/netplugin/resources"
+)
+
+// vxlanIds turns the vxlan offsets reported by the vxlan resource into the
+// vxlan ids
+func vxlanIds(stateDriver core.StateDriver, tenant string,
+	usage *core.ResourceUsage) error {
+	gOper := &gstate.Oper{}
+	gOper.StateDriver = stateDriver
+	err := gOper.Read(tenant)
+	if err != nil {
+		return err
+	}
+
+	for i := range usage.Allocated {
+		offset, err := strconv.Atoi(usage.Allocated[i].Value)
+		if err != nil {
+			return err
+		}
+		usage.Allocated[i].Value = strconv.Itoa(offset +
+			int(gOper.FreeVxlansStart))
+	}
+	return nil
+}
+
+// GetTenantUsage reports the usage of the tenant's resources followed by the
+// usage of the ip resources of the tenant's networks, one per subnet. The
+// local vlans of a tenant whose vxlans rely on the host vlans are reported
+// per host.
+func GetTenantUsage(stateDriver core.StateDriver, tenant string) ([]core.ResourceUsage,
+	error) {
+	ra, err := newResourceManager(stateDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	usages, err := ra.GetResourceUsage(tenant)
+	if err != nil {
+		log.Printf("error '%s' getting the usage of tenant %s \n", err, tenant)
+		return nil, err
+	}
+	for i := range usages {
+		if usages[i].Description != resources.AUTO_VXLAN_RSRC {
+			continue
+		}
+		err = vxlanIds(stateDriver, tenant, &usages[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	readNet := &drivers.OvsCfgNetworkState{}
+	readNet.StateDriver = stateDriver
+	states, err := readAllOrNone(readNet)
+	if err != nil {
+		return nil, err
+	}
+	netIds := make(map[string]bool)
+	for _, state := range states {
+		nwCfg := state.(*drivers.OvsCfgNetworkState)
+		if nwCfg.Tenant != tenant {
+			continue
+		}
+		netIds[nwCfg.Id] = true
+		for _, rsrcId := range netIpRsrcIds(nwCfg) {
+			netUsages, err := ra.GetResourceUsage(rsrcId)
+			if err != nil {
+				log.Printf("error '%s' getting the usage of network %s \n",
+					err, rsrcId)
+				return nil, err
+			}
+			// the addresses of a grown subnet are owned by the network
+			for i := range netUsages {
+				for j := range netUsages[i].Allocated {
+					netUsages[i].Allocated[j].Owner = nwCfg.Id
+				}
+			}
+			usages = append(usages, netUsages...)
+		}
+	}
+
+	vxlanRsrc := &resources.AutoVxlanCfgResource{}
+	vxlanRsrc.StateDriver = stateDriver
+	err = vxlanRsrc.Read(tenant)
+	if core.ErrIfKeyExists(err) != nil {
+		return nil, err
+	} else if err == nil && vxlanRsrc.HostLocalVlans {
+		hostUsages, err := hostVlanUsages(stateDriver, netIds)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, hostUsages...)
+	}
+
+	return usages, nil
+}
@@ -0,0 +1,68 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netmaster
+
+import (
+	"testing"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/resources"
+)
+
+func TestTenantUsage(t *testing.T) {
+	fakeDriver.Init(nil)
+
+	tenant := newTestTenant("tenant-one", "11.1.0.0/16", false)
+	tenant.DefaultNetType = "vxlan"
+	tenant.Vxlans = "10001-10010"
+	err := CreateTenant(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating tenant \n", err)
+	}
+	tenant.Networks = []ConfigNetwork{{Name: "orange"}}
+	err = CreateNetworks(fakeDriver, tenant)
+	if err != nil {
+		t.Fatalf("error '%s' creating networks \n", err)
+	}
+	_, err = createTestEp(tenant, "myContainer1", "")
+	if err != nil {
+		t.Fatalf("error '%s' creating ep \n", err)
+	}
+
+	usages, err := GetTenantUsage(fakeDriver, tenant.Name)
+	if err != nil {
+		t.Fatalf("error '%s' getting tenant usage \n", err)
+	}
+	expUsages := map[string]core.AllocatedValue{
+		resources.AUTO_SUBNET_RSRC: {Value: "11.1.0.0/24", Owner: "orange"},
+		resources.AUTO_VXLAN_RSRC:  {Value: "10001", Owner: "orange"},
+		resources.AUTO_IP_RSRC:     {Value: "11.1.0.1", Owner: "orange"},
+	}
+	for _, usage := range usages {
+		expVal, ok := expUsages[usage.Description]
+		if !ok {
+			continue
+		}
+		if usage.Used != 1 || usage.Capacity != usage.Used+usage.Free ||
+			len(usage.Allocated) != 1 || usage.Allocated[0] != expVal {
+			t.Fatalf("usage %+v, expected %+v allocated \n", usage, expVal)
+		}
+		delete(expUsages, usage.Description)
+	}
+	if len(expUsages) != 0 {
+		t.Fatalf("usage of %+v not reported, got %+v \n", expUsages, usages)
+	}
+}
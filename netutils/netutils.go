@@ -258,3 +258,200 @@ func ParseCIDR(cidrStr string) (string, uint, error) {
 
 	return subnetStr, uint(subnetLen), nil
 }
+
+// ParseIpRange parses an address range specified as 'start-end', or a single
+// address, and returns the first and the last address of the range
+func ParseIpRange(ipRange string) (string, string, error) {
+	strs := strings.Split(ipRange, "-")
+	if len(strs) > 2 {
+		return "", "", errors.New(
+			fmt.Sprintf("invalid ip range format %s", ipRange))
+	}
+
+	startIp := strings.TrimSpace(strs[0])
+	endIp := strings.TrimSpace(strs[len(strs)-1])
+	startIpUint32, err := ipv4ToUint32(startIp)
+	if err != nil {
+		return "", "", errors.New(
+			fmt.Sprintf("invalid start ip in range %s", ipRange))
+	}
+	endIpUint32, err := ipv4ToUint32(endIp)
+	if err != nil {
+		return "", "", errors.New(
+			fmt.Sprintf("invalid end ip in range %s", ipRange))
+	}
+	if startIpUint32 > endIpUint32 {
+		return "", "", errors.New(
+			fmt.Sprintf("start ip is bigger than end ip in range %s", ipRange))
+	}
+
+	return startIp, endIp, nil
+}
+
+// ParsePortMapping parses a port published on the host, specified as
+// 'hostPort:containerPort[/protocol]', the protocol being tcp (default) or udp
+func ParsePortMapping(mapping string) (uint, uint, string, error) {
+	protocol := "tcp"
+	strs := strings.Split(mapping, "/")
+	if len(strs) == 2 {
+		protocol = strs[1]
+	}
+	if len(strs) > 2 || (protocol != "tcp" && protocol != "udp") {
+		return 0, 0, "", errors.New(
+			fmt.Sprintf("invalid port mapping %s", mapping))
+	}
+
+	ports := strings.Split(strs[0], ":")
+	if len(ports) != 2 {
+		return 0, 0, "", errors.New(
+			fmt.Sprintf("invalid port mapping %s", mapping))
+	}
+	hostPort, err := strconv.ParseUint(ports[0], 10, 16)
+	if err != nil || hostPort == 0 {
+		return 0, 0, "", errors.New(
+			fmt.Sprintf("invalid host port in mapping %s", mapping))
+	}
+	contPort, err := strconv.ParseUint(ports[1], 10, 16)
+	if err != nil || contPort == 0 {
+		return 0, 0, "", errors.New(
+			fmt.Sprintf("invalid container port in mapping %s", mapping))
+	}
+
+	return uint(hostPort), uint(contPort), protocol, nil
+}
+
+// IpRangeContains checks if an address is within a range specified as
+// 'start-end', or is the address if the range is a single address
+func IpRangeContains(ipRange string, ip string) (bool, error) {
+	startIp, endIp, err := ParseIpRange(ipRange)
+	if err != nil {
+		return false, err
+	}
+
+	ipUint32, err := ipv4ToUint32(ip)
+	if err != nil {
+		return false, err
+	}
+	startIpUint32, _ := ipv4ToUint32(startIp)
+	endIpUint32, _ := ipv4ToUint32(endIp)
+
+	return ipUint32 >= startIpUint32 && ipUint32 <= endIpUint32, nil
+}
+
+// SetIpRangeBits marks the addresses of a range, specified as 'start-end' or
+// as a single address, as in use in the allocation bitset of a subnet
+func SetIpRangeBits(b *bitset.BitSet, subnetIp string, subnetLen uint, ipRange string) error {
+	startIp, endIp, err := ParseIpRange(ipRange)
+	if err != nil {
+		return err
+	}
+
+	startId, err := GetIpNumber(subnetIp, subnetLen, 32, startIp)
+	if err != nil {
+		return err
+	}
+	endId, err := GetIpNumber(subnetIp, subnetLen, 32, endIp)
+	if err != nil {
+		return err
+	}
+	for hostId := startId; hostId <= endId; hostId++ {
+		b.Set(hostId)
+	}
+
+	return nil
+}
+
+const (
+	// largest number of addresses of a mac pool, kept small enough for the
+	// pool's allocation bitset to be stored as a single state
+	MAX_MAC_POOL_BITS = 16
+)
+
+func macToUint64(mac net.HardwareAddr) uint64 {
+	var macUint64 uint64
+	for _, b := range mac {
+		macUint64 = (macUint64 << 8) | uint64(b)
+	}
+	return macUint64
+}
+
+func macUint64ToAddr(macUint64 uint64) net.HardwareAddr {
+	mac := make(net.HardwareAddr, 6)
+	for i := 5; i >= 0; i-- {
+		mac[i] = byte(macUint64)
+		macUint64 >>= 8
+	}
+	return mac
+}
+
+// ParseMacPool parses a mac pool specified as 'prefix/len', e.g.
+// '02:02:ac:00:00:00/32'. The prefix includes at least the oui (24 bits).
+func ParseMacPool(macPool string) (net.HardwareAddr, uint, error) {
+	strs := strings.Split(macPool, "/")
+	if len(strs) != 2 {
+		return nil, 0, errors.New("invalid mac pool format")
+	}
+
+	mac, err := net.ParseMAC(strs[0])
+	if err != nil || len(mac) != 6 {
+		return nil, 0, errors.New(
+			fmt.Sprintf("invalid mac pool prefix %s", strs[0]))
+	}
+	// the I/G bit makes the macs multicast, they can't be assigned to an
+	// interface
+	if mac[0]&0x01 != 0 {
+		return nil, 0, errors.New(
+			fmt.Sprintf("mac pool prefix %s is a multicast mac", strs[0]))
+	}
+	poolLen, err := strconv.Atoi(strs[1])
+	if err != nil || poolLen < 24 || poolLen > 48 ||
+		48-poolLen > MAX_MAC_POOL_BITS {
+		return nil, 0, errors.New(fmt.Sprintf(
+			"invalid mac pool length %s, expecting %d to 48",
+			strs[1], 48-MAX_MAC_POOL_BITS))
+	}
+
+	// clear the host bits of the prefix
+	poolSize := uint64(1) << uint(48-poolLen)
+	prefix := macUint64ToAddr(macToUint64(mac) &^ (poolSize - 1))
+
+	return prefix, uint(poolLen), nil
+}
+
+func GetMacAddr(macPrefix net.HardwareAddr, poolLen uint, hostId uint) (string, error) {
+	maxHosts := uint(1) << (48 - poolLen)
+	if hostId >= maxHosts {
+		return "", errors.New(
+			fmt.Sprintf("host id %d is beyond mac pool's capacity %d",
+				hostId, maxHosts))
+	}
+
+	return macUint64ToAddr(macToUint64(macPrefix) + uint64(hostId)).String(), nil
+}
+
+func GetMacNumber(macPrefix net.HardwareAddr, poolLen uint, macAddr string) (uint, error) {
+	mac, err := net.ParseMAC(macAddr)
+	if err != nil || len(mac) != 6 {
+		return 0, errors.New(fmt.Sprintf("invalid mac %s", macAddr))
+	}
+
+	poolSize := uint64(1) << (48 - poolLen)
+	if macToUint64(mac)&^(poolSize-1) != macToUint64(macPrefix) {
+		return 0, errors.New(fmt.Sprintf("mac %s is beyond mac pool %s/%d",
+			macAddr, macPrefix, poolLen))
+	}
+
+	return uint(macToUint64(mac) & (poolSize - 1)), nil
+}
+
+// GetMacFromIp derives the mac of an address from the pool, using the low
+// order bits of the ip as the host bits of the mac
+func GetMacFromIp(macPrefix net.HardwareAddr, poolLen uint, ipAddr string) (string, error) {
+	ipUint32, err := ipv4ToUint32(ipAddr)
+	if err != nil {
+		return "", err
+	}
+
+	maxHosts := uint(1) << (48 - poolLen)
+	return GetMacAddr(macPrefix, poolLen, uint(ipUint32)&(maxHosts-1))
+}
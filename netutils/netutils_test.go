@@ -203,3 +203,125 @@ func TestGetLocalIp(t *testing.T) {
 		t.Fatalf("error obtaining local IP of the host '%s' \n", err)
 	}
 }
+
+func TestParseIpRange(t *testing.T) {
+	startIp, endIp, err := ParseIpRange("11.2.1.10-11.2.1.20")
+	if err != nil || startIp != "11.2.1.10" || endIp != "11.2.1.20" {
+		t.Fatalf("error parsing ip range, got %s-%s err '%v'", startIp, endIp, err)
+	}
+
+	startIp, endIp, err = ParseIpRange("11.2.1.10")
+	if err != nil || startIp != "11.2.1.10" || endIp != "11.2.1.10" {
+		t.Fatalf("error parsing single ip range, got %s-%s err '%v'",
+			startIp, endIp, err)
+	}
+
+	for _, ipRange := range []string{"11.2.1.20-11.2.1.10", "11.2.1.10-",
+		"11.2.1.10-11.2.1.20-11.2.1.30", "11.2.1.x"} {
+		_, _, err = ParseIpRange(ipRange)
+		if err == nil {
+			t.Fatalf("Expecting error on invalid ip range %s", ipRange)
+		}
+	}
+}
+
+func TestIpRangeContains(t *testing.T) {
+	for ip, expected := range map[string]bool{"11.2.1.9": false,
+		"11.2.1.10": true, "11.2.1.15": true, "11.2.1.20": true,
+		"11.2.1.21": false, "11.2.2.15": false} {
+		found, err := IpRangeContains("11.2.1.10-11.2.1.20", ip)
+		if err != nil {
+			t.Fatalf("error checking ip %s in range - err '%s'", ip, err)
+		}
+		if found != expected {
+			t.Fatalf("ip %s in range is %v, expected %v", ip, found, expected)
+		}
+	}
+}
+
+func TestSetIpRangeBits(t *testing.T) {
+	b := CreateBitset(8)
+	err := SetIpRangeBits(b, "11.2.1.0", 24, "11.2.1.10-11.2.1.12")
+	if err != nil {
+		t.Fatalf("error setting ip range bits - err '%s'", err)
+	}
+	if b.Count() != 3 || !b.Test(10) || !b.Test(11) || !b.Test(12) {
+		t.Fatalf("unexpected bits set for ip range, count %d", b.Count())
+	}
+
+	err = SetIpRangeBits(b, "11.2.1.0", 24, "11.2.1.250-11.2.2.2")
+	if err == nil {
+		t.Fatalf("Expecting error on ip range beyond subnet")
+	}
+}
+
+func TestParseMacPool(t *testing.T) {
+	prefix, poolLen, err := ParseMacPool("02:02:ac:11:22:33/32")
+	if err != nil {
+		t.Fatalf("error parsing mac pool - err '%s'", err)
+	}
+	if prefix.String() != "02:02:ac:11:00:00" || poolLen != 32 {
+		t.Fatalf("parsed mac pool %s/%d, expected 02:02:ac:11:00:00/32",
+			prefix, poolLen)
+	}
+
+	for _, macPool := range []string{"02:02:ac:11:00:00", "02:02:ac:11:00:00/16",
+		"02:02:ac:11:00:00/24", "02:02:ac:11:00:00/49", "02:02:ac:11:00/40",
+		"03:02:ac:11:00:00/32"} {
+		_, _, err = ParseMacPool(macPool)
+		if err == nil {
+			t.Fatalf("Expecting error on invalid mac pool %s", macPool)
+		}
+	}
+}
+
+func TestGetMacAddrAndNumber(t *testing.T) {
+	prefix, poolLen, _ := ParseMacPool("02:02:ac:11:00:00/32")
+
+	mac, err := GetMacAddr(prefix, poolLen, 513)
+	if err != nil || mac != "02:02:ac:11:02:01" {
+		t.Fatalf("obtained mac %s for host id 513, err '%v'", mac, err)
+	}
+
+	hostId, err := GetMacNumber(prefix, poolLen, mac)
+	if err != nil || hostId != 513 {
+		t.Fatalf("obtained host id %d for mac %s, err '%v'", hostId, mac, err)
+	}
+
+	_, err = GetMacAddr(prefix, poolLen, 1<<16)
+	if err == nil {
+		t.Fatalf("Expecting error on host id beyond the mac pool")
+	}
+	_, err = GetMacNumber(prefix, poolLen, "02:02:ac:12:02:01")
+	if err == nil {
+		t.Fatalf("Expecting error on mac beyond the mac pool")
+	}
+}
+
+func TestGetMacFromIp(t *testing.T) {
+	prefix, poolLen, _ := ParseMacPool("02:02:ac:11:00:00/32")
+
+	mac, err := GetMacFromIp(prefix, poolLen, "11.2.1.5")
+	if err != nil || mac != "02:02:ac:11:01:05" {
+		t.Fatalf("obtained mac %s for ip 11.2.1.5, err '%v'", mac, err)
+	}
+}
+
+func TestParsePortMapping(t *testing.T) {
+	hostPort, contPort, protocol, err := ParsePortMapping("8080:80")
+	if err != nil || hostPort != 8080 || contPort != 80 || protocol != "tcp" {
+		t.Fatalf("parsed %d:%d/%s, err '%v'", hostPort, contPort, protocol, err)
+	}
+	hostPort, contPort, protocol, err = ParsePortMapping("53:5353/udp")
+	if err != nil || hostPort != 53 || contPort != 5353 || protocol != "udp" {
+		t.Fatalf("parsed %d:%d/%s, err '%v'", hostPort, contPort, protocol, err)
+	}
+
+	for _, mapping := range []string{"8080", "8080:80/sctp", "0:80",
+		"8080:65536", "8080:80:81", "8080:80/tcp/udp", "http:80"} {
+		_, _, _, err = ParsePortMapping(mapping)
+		if err == nil {
+			t.Fatalf("Expecting error on invalid port mapping %s", mapping)
+		}
+	}
+}
@@ -19,9 +19,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/contiv/netplugin/core"
 	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/metrics"
 )
 
 // implements the generic Plugin interface
@@ -170,11 +172,17 @@ func (p *NetPlugin) Deinit() {
 }
 
 func (p *NetPlugin) CreateNetwork(id string) error {
-	return p.NetworkDriver.CreateNetwork(id)
+	start := time.Now()
+	err := p.NetworkDriver.CreateNetwork(id)
+	metrics.ObservePluginOp(metrics.OPER_CREATE, metrics.CONSTRUCT_NW, start, err)
+	return err
 }
 
 func (p *NetPlugin) DeleteNetwork(id string) error {
-	return p.NetworkDriver.DeleteNetwork(id)
+	start := time.Now()
+	err := p.NetworkDriver.DeleteNetwork(id)
+	metrics.ObservePluginOp(metrics.OPER_DELETE, metrics.CONSTRUCT_NW, start, err)
+	return err
 }
 
 func (p *NetPlugin) FetchNetwork(id string) (core.State, error) {
@@ -182,11 +190,17 @@ func (p *NetPlugin) FetchNetwork(id string) (core.State, error) {
 }
 
 func (p *NetPlugin) CreateEndpoint(id string) error {
-	return p.EndpointDriver.CreateEndpoint(id)
+	start := time.Now()
+	err := p.EndpointDriver.CreateEndpoint(id)
+	metrics.ObservePluginOp(metrics.OPER_CREATE, metrics.CONSTRUCT_EP, start, err)
+	return err
 }
 
 func (p *NetPlugin) DeleteEndpoint(id string) error {
-	return p.EndpointDriver.DeleteEndpoint(id)
+	start := time.Now()
+	err := p.EndpointDriver.DeleteEndpoint(id)
+	metrics.ObservePluginOp(metrics.OPER_DELETE, metrics.CONSTRUCT_EP, start, err)
+	return err
 }
 
 func (p *NetPlugin) FetchEndpoint(id string) (core.State, error) {
@@ -0,0 +1,91 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/jainvipin/bitset"
+)
+
+// strategies to pick the next value of the resources that allocate from a
+// bitset of free values (vlans, vxlans, subnets):
+// - lowest-first hands out the lowest free value, so a freed value is reused
+//   by the very next allocation. This is the default.
+// - round-robin hands out the next free value after the last allocated one,
+//   wrapping around at the end of the range.
+// - random hands out any of the free values.
+// - sticky hands out the first free value after a position derived from the
+//   allocation's hint (the network name), so a network that is deleted and
+//   recreated gets back its old value as long as it is free.
+
+const (
+	ALLOC_LOWEST_FIRST = "lowest-first"
+	ALLOC_ROUND_ROBIN  = "round-robin"
+	ALLOC_RANDOM       = "random"
+	ALLOC_STICKY       = "sticky"
+)
+
+func ValidateAllocStrategy(strategy string) error {
+	switch strategy {
+	case "", ALLOC_LOWEST_FIRST, ALLOC_ROUND_ROBIN, ALLOC_RANDOM, ALLOC_STICKY:
+		return nil
+	}
+	return &core.Error{Desc: fmt.Sprintf("invalid allocation strategy %q",
+		strategy)}
+}
+
+// nextSetFrom returns the first set bit at or after 'start', wrapping around
+// to the start of the bitset
+func nextSetFrom(free *bitset.BitSet, start uint) (uint, bool) {
+	if bit, ok := free.NextSet(start); ok {
+		return bit, ok
+	}
+	return free.NextSet(0)
+}
+
+func hintPosition(hint string, length uint) uint {
+	h := fnv.New32a()
+	h.Write([]byte(hint))
+	return uint(h.Sum32()) % length
+}
+
+// pickFreeBit returns the free bit picked by the strategy. 'next' is the
+// position following the last allocated bit, used by round-robin; 'hint' is
+// used by sticky and falls back to lowest-first when empty.
+func pickFreeBit(free *bitset.BitSet, strategy string, next uint,
+	hint string) (uint, bool) {
+	switch {
+	case strategy == ALLOC_ROUND_ROBIN:
+		return nextSetFrom(free, next)
+	case strategy == ALLOC_STICKY && hint != "" && free.Len() > 0:
+		return nextSetFrom(free, hintPosition(hint, free.Len()))
+	case strategy == ALLOC_RANDOM:
+		count := free.Count()
+		if count == 0 {
+			return 0, false
+		}
+		bit, ok := free.NextSet(0)
+		for i := rand.Intn(int(count)); i > 0 && ok; i-- {
+			bit, ok = free.NextSet(bit + 1)
+		}
+		return bit, ok
+	}
+	return free.NextSet(0)
+}
@@ -0,0 +1,156 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+)
+
+const (
+	allocStrategyTenant = "allocStrategyTenant"
+)
+
+func defineTestStrategyVlans(t *testing.T, strategy string) *EtcdResourceManager {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	vlans := netutils.CreateBitset(12)
+	for vlan := uint(100); vlan <= 103; vlan++ {
+		vlans.Set(vlan)
+	}
+	err := ra.DefineResource(allocStrategyTenant, AUTO_VLAN_RSRC,
+		&AutoVlanCfgResource{Vlans: vlans, AllocStrategy: strategy})
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+
+	return ra
+}
+
+func allocateTestVlan(t *testing.T, ra *EtcdResourceManager, hint string) uint {
+	vlan, err := ra.AllocateResourceValWithHint(allocStrategyTenant,
+		AUTO_VLAN_RSRC, hint)
+	if err != nil {
+		t.Fatalf("error '%s' allocating vlan \n", err)
+	}
+	return vlan.(uint)
+}
+
+func freeTestVlan(t *testing.T, ra *EtcdResourceManager, vlan uint) {
+	err := ra.DeallocateResourceVal(allocStrategyTenant, AUTO_VLAN_RSRC, vlan)
+	if err != nil {
+		t.Fatalf("error '%s' freeing vlan %d \n", err, vlan)
+	}
+}
+
+func TestAllocStrategyLowestFirst(t *testing.T) {
+	ra := defineTestStrategyVlans(t, ALLOC_LOWEST_FIRST)
+
+	vlan := allocateTestVlan(t, ra, "")
+	freeTestVlan(t, ra, vlan)
+	if reused := allocateTestVlan(t, ra, ""); reused != vlan {
+		t.Fatalf("allocated vlan %d, expected the freed vlan %d \n", reused, vlan)
+	}
+}
+
+func TestAllocStrategyRoundRobin(t *testing.T) {
+	ra := defineTestStrategyVlans(t, ALLOC_ROUND_ROBIN)
+
+	for _, expVlan := range []uint{100, 101} {
+		if vlan := allocateTestVlan(t, ra, ""); vlan != expVlan {
+			t.Fatalf("allocated vlan %d, expected %d \n", vlan, expVlan)
+		}
+	}
+
+	// a freed vlan is reused only after the rest of the range
+	freeTestVlan(t, ra, 100)
+	for _, expVlan := range []uint{102, 103, 100} {
+		if vlan := allocateTestVlan(t, ra, ""); vlan != expVlan {
+			t.Fatalf("allocated vlan %d, expected %d \n", vlan, expVlan)
+		}
+	}
+}
+
+func TestAllocStrategyRandom(t *testing.T) {
+	ra := defineTestStrategyVlans(t, ALLOC_RANDOM)
+
+	allocated := make(map[uint]bool)
+	for i := 0; i < 4; i++ {
+		vlan := allocateTestVlan(t, ra, "")
+		if vlan < 100 || vlan > 103 || allocated[vlan] {
+			t.Fatalf("allocated vlan %d, already allocated %v \n", vlan, allocated)
+		}
+		allocated[vlan] = true
+	}
+
+	_, err := ra.AllocateResourceVal(allocStrategyTenant, AUTO_VLAN_RSRC)
+	if err == nil {
+		t.Fatalf("allocation from an exhausted range succeeded \n")
+	}
+}
+
+func TestAllocStrategySticky(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	vlans := netutils.CreateBitset(12).Complement()
+	err := ra.DefineResource(allocStrategyTenant, AUTO_VLAN_RSRC,
+		&AutoVlanCfgResource{Vlans: vlans, AllocStrategy: ALLOC_STICKY})
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+
+	vlan := allocateTestVlan(t, ra, "orange")
+	if expVlan := hintPosition("orange", vlans.Len()); vlan != expVlan {
+		t.Fatalf("allocated vlan %d, expected %d \n", vlan, expVlan)
+	}
+	other := allocateTestVlan(t, ra, "purple")
+	if other == vlan {
+		t.Fatalf("allocated vlan %d twice \n", vlan)
+	}
+
+	// the network gets its vlan back once recreated
+	freeTestVlan(t, ra, vlan)
+	allocateTestVlan(t, ra, "")
+	if sticky := allocateTestVlan(t, ra, "orange"); sticky != vlan {
+		t.Fatalf("allocated vlan %d, expected the previous vlan %d \n",
+			sticky, vlan)
+	}
+
+	// a taken vlan moves the next network with the same position further
+	if next := allocateTestVlan(t, ra, "orange"); next != (vlan+1)%vlans.Len() {
+		t.Fatalf("allocated vlan %d, expected the next free vlan %d \n",
+			next, (vlan+1)%vlans.Len())
+	}
+}
+
+func TestAllocStrategyInvalid(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	err := ra.DefineResource(allocStrategyTenant, AUTO_VLAN_RSRC,
+		&AutoVlanCfgResource{Vlans: netutils.CreateBitset(12),
+			AllocStrategy: "highest-first"})
+	if err == nil {
+		t.Fatalf("vlan resource with an invalid strategy defined \n")
+	}
+}
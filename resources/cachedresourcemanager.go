@@ -0,0 +1,143 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"log"
+	"sync"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+)
+
+// Cached resource manager implements the core.ResourceManager interface.
+// It keeps the resources it has found in memory, instead of reading them from
+// the state store on every allocation. Only the cfg
+// state of a resource is cached, the allocations still read and write the
+// oper state. A cached resource is dropped once its cfg changes in the state
+// store, as notified by a watchable state driver. A change notified while a
+// resource is being read from the state store keeps the read copy from being
+// cached, as it might predate the change.
+
+func resourceCfgKey(id, desc string) string {
+	return drivers.CFG_PATH + desc + "/" + id
+}
+
+// resourceCache is safe to use when nil, nothing gets cached in that case
+type resourceCache struct {
+	mutex sync.Mutex
+	rsrcs map[string]core.Resource
+	// bumped on every change of a resource
+	generations map[string]uint64
+	// set once the watch ends, the changes can't be noticed any more
+	disabled bool
+}
+
+func (c *resourceCache) get(id, desc string) (core.Resource, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	rsrc, ok := c.rsrcs[resourceCfgKey(id, desc)]
+	return rsrc, ok
+}
+
+// generation is to be taken before reading a resource from the state store
+// and passed to put once read
+func (c *resourceCache) generation(id, desc string) uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.generations[resourceCfgKey(id, desc)]
+}
+
+func (c *resourceCache) put(id, desc string, generation uint64,
+	rsrc core.Resource) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := resourceCfgKey(id, desc)
+	if !c.disabled && c.generations[key] == generation {
+		c.rsrcs[key] = rsrc
+	}
+}
+
+func (c *resourceCache) forget(key string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.rsrcs, key)
+	c.generations[key]++
+}
+
+func (c *resourceCache) invalidate(keys chan string) {
+	for key := range keys {
+		c.forget(key)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.disabled = true
+	c.rsrcs = make(map[string]core.Resource)
+}
+
+type CachedResourceManager struct {
+	EtcdResourceManager
+	stop chan bool
+}
+
+func (ra *CachedResourceManager) Init() error {
+	sd, ok := ra.Etcd.(core.WatchableStateDriver)
+	if !ok {
+		return &core.Error{Desc: "State driver doesn't support watching, " +
+			"resources can't be cached"}
+	}
+
+	keys := make(chan string)
+	stop := make(chan bool)
+	err := sd.WatchAll(drivers.CFG_PATH, keys, stop)
+	if err != nil {
+		return err
+	}
+
+	ra.cache = &resourceCache{rsrcs: make(map[string]core.Resource),
+		generations: make(map[string]uint64)}
+	ra.stop = stop
+	go func(cache *resourceCache) {
+		cache.invalidate(keys)
+		log.Printf("resource watch ended, resources are no longer cached \n")
+	}(ra.cache)
+
+	return nil
+}
+
+func (ra *CachedResourceManager) Deinit() {
+	if ra.stop != nil {
+		close(ra.stop)
+		ra.stop = nil
+	}
+}
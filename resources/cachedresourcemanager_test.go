@@ -0,0 +1,276 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+)
+
+const (
+	cacheTenant = "cacheTenant"
+)
+
+func newCachedTestRA(t *testing.T, sd core.StateDriver) *CachedResourceManager {
+	ra := &CachedResourceManager{}
+	ra.Etcd = sd
+	err := ra.Init()
+	if err != nil {
+		t.Fatalf("error '%s' initializing cached resource manager \n", err)
+	}
+	return ra
+}
+
+// syncWatch returns once the changes made so far have been processed by the
+// watch, as the watch handles the changed keys one after the other
+func syncWatch(t *testing.T, sd core.StateDriver) {
+	err := sd.Write(drivers.CFG_PATH+"cacheSync", []byte{})
+	if err != nil {
+		t.Fatalf("error '%s' writing sync key \n", err)
+	}
+}
+
+// waitUncached waits for the watch to drop the resource from the cache
+func waitUncached(t *testing.T, ra *CachedResourceManager, id, desc string) {
+	for i := 0; i < 100; i++ {
+		if _, ok := ra.cache.get(id, desc); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("resource %q %q wasn't dropped from the cache \n", desc, id)
+}
+
+func TestCachedResourceManager(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := newCachedTestRA(t, sd)
+	defer ra.Deinit()
+
+	err := ra.DefineResource(cacheTenant, AUTO_VLAN_RSRC, testVlanRange(10, 11))
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	syncWatch(t, sd)
+	vlan, err := ra.AllocateResourceVal(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil || vlan.(uint) != 10 {
+		t.Fatalf("error '%v' allocating vlan, allocated %v \n", err, vlan)
+	}
+	if _, ok := ra.cache.get(cacheTenant, AUTO_VLAN_RSRC); !ok {
+		t.Fatalf("vlan resource wasn't cached \n")
+	}
+
+	// another manager redefines the resource
+	otherRa := &EtcdResourceManager{Etcd: sd}
+	err = otherRa.UndefineResource(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' undefining vlan resource \n", err)
+	}
+	err = otherRa.DefineResource(cacheTenant, AUTO_VLAN_RSRC,
+		testVlanRange(20, 21))
+	if err != nil {
+		t.Fatalf("error '%s' redefining vlan resource \n", err)
+	}
+	syncWatch(t, sd)
+	if _, ok := ra.cache.get(cacheTenant, AUTO_VLAN_RSRC); ok {
+		t.Fatalf("redefined vlan resource still cached \n")
+	}
+
+	vlan, err = ra.AllocateResourceVal(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil || vlan.(uint) != 20 {
+		t.Fatalf("error '%v' allocating vlan, allocated %v expected 20 \n",
+			err, vlan)
+	}
+}
+
+// changingStateDriver changes the state, once, after a resource is read and
+// before it is returned
+type changingStateDriver struct {
+	*drivers.FakeStateDriver
+	change func()
+}
+
+func (d *changingStateDriver) ReadState(key string, value core.State,
+	unmarshal func([]byte, interface{}) error) error {
+	err := d.FakeStateDriver.ReadState(key, value, unmarshal)
+	if d.change != nil {
+		change := d.change
+		d.change = nil
+		change()
+	}
+	return err
+}
+
+func TestCachedResourceManagerChangeDuringRead(t *testing.T) {
+	fakeDriver := &drivers.FakeStateDriver{}
+	fakeDriver.Init(nil)
+	sd := &changingStateDriver{FakeStateDriver: fakeDriver}
+	ra := newCachedTestRA(t, sd)
+	defer ra.Deinit()
+
+	err := ra.DefineResource(cacheTenant, AUTO_VLAN_RSRC, testVlanRange(10, 11))
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	syncWatch(t, sd)
+
+	// another manager redefines the resource while it is being read
+	sd.change = func() {
+		otherRa := &EtcdResourceManager{Etcd: fakeDriver}
+		err := otherRa.UndefineResource(cacheTenant, AUTO_VLAN_RSRC)
+		if err != nil {
+			t.Fatalf("error '%s' undefining vlan resource \n", err)
+		}
+		err = otherRa.DefineResource(cacheTenant, AUTO_VLAN_RSRC,
+			testVlanRange(20, 21))
+		if err != nil {
+			t.Fatalf("error '%s' redefining vlan resource \n", err)
+		}
+		syncWatch(t, sd)
+	}
+	_, alreadyExists, err := ra.findResource(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil || !alreadyExists {
+		t.Fatalf("error '%v' finding vlan resource \n", err)
+	}
+	if _, ok := ra.cache.get(cacheTenant, AUTO_VLAN_RSRC); ok {
+		t.Fatalf("vlan resource read before its change was cached \n")
+	}
+
+	vlan, err := ra.AllocateResourceVal(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil || vlan.(uint) != 20 {
+		t.Fatalf("error '%v' allocating vlan, allocated %v expected 20 \n",
+			err, vlan)
+	}
+}
+
+func TestCachedResourceManagerStopped(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := newCachedTestRA(t, sd)
+
+	err := ra.DefineResource(cacheTenant, AUTO_VLAN_RSRC, testVlanRange(10, 11))
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	_, err = ra.AllocateResourceVal(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating vlan \n", err)
+	}
+
+	// once the watch ends nothing stays cached
+	ra.Deinit()
+	waitUncached(t, ra, cacheTenant, AUTO_VLAN_RSRC)
+	_, err = ra.AllocateResourceVal(cacheTenant, AUTO_VLAN_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating vlan \n", err)
+	}
+	if _, ok := ra.cache.get(cacheTenant, AUTO_VLAN_RSRC); ok {
+		t.Fatalf("vlan resource cached after the watch ended \n")
+	}
+}
+
+func TestCachedResourceManagerNoWatch(t *testing.T) {
+	ra := &CachedResourceManager{}
+	ra.Etcd = vlanRsrcStateDriver
+	err := ra.Init()
+	if err == nil {
+		t.Fatalf("cached resource manager initialized without a watch \n")
+	}
+}
+
+// the resources are defined directly, defining them through the manager
+// would look up all the existing ones each time
+func benchmarkAllocateVlan(b *testing.B, ra core.ResourceManager,
+	sd core.StateDriver, tenants int) {
+	for i := 0; i < tenants; i++ {
+		rsrc := &AutoVlanCfgResource{}
+		rsrc.StateDriver = sd
+		rsrc.Id = fmt.Sprintf("tenant%d", i)
+		err := rsrc.Init(testVlanRange(1, 4094))
+		if err != nil {
+			b.Fatalf("error '%s' defining vlan resource \n", err)
+		}
+	}
+
+	// the first allocation finds the resource
+	vlan, err := ra.AllocateResourceVal("tenant0", AUTO_VLAN_RSRC)
+	if err != nil {
+		b.Fatalf("error '%s' allocating vlan \n", err)
+	}
+	err = ra.DeallocateResourceVal("tenant0", AUTO_VLAN_RSRC, vlan)
+	if err != nil {
+		b.Fatalf("error '%s' freeing vlan \n", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vlan, err := ra.AllocateResourceVal("tenant0", AUTO_VLAN_RSRC)
+		if err != nil {
+			b.Fatalf("error '%s' allocating vlan \n", err)
+		}
+		err = ra.DeallocateResourceVal("tenant0", AUTO_VLAN_RSRC, vlan)
+		if err != nil {
+			b.Fatalf("error '%s' freeing vlan \n", err)
+		}
+	}
+}
+
+func benchmarkEtcdAllocateVlan(b *testing.B, tenants int) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	benchmarkAllocateVlan(b, &EtcdResourceManager{Etcd: sd}, sd, tenants)
+}
+
+func benchmarkCachedAllocateVlan(b *testing.B, tenants int) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &CachedResourceManager{}
+	ra.Etcd = sd
+	err := ra.Init()
+	if err != nil {
+		b.Fatalf("error '%s' initializing cached resource manager \n", err)
+	}
+	defer ra.Deinit()
+	benchmarkAllocateVlan(b, ra, sd, tenants)
+}
+
+func BenchmarkEtcdAllocateVlan10Tenants(b *testing.B) {
+	benchmarkEtcdAllocateVlan(b, 10)
+}
+
+func BenchmarkEtcdAllocateVlan100Tenants(b *testing.B) {
+	benchmarkEtcdAllocateVlan(b, 100)
+}
+
+func BenchmarkEtcdAllocateVlan1000Tenants(b *testing.B) {
+	benchmarkEtcdAllocateVlan(b, 1000)
+}
+
+func BenchmarkCachedAllocateVlan10Tenants(b *testing.B) {
+	benchmarkCachedAllocateVlan(b, 10)
+}
+
+func BenchmarkCachedAllocateVlan100Tenants(b *testing.B) {
+	benchmarkCachedAllocateVlan(b, 100)
+}
+
+func BenchmarkCachedAllocateVlan1000Tenants(b *testing.B) {
+	benchmarkCachedAllocateVlan(b, 1000)
+}
@@ -18,6 +18,7 @@ package resources
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/contiv/netplugin/core"
 )
@@ -30,6 +31,8 @@ var ResourceRegistry = map[string]reflect.Type{
 	AUTO_VLAN_RSRC:   reflect.TypeOf(AutoVlanCfgResource{}),
 	AUTO_VXLAN_RSRC:  reflect.TypeOf(AutoVxlanCfgResource{}),
 	AUTO_SUBNET_RSRC: reflect.TypeOf(AutoSubnetCfgResource{}),
+	AUTO_IP_RSRC:     reflect.TypeOf(AutoIpCfgResource{}),
+	AUTO_MAC_RSRC:    reflect.TypeOf(AutoMacCfgResource{}),
 }
 
 type EtcdResourceManager struct {
@@ -37,6 +40,9 @@ type EtcdResourceManager struct {
 	//core.StateDriver to get tests going and until the netmaster
 	//is changed to pickup the resource-manager from config
 	Etcd core.StateDriver
+	// resources kept in memory, nil unless the manager is a
+	// CachedResourceManager
+	cache *resourceCache
 }
 
 func (ra *EtcdResourceManager) Init() error {
@@ -46,7 +52,6 @@ func (ra *EtcdResourceManager) Init() error {
 func (ra *EtcdResourceManager) Deinit() {
 }
 
-// XXX: It might be better to keep cache of resources and avoid frequent etcd reads
 func (ra *EtcdResourceManager) findResource(id, desc string) (core.Resource, bool, error) {
 	alreadyExists := false
 	rsrcType, ok := ResourceRegistry[desc]
@@ -56,6 +61,12 @@ func (ra *EtcdResourceManager) findResource(id, desc string) (core.Resource, boo
 				desc)}
 	}
 
+	if rsrc, ok := ra.cache.get(id, desc); ok {
+		alreadyExists = true
+		return rsrc, alreadyExists, nil
+	}
+
+	generation := ra.cache.generation(id, desc)
 	val := reflect.New(rsrcType)
 	// sanity checks
 	if !val.Elem().FieldByName("CommonState").IsValid() {
@@ -67,22 +78,16 @@ func (ra *EtcdResourceManager) findResource(id, desc string) (core.Resource, boo
 	val.Elem().FieldByName("CommonState").FieldByName("Id").Set(reflect.ValueOf(id))
 
 	rsrc := val.Interface().(core.Resource)
-	rsrcs, err := rsrc.ReadAll()
+	err := rsrc.Read(id)
 	if core.ErrIfKeyExists(err) != nil {
 		return nil, alreadyExists, err
 	} else if err != nil {
-		// set the slice as empty in case of 'key not found' error
-		rsrcs = []core.State{}
+		// 'key not found' error, the resource is yet to be defined
+		return rsrc, alreadyExists, nil
 	}
 
-	for _, r := range rsrcs {
-		//the following works as every core.State is expected to embed core.CommonState struct
-		cs := reflect.ValueOf(r).Elem().FieldByName("CommonState").Interface().(core.CommonState)
-		if cs.Id == id {
-			alreadyExists = true
-			return r.(core.Resource), alreadyExists, nil
-		}
-	}
+	alreadyExists = true
+	ra.cache.put(id, desc, generation, rsrc)
 	return rsrc, alreadyExists, nil
 }
 
@@ -120,10 +125,40 @@ func (ra *EtcdResourceManager) UndefineResource(id, desc string) error {
 	}
 
 	rsrc.Deinit()
+	ra.cache.forget(resourceCfgKey(id, desc))
 	return nil
 
 }
 
+func (ra *EtcdResourceManager) RedefineResource(id, desc string,
+	rsrcCfg interface{}) error {
+	// XXX: need to take care of distibuted updates, locks etc here
+	rsrc, alreadyExists, err := ra.findResource(id, desc)
+	if err != nil {
+		return err
+	}
+
+	if !alreadyExists {
+		return &core.Error{Desc: fmt.Sprintf("No resource found for description: %q and id: %q",
+			desc, id)}
+	}
+
+	resizable, ok := rsrc.(core.ResizableResource)
+	if !ok {
+		return &core.Error{Desc: fmt.Sprintf("Resource with description: %q doesn't support resizing",
+			desc)}
+	}
+
+	err = resizable.Resize(rsrcCfg)
+	if err != nil {
+		// a failed resize might leave the resource in memory changed
+		ra.cache.forget(resourceCfgKey(id, desc))
+		return err
+	}
+
+	return nil
+}
+
 func (ra *EtcdResourceManager) AllocateResourceVal(id, desc string) (interface{},
 	error) {
 	// XXX: need to take care of distibuted updates, locks etc here
@@ -140,6 +175,50 @@ func (ra *EtcdResourceManager) AllocateResourceVal(id, desc string) (interface{}
 	return rsrc.Allocate()
 }
 
+func (ra *EtcdResourceManager) AllocateResourceValWithHint(id, desc,
+	hint string) (interface{}, error) {
+	// XXX: need to take care of distibuted updates, locks etc here
+	rsrc, alreadyExists, err := ra.findResource(id, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !alreadyExists {
+		return nil, &core.Error{Desc: fmt.Sprintf("No resource found for description: %q and id: %q",
+			desc, id)}
+	}
+
+	// resources that don't take hints allocate as usual
+	hinted, ok := rsrc.(core.HintedResource)
+	if !ok {
+		return rsrc.Allocate()
+	}
+
+	return hinted.AllocateWithHint(hint)
+}
+
+func (ra *EtcdResourceManager) ReserveResourceVal(id, desc string,
+	value interface{}, owner string) error {
+	// XXX: need to take care of distibuted updates, locks etc here
+	rsrc, alreadyExists, err := ra.findResource(id, desc)
+	if err != nil {
+		return err
+	}
+
+	if !alreadyExists {
+		return &core.Error{Desc: fmt.Sprintf("No resource found for description: %q and id: %q",
+			desc, id)}
+	}
+
+	reservable, ok := rsrc.(core.ReservableResource)
+	if !ok {
+		return &core.Error{Desc: fmt.Sprintf("Resource with description: %q doesn't support reserving a value",
+			desc)}
+	}
+
+	return reservable.Reserve(value, owner)
+}
+
 func (ra *EtcdResourceManager) DeallocateResourceVal(id, desc string,
 	value interface{}) error {
 	// XXX: need to take care of distibuted updates, locks etc here
@@ -155,3 +234,37 @@ func (ra *EtcdResourceManager) DeallocateResourceVal(id, desc string,
 
 	return rsrc.Deallocate(value)
 }
+
+// GetResourceUsage reports the usage of the resources of the registry defined
+// with the id, in the order of their descriptions
+func (ra *EtcdResourceManager) GetResourceUsage(id string) ([]core.ResourceUsage,
+	error) {
+	descs := []string{}
+	for desc := range ResourceRegistry {
+		descs = append(descs, desc)
+	}
+	sort.Strings(descs)
+
+	usages := []core.ResourceUsage{}
+	for _, desc := range descs {
+		rsrc, alreadyExists, err := ra.findResource(id, desc)
+		if err != nil {
+			return nil, err
+		}
+		if !alreadyExists {
+			continue
+		}
+
+		reporting, ok := rsrc.(core.UsageReportingResource)
+		if !ok {
+			continue
+		}
+		usage, err := reporting.Usage()
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage...)
+	}
+
+	return usages, nil
+}
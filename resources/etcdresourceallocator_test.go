@@ -43,7 +43,12 @@ func (r *TestResource) Write() error {
 }
 
 func (r *TestResource) Read(id string) error {
-	return &core.Error{Desc: "Shouldn't be called"}
+	if gReadCtr == 0 {
+		gReadCtr = 1
+		return &core.Error{Desc: "Key not found"}
+	} else {
+		return nil
+	}
 }
 
 func (r *TestResource) Clear() error {
@@ -51,12 +56,7 @@ func (r *TestResource) Clear() error {
 }
 
 func (r *TestResource) ReadAll() ([]core.State, error) {
-	if gReadCtr == 0 {
-		gReadCtr = 1
-		return []core.State{}, nil
-	} else {
-		return []core.State{core.State(r)}, nil
-	}
+	return nil, &core.Error{Desc: "Shouldn't be called"}
 }
 
 func (r *TestResource) Init(rsrcCfg interface{}) error {
@@ -251,3 +251,24 @@ func TestEtcdResourceManagerDeallocateiNonexistentResource(t *testing.T) {
 		t.Fatalf("Unexpected error. Error: %s", err)
 	}
 }
+
+func TestEtcdResourceManagerReserveUnsupportedResource(t *testing.T) {
+	ra := &EtcdResourceManager{Etcd: fakeDriver}
+	ResourceRegistry[testResourceDesc] = reflect.TypeOf(TestResource{})
+	defer func() { delete(ResourceRegistry, testResourceDesc) }()
+
+	gReadCtr = 0
+	err := ra.DefineResource(testResourceId, testResourceDesc, &TestResource{})
+	if err != nil {
+		t.Fatalf("Resource definition failed. Error: %s", err)
+	}
+
+	err = ra.ReserveResourceVal(testResourceId, testResourceDesc, 0, "")
+	if err == nil {
+		t.Fatalf("Resource reservation succeeded, expected to fail!")
+	}
+	if err.Error() != fmt.Sprintf("Resource with description: %q doesn't support reserving a value",
+		testResourceDesc) {
+		t.Fatalf("Unexpected error. Error: %s", err)
+	}
+}
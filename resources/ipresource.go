@@ -0,0 +1,285 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/jainvipin/bitset"
+)
+
+// implements the Resource interface for an 'auto-ip' resource.
+// 'auto-ip' resource allocates the host addresses of a network's subnet
+// specified at time of resource instantiation, excluding the addresses marked
+// as reserved. Allocate hands out the lowest available address of the
+// allocation range, Reserve allocates a specific address of the subnet.
+
+const (
+	AUTO_IP_RSRC = "auto-ip"
+)
+
+const (
+	IP_RSRC_CFG_PATH_PREFIX  = drivers.CFG_PATH + AUTO_IP_RSRC + "/"
+	IP_RSRC_CFG_PATH         = IP_RSRC_CFG_PATH_PREFIX + "%s"
+	IP_RSRC_OPER_PATH_PREFIX = drivers.OPER_PATH + AUTO_IP_RSRC + "/"
+	IP_RSRC_OPER_PATH        = IP_RSRC_OPER_PATH_PREFIX + "%s"
+)
+
+type AutoIpCfgResource struct {
+	core.CommonState
+	SubnetIp  net.IP `json:"subnetIp"`
+	SubnetLen uint   `json:"subnetLen"`
+	// host ids of the addresses that are never allocated
+	Reserved *bitset.BitSet `json:"reserved"`
+	// host ids of the first and the last address handed out by Allocate
+	AllocStart uint `json:"allocStart"`
+	AllocEnd   uint `json:"allocEnd"`
+}
+
+func (r *AutoIpCfgResource) Write() error {
+	key := fmt.Sprintf(IP_RSRC_CFG_PATH, r.Id)
+	return r.StateDriver.WriteState(key, r, json.Marshal)
+}
+
+func (r *AutoIpCfgResource) Read(id string) error {
+	key := fmt.Sprintf(IP_RSRC_CFG_PATH, id)
+	return r.StateDriver.ReadState(key, r, json.Unmarshal)
+}
+
+func (r *AutoIpCfgResource) Clear() error {
+	key := fmt.Sprintf(IP_RSRC_CFG_PATH, r.Id)
+	return r.StateDriver.ClearState(key)
+}
+
+func (r *AutoIpCfgResource) ReadAll() ([]core.State, error) {
+	return r.StateDriver.ReadAllState(IP_RSRC_CFG_PATH_PREFIX, r,
+		json.Unmarshal)
+}
+
+func (r *AutoIpCfgResource) Init(rsrcCfg interface{}) error {
+	cfg, ok := rsrcCfg.(*AutoIpCfgResource)
+	if !ok {
+		return &core.Error{Desc: "Invalid type for ip resource config"}
+	}
+	if cfg.SubnetLen > 32 {
+		return &core.Error{Desc: fmt.Sprintf("Invalid subnet length %d",
+			cfg.SubnetLen)}
+	}
+	maxHosts := uint(1) << (32 - cfg.SubnetLen)
+	if cfg.AllocStart > cfg.AllocEnd || cfg.AllocEnd >= maxHosts {
+		return &core.Error{Desc: fmt.Sprintf("Invalid allocation range %d-%d",
+			cfg.AllocStart, cfg.AllocEnd)}
+	}
+
+	r.SubnetIp = cfg.SubnetIp
+	r.SubnetLen = cfg.SubnetLen
+	r.Reserved = cfg.Reserved
+	if r.Reserved == nil {
+		r.Reserved = netutils.CreateBitset(32 - r.SubnetLen)
+	}
+	r.AllocStart = cfg.AllocStart
+	r.AllocEnd = cfg.AllocEnd
+
+	err := r.Write()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			r.Clear()
+		}
+	}()
+
+	freeIps := netutils.CreateBitset(32 - r.SubnetLen).Complement()
+	for hostId, ok := r.Reserved.NextSet(0); ok; hostId, ok = r.Reserved.NextSet(hostId + 1) {
+		freeIps.Clear(hostId)
+	}
+	oper := &AutoIpOperResource{FreeIps: freeIps}
+	oper.StateDriver = r.StateDriver
+	oper.Id = r.Id
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *AutoIpCfgResource) Deinit() {
+	oper := &AutoIpOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		// continue cleanup
+	} else {
+		err = oper.Clear()
+		if err != nil {
+			// continue cleanup
+		}
+	}
+
+	r.Clear()
+}
+
+func (r *AutoIpCfgResource) Description() string {
+	return AUTO_IP_RSRC
+}
+
+func (r *AutoIpCfgResource) hostId(value interface{}) (uint, error) {
+	ip, ok := value.(net.IP)
+	if !ok {
+		return 0, &core.Error{Desc: "Invalid type for ip value"}
+	}
+
+	return netutils.GetIpNumber(r.SubnetIp.String(), r.SubnetLen, 32,
+		ip.String())
+}
+
+func (r *AutoIpCfgResource) Allocate() (interface{}, error) {
+	oper := &AutoIpOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	hostId, ok := oper.FreeIps.NextSet(r.AllocStart)
+	if !ok || hostId > r.AllocEnd {
+		return nil, &core.Error{Desc: fmt.Sprintf("no ips available in subnet %s/%d",
+			r.SubnetIp, r.SubnetLen)}
+	}
+
+	oper.FreeIps.Clear(hostId)
+
+	var ipAddress string
+	ipAddress, err = netutils.GetSubnetIp(r.SubnetIp.String(), r.SubnetLen,
+		32, hostId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = oper.Write()
+	if err != nil {
+		return nil, err
+	}
+	return net.ParseIP(ipAddress), nil
+}
+
+// Reserve marks an ip of the subnet as in use, the owners of the ips aren't
+// kept track of
+func (r *AutoIpCfgResource) Reserve(value interface{}, owner string) error {
+	oper := &AutoIpOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	hostId, err := r.hostId(value)
+	if err != nil {
+		return err
+	}
+
+	if r.Reserved.Test(hostId) {
+		return &core.Error{Desc: fmt.Sprintf("ip %s is reserved", value)}
+	}
+	if !oper.FreeIps.Test(hostId) {
+		return &core.Error{Desc: fmt.Sprintf("ip %s is already in use", value)}
+	}
+	oper.FreeIps.Clear(hostId)
+
+	return oper.Write()
+}
+
+func (r *AutoIpCfgResource) Deallocate(value interface{}) error {
+	oper := &AutoIpOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	hostId, err := r.hostId(value)
+	if err != nil {
+		return err
+	}
+
+	if r.Reserved.Test(hostId) || oper.FreeIps.Test(hostId) {
+		return nil
+	}
+	oper.FreeIps.Set(hostId)
+
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Usage reports the addresses in use, other than the reserved ones, as owned
+// by the network of the resource
+func (r *AutoIpCfgResource) Usage() ([]core.ResourceUsage, error) {
+	oper := &AutoIpOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	hostIds := netutils.CreateBitset(32 - r.SubnetLen).Complement()
+	for hostId, ok := r.Reserved.NextSet(0); ok; hostId, ok = r.Reserved.NextSet(hostId + 1) {
+		hostIds.Clear(hostId)
+	}
+	usage, err := rangeUsage(r.Id, AUTO_IP_RSRC, hostIds, oper.FreeIps,
+		func(hostId uint) (string, error) {
+			return netutils.GetSubnetIp(r.SubnetIp.String(), r.SubnetLen, 32,
+				hostId)
+		}, nil, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return []core.ResourceUsage{usage}, nil
+}
+
+type AutoIpOperResource struct {
+	core.CommonState
+	FreeIps *bitset.BitSet `json:"freeIps"`
+}
+
+func (r *AutoIpOperResource) Write() error {
+	key := fmt.Sprintf(IP_RSRC_OPER_PATH, r.Id)
+	return r.StateDriver.WriteState(key, r, json.Marshal)
+}
+
+func (r *AutoIpOperResource) Read(id string) error {
+	key := fmt.Sprintf(IP_RSRC_OPER_PATH, id)
+	return r.StateDriver.ReadState(key, r, json.Unmarshal)
+}
+
+func (r *AutoIpOperResource) ReadAll() ([]core.State, error) {
+	return r.StateDriver.ReadAllState(IP_RSRC_OPER_PATH_PREFIX, r,
+		json.Unmarshal)
+}
+
+func (r *AutoIpOperResource) Clear() error {
+	key := fmt.Sprintf(IP_RSRC_OPER_PATH, r.Id)
+	return r.StateDriver.ClearState(key)
+}
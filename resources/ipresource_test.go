@@ -0,0 +1,136 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+)
+
+const (
+	ipRsrcNetId = "ipRsrcNetId"
+)
+
+func defineTestIpResource(t *testing.T, allocStart, allocEnd uint) *EtcdResourceManager {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	reserved := netutils.CreateBitset(8)
+	reserved.Set(0).Set(1).Set(255)
+	err := ra.DefineResource(ipRsrcNetId, AUTO_IP_RSRC,
+		&AutoIpCfgResource{SubnetIp: net.ParseIP("11.1.1.0"), SubnetLen: 24,
+			Reserved: reserved, AllocStart: allocStart, AllocEnd: allocEnd})
+	if err != nil {
+		t.Fatalf("error '%s' defining ip resource \n", err)
+	}
+
+	return ra
+}
+
+func allocateTestIp(t *testing.T, ra *EtcdResourceManager, expIp string) {
+	ip, err := ra.AllocateResourceVal(ipRsrcNetId, AUTO_IP_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating ip \n", err)
+	}
+	if ip.(net.IP).String() != expIp {
+		t.Fatalf("allocated ip %s, expected %s \n", ip, expIp)
+	}
+}
+
+func TestIpRsrcAllocate(t *testing.T) {
+	ra := defineTestIpResource(t, 0, 254)
+
+	allocateTestIp(t, ra, "11.1.1.2")
+	allocateTestIp(t, ra, "11.1.1.3")
+
+	err := ra.DeallocateResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.1.2"))
+	if err != nil {
+		t.Fatalf("error '%s' deallocating ip \n", err)
+	}
+	allocateTestIp(t, ra, "11.1.1.2")
+}
+
+func TestIpRsrcAllocateRange(t *testing.T) {
+	ra := defineTestIpResource(t, 100, 101)
+
+	allocateTestIp(t, ra, "11.1.1.100")
+	allocateTestIp(t, ra, "11.1.1.101")
+
+	_, err := ra.AllocateResourceVal(ipRsrcNetId, AUTO_IP_RSRC)
+	if err == nil || !strings.Contains(err.Error(), "no ips available") {
+		t.Fatalf("allocation beyond the range, err '%v' \n", err)
+	}
+}
+
+func TestIpRsrcReserve(t *testing.T) {
+	ra := defineTestIpResource(t, 0, 254)
+
+	err := ra.ReserveResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.1.2"), "")
+	if err != nil {
+		t.Fatalf("error '%s' reserving ip \n", err)
+	}
+	allocateTestIp(t, ra, "11.1.1.3")
+
+	err = ra.ReserveResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.1.3"), "")
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("reserving an ip in use, err '%v' \n", err)
+	}
+
+	err = ra.ReserveResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.1.1"), "")
+	if err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Fatalf("reserving a reserved ip, err '%v' \n", err)
+	}
+
+	err = ra.ReserveResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.2.1"), "")
+	if err == nil {
+		t.Fatalf("reserving an ip outside the subnet succeeded \n")
+	}
+
+	// reserved addresses are never freed
+	err = ra.DeallocateResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.1.1"))
+	if err != nil {
+		t.Fatalf("error '%s' deallocating ip \n", err)
+	}
+	err = ra.ReserveResourceVal(ipRsrcNetId, AUTO_IP_RSRC,
+		net.ParseIP("11.1.1.1"), "")
+	if err == nil {
+		t.Fatalf("reserved ip freed by deallocation \n")
+	}
+}
+
+func TestIpRsrcInvalidRange(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	err := ra.DefineResource(ipRsrcNetId, AUTO_IP_RSRC,
+		&AutoIpCfgResource{SubnetIp: net.ParseIP("11.1.1.0"), SubnetLen: 24,
+			AllocStart: 10, AllocEnd: 256})
+	if err == nil {
+		t.Fatalf("ip resource with a range beyond the subnet defined \n")
+	}
+}
@@ -0,0 +1,270 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/jainvipin/bitset"
+)
+
+// implements the Resource interface for an 'auto-mac' resource.
+// 'auto-mac' resource allocates the mac addresses of a pool, an oui prefixed
+// range of macs, specified at time of resource instantiation. Allocate hands
+// out the lowest available mac, Reserve allocates a specific mac of the pool.
+
+const (
+	AUTO_MAC_RSRC = "auto-mac"
+)
+
+const (
+	MAC_RSRC_CFG_PATH_PREFIX  = drivers.CFG_PATH + AUTO_MAC_RSRC + "/"
+	MAC_RSRC_CFG_PATH         = MAC_RSRC_CFG_PATH_PREFIX + "%s"
+	MAC_RSRC_OPER_PATH_PREFIX = drivers.OPER_PATH + AUTO_MAC_RSRC + "/"
+	MAC_RSRC_OPER_PATH        = MAC_RSRC_OPER_PATH_PREFIX + "%s"
+)
+
+type AutoMacCfgResource struct {
+	core.CommonState
+	MacPrefix  string `json:"macPrefix"`
+	MacPoolLen uint   `json:"macPoolLen"`
+}
+
+func (r *AutoMacCfgResource) Write() error {
+	key := fmt.Sprintf(MAC_RSRC_CFG_PATH, r.Id)
+	return r.StateDriver.WriteState(key, r, json.Marshal)
+}
+
+func (r *AutoMacCfgResource) Read(id string) error {
+	key := fmt.Sprintf(MAC_RSRC_CFG_PATH, id)
+	return r.StateDriver.ReadState(key, r, json.Unmarshal)
+}
+
+func (r *AutoMacCfgResource) Clear() error {
+	key := fmt.Sprintf(MAC_RSRC_CFG_PATH, r.Id)
+	return r.StateDriver.ClearState(key)
+}
+
+func (r *AutoMacCfgResource) ReadAll() ([]core.State, error) {
+	return r.StateDriver.ReadAllState(MAC_RSRC_CFG_PATH_PREFIX, r,
+		json.Unmarshal)
+}
+
+func (r *AutoMacCfgResource) Init(rsrcCfg interface{}) error {
+	cfg, ok := rsrcCfg.(*AutoMacCfgResource)
+	if !ok {
+		return &core.Error{Desc: "Invalid type for mac resource config"}
+	}
+	_, _, err := netutils.ParseMacPool(fmt.Sprintf("%s/%d", cfg.MacPrefix,
+		cfg.MacPoolLen))
+	if err != nil {
+		return err
+	}
+	r.MacPrefix = cfg.MacPrefix
+	r.MacPoolLen = cfg.MacPoolLen
+
+	err = r.Write()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			r.Clear()
+		}
+	}()
+
+	oper := &AutoMacOperResource{FreeMacs: netutils.CreateBitset(48 - r.MacPoolLen).Complement()}
+	oper.StateDriver = r.StateDriver
+	oper.Id = r.Id
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *AutoMacCfgResource) Deinit() {
+	oper := &AutoMacOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		// continue cleanup
+	} else {
+		err = oper.Clear()
+		if err != nil {
+			// continue cleanup
+		}
+	}
+
+	r.Clear()
+}
+
+func (r *AutoMacCfgResource) Description() string {
+	return AUTO_MAC_RSRC
+}
+
+func (r *AutoMacCfgResource) prefix() (net.HardwareAddr, error) {
+	return net.ParseMAC(r.MacPrefix)
+}
+
+func (r *AutoMacCfgResource) hostId(value interface{}) (uint, error) {
+	mac, ok := value.(net.HardwareAddr)
+	if !ok {
+		return 0, &core.Error{Desc: "Invalid type for mac value"}
+	}
+	prefix, err := r.prefix()
+	if err != nil {
+		return 0, err
+	}
+
+	return netutils.GetMacNumber(prefix, r.MacPoolLen, mac.String())
+}
+
+func (r *AutoMacCfgResource) Allocate() (interface{}, error) {
+	oper := &AutoMacOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	hostId, ok := oper.FreeMacs.NextSet(0)
+	if !ok {
+		return nil, &core.Error{Desc: fmt.Sprintf("no macs available in pool %s/%d",
+			r.MacPrefix, r.MacPoolLen)}
+	}
+
+	oper.FreeMacs.Clear(hostId)
+
+	prefix, err := r.prefix()
+	if err != nil {
+		return nil, err
+	}
+	var macAddr string
+	macAddr, err = netutils.GetMacAddr(prefix, r.MacPoolLen, hostId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = oper.Write()
+	if err != nil {
+		return nil, err
+	}
+	mac, _ := net.ParseMAC(macAddr)
+	return mac, nil
+}
+
+// Reserve marks a mac of the pool as in use, the owners of the macs aren't
+// kept track of
+func (r *AutoMacCfgResource) Reserve(value interface{}, owner string) error {
+	oper := &AutoMacOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	hostId, err := r.hostId(value)
+	if err != nil {
+		return err
+	}
+
+	if !oper.FreeMacs.Test(hostId) {
+		return &core.Error{Desc: fmt.Sprintf("mac %s is already in use", value)}
+	}
+	oper.FreeMacs.Clear(hostId)
+
+	return oper.Write()
+}
+
+func (r *AutoMacCfgResource) Deallocate(value interface{}) error {
+	oper := &AutoMacOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	hostId, err := r.hostId(value)
+	if err != nil {
+		return err
+	}
+
+	if oper.FreeMacs.Test(hostId) {
+		return nil
+	}
+	oper.FreeMacs.Set(hostId)
+
+	err = oper.Write()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *AutoMacCfgResource) Usage() ([]core.ResourceUsage, error) {
+	oper := &AutoMacOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := r.prefix()
+	if err != nil {
+		return nil, err
+	}
+
+	macs := netutils.CreateBitset(48 - r.MacPoolLen).Complement()
+	usage, err := rangeUsage(r.Id, AUTO_MAC_RSRC, macs, oper.FreeMacs,
+		func(hostId uint) (string, error) {
+			return netutils.GetMacAddr(prefix, r.MacPoolLen, hostId)
+		}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return []core.ResourceUsage{usage}, nil
+}
+
+type AutoMacOperResource struct {
+	core.CommonState
+	FreeMacs *bitset.BitSet `json:"freeMacs"`
+}
+
+func (r *AutoMacOperResource) Write() error {
+	key := fmt.Sprintf(MAC_RSRC_OPER_PATH, r.Id)
+	return r.StateDriver.WriteState(key, r, json.Marshal)
+}
+
+func (r *AutoMacOperResource) Read(id string) error {
+	key := fmt.Sprintf(MAC_RSRC_OPER_PATH, id)
+	return r.StateDriver.ReadState(key, r, json.Unmarshal)
+}
+
+func (r *AutoMacOperResource) ReadAll() ([]core.State, error) {
+	return r.StateDriver.ReadAllState(MAC_RSRC_OPER_PATH_PREFIX, r,
+		json.Unmarshal)
+}
+
+func (r *AutoMacOperResource) Clear() error {
+	key := fmt.Sprintf(MAC_RSRC_OPER_PATH, r.Id)
+	return r.StateDriver.ClearState(key)
+}
@@ -0,0 +1,104 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+)
+
+const (
+	macRsrcTenant = "macRsrcTenant"
+)
+
+func defineTestMacResource(t *testing.T, poolLen uint) *EtcdResourceManager {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	err := ra.DefineResource(macRsrcTenant, AUTO_MAC_RSRC,
+		&AutoMacCfgResource{MacPrefix: "02:02:ac:11:00:00", MacPoolLen: poolLen})
+	if err != nil {
+		t.Fatalf("error '%s' defining mac resource \n", err)
+	}
+
+	return ra
+}
+
+func allocateTestMac(t *testing.T, ra *EtcdResourceManager, expMac string) {
+	mac, err := ra.AllocateResourceVal(macRsrcTenant, AUTO_MAC_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating mac \n", err)
+	}
+	if mac.(net.HardwareAddr).String() != expMac {
+		t.Fatalf("allocated mac %s, expected %s \n", mac, expMac)
+	}
+}
+
+func TestMacRsrcAllocate(t *testing.T) {
+	ra := defineTestMacResource(t, 47)
+
+	allocateTestMac(t, ra, "02:02:ac:11:00:00")
+	allocateTestMac(t, ra, "02:02:ac:11:00:01")
+
+	_, err := ra.AllocateResourceVal(macRsrcTenant, AUTO_MAC_RSRC)
+	if err == nil || !strings.Contains(err.Error(), "no macs available") {
+		t.Fatalf("allocation beyond the pool, err '%v' \n", err)
+	}
+
+	mac, _ := net.ParseMAC("02:02:ac:11:00:00")
+	err = ra.DeallocateResourceVal(macRsrcTenant, AUTO_MAC_RSRC, mac)
+	if err != nil {
+		t.Fatalf("error '%s' deallocating mac \n", err)
+	}
+	allocateTestMac(t, ra, "02:02:ac:11:00:00")
+}
+
+func TestMacRsrcReserve(t *testing.T) {
+	ra := defineTestMacResource(t, 32)
+
+	mac, _ := net.ParseMAC("02:02:ac:11:01:05")
+	err := ra.ReserveResourceVal(macRsrcTenant, AUTO_MAC_RSRC, mac, "")
+	if err != nil {
+		t.Fatalf("error '%s' reserving mac \n", err)
+	}
+
+	err = ra.ReserveResourceVal(macRsrcTenant, AUTO_MAC_RSRC, mac, "")
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("reserving a mac in use, err '%v' \n", err)
+	}
+
+	mac, _ = net.ParseMAC("02:02:ac:12:01:05")
+	err = ra.ReserveResourceVal(macRsrcTenant, AUTO_MAC_RSRC, mac, "")
+	if err == nil {
+		t.Fatalf("reserving a mac outside the pool succeeded \n")
+	}
+}
+
+func TestMacRsrcInvalidPool(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	err := ra.DefineResource(macRsrcTenant, AUTO_MAC_RSRC,
+		&AutoMacCfgResource{MacPrefix: "02:02:ac:11:00:00", MacPoolLen: 24})
+	if err == nil {
+		t.Fatalf("mac resource with a pool too big defined \n")
+	}
+}
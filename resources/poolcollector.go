@@ -0,0 +1,208 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"log"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/contiv/netplugin/drivers"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector implements the prometheus.Collector interface to report the
+// capacity and usage of the auto-allocated resource pools of every tenant.
+// The values are derived from the cfg and oper resource bitsets at the time of
+// collection, so they reflect the state store and not a local view. The local
+// vlans the hosts pick for the vxlan networks are reported per host, instead
+// of per tenant.
+
+const (
+	LOCAL_VLAN_POOL = "local-vlan"
+)
+
+var (
+	poolCapacityDesc = prometheus.NewDesc(
+		"netplugin_resource_pool_capacity",
+		"Number of values that can be allocated from a tenant's resource pool.",
+		[]string{"tenant", "resource"}, nil)
+	poolUsedDesc = prometheus.NewDesc(
+		"netplugin_resource_pool_used",
+		"Number of values allocated from a tenant's resource pool.",
+		[]string{"tenant", "resource"}, nil)
+	hostVlanCapacityDesc = prometheus.NewDesc(
+		"netplugin_host_vlan_pool_capacity",
+		"Number of vlans a host can pick the local vlans of the vxlan networks from.",
+		[]string{"host"}, nil)
+	hostVlanUsedDesc = prometheus.NewDesc(
+		"netplugin_host_vlan_pool_used",
+		"Number of local vlans a host picked for the vxlan networks.",
+		[]string{"host"}, nil)
+)
+
+type PoolCollector struct {
+	StateDriver core.StateDriver
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolCapacityDesc
+	ch <- poolUsedDesc
+	ch <- hostVlanCapacityDesc
+	ch <- hostVlanUsedDesc
+}
+
+func emitPoolUsage(ch chan<- prometheus.Metric, tenant, pool string,
+	capacity, free uint) {
+	used := uint(0)
+	if capacity > free {
+		used = capacity - free
+	}
+	ch <- prometheus.MustNewConstMetric(poolCapacityDesc,
+		prometheus.GaugeValue, float64(capacity), tenant, pool)
+	ch <- prometheus.MustNewConstMetric(poolUsedDesc,
+		prometheus.GaugeValue, float64(used), tenant, pool)
+}
+
+func (c *PoolCollector) collectVlans(ch chan<- prometheus.Metric) error {
+	readRsrc := &AutoVlanCfgResource{}
+	readRsrc.StateDriver = c.StateDriver
+	rsrcs, err := readRsrc.ReadAll()
+	if core.ErrIfKeyExists(err) != nil {
+		return err
+	} else if err != nil {
+		rsrcs = []core.State{}
+	}
+
+	for _, rsrc := range rsrcs {
+		cfg := rsrc.(*AutoVlanCfgResource)
+		oper := &AutoVlanOperResource{}
+		oper.StateDriver = c.StateDriver
+		err = oper.Read(cfg.Id)
+		if err != nil {
+			log.Printf("error '%s' reading vlan oper for tenant %s \n",
+				err, cfg.Id)
+			continue
+		}
+		emitPoolUsage(ch, cfg.Id, AUTO_VLAN_RSRC, cfg.Vlans.Count(),
+			oper.FreeVlans.Count())
+	}
+
+	return nil
+}
+
+func (c *PoolCollector) collectVxlans(ch chan<- prometheus.Metric) error {
+	readRsrc := &AutoVxlanCfgResource{}
+	readRsrc.StateDriver = c.StateDriver
+	rsrcs, err := readRsrc.ReadAll()
+	if core.ErrIfKeyExists(err) != nil {
+		return err
+	} else if err != nil {
+		rsrcs = []core.State{}
+	}
+
+	for _, rsrc := range rsrcs {
+		cfg := rsrc.(*AutoVxlanCfgResource)
+		oper := &AutoVxlanOperResource{}
+		oper.StateDriver = c.StateDriver
+		err = oper.Read(cfg.Id)
+		if err != nil {
+			log.Printf("error '%s' reading vxlan oper for tenant %s \n",
+				err, cfg.Id)
+			continue
+		}
+		emitPoolUsage(ch, cfg.Id, AUTO_VXLAN_RSRC, cfg.Vxlans.Count(),
+			oper.FreeVxlans.Count())
+		if !cfg.HostLocalVlans {
+			emitPoolUsage(ch, cfg.Id, LOCAL_VLAN_POOL, cfg.LocalVlans.Count(),
+				oper.FreeLocalVlans.Count())
+		}
+	}
+
+	return nil
+}
+
+func (c *PoolCollector) collectHostVlans(ch chan<- prometheus.Metric) error {
+	hostVlans, err := drivers.ReadHostVlans(c.StateDriver)
+	if err != nil {
+		return err
+	}
+	capacity := hostVlans.Count()
+	if capacity == 0 {
+		return nil
+	}
+
+	readOper := &drivers.OvsOperHostVlanState{}
+	readOper.StateDriver = c.StateDriver
+	opers, err := readOper.ReadAll()
+	if core.ErrIfKeyExists(err) != nil {
+		return err
+	} else if err != nil {
+		opers = []core.State{}
+	}
+
+	for _, state := range opers {
+		oper := state.(*drivers.OvsOperHostVlanState)
+		ch <- prometheus.MustNewConstMetric(hostVlanCapacityDesc,
+			prometheus.GaugeValue, float64(capacity), oper.Id)
+		ch <- prometheus.MustNewConstMetric(hostVlanUsedDesc,
+			prometheus.GaugeValue, float64(len(oper.Vlans)), oper.Id)
+	}
+
+	return nil
+}
+
+func (c *PoolCollector) collectSubnets(ch chan<- prometheus.Metric) error {
+	readRsrc := &AutoSubnetCfgResource{}
+	readRsrc.StateDriver = c.StateDriver
+	rsrcs, err := readRsrc.ReadAll()
+	if core.ErrIfKeyExists(err) != nil {
+		return err
+	} else if err != nil {
+		rsrcs = []core.State{}
+	}
+
+	for _, rsrc := range rsrcs {
+		cfg := rsrc.(*AutoSubnetCfgResource)
+		oper := &AutoSubnetOperResource{}
+		oper.StateDriver = c.StateDriver
+		err = oper.Read(cfg.Id)
+		if err != nil {
+			log.Printf("error '%s' reading subnet oper for tenant %s \n",
+				err, cfg.Id)
+			continue
+		}
+		capacity := uint(1) << (cfg.AllocSubnetLen - cfg.SubnetPoolLen)
+		emitPoolUsage(ch, cfg.Id, AUTO_SUBNET_RSRC, capacity,
+			oper.FreeSubnets.Count())
+	}
+
+	return nil
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.collectVlans(ch); err != nil {
+		log.Printf("error '%s' collecting vlan pool usage \n", err)
+	}
+	if err := c.collectVxlans(ch); err != nil {
+		log.Printf("error '%s' collecting vxlan pool usage \n", err)
+	}
+	if err := c.collectSubnets(ch); err != nil {
+		log.Printf("error '%s' collecting subnet pool usage \n", err)
+	}
+	if err := c.collectHostVlans(ch); err != nil {
+		log.Printf("error '%s' collecting host vlan pool usage \n", err)
+	}
+}
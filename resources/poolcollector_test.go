@@ -0,0 +1,144 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	poolCollectorTenant = "poolCollectorTenant"
+)
+
+func TestPoolCollectorVlanUsage(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	defer func() { sd.Deinit() }()
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	vlans := netutils.CreateBitset(12)
+	for vlan := uint(10); vlan < 20; vlan++ {
+		vlans.Set(vlan)
+	}
+	err := ra.DefineResource(poolCollectorTenant, AUTO_VLAN_RSRC, vlans)
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = ra.AllocateResourceVal(poolCollectorTenant, AUTO_VLAN_RSRC)
+		if err != nil {
+			t.Fatalf("error '%s' allocating vlan \n", err)
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&PoolCollector{StateDriver: sd})
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error '%s' gathering metrics \n", err)
+	}
+
+	expValues := map[string]float64{
+		"netplugin_resource_pool_capacity": 10,
+		"netplugin_resource_pool_used":     2,
+	}
+	for _, mf := range mfs {
+		expValue, ok := expValues[mf.GetName()]
+		if !ok {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("expected one %s metric, found %d \n", mf.GetName(),
+				len(mf.GetMetric()))
+		}
+		if value := mf.GetMetric()[0].GetGauge().GetValue(); value != expValue {
+			t.Fatalf("expected %s to be %v, found %v \n", mf.GetName(),
+				expValue, value)
+		}
+		delete(expValues, mf.GetName())
+	}
+	if len(expValues) != 0 {
+		t.Fatalf("metrics %v not reported \n", expValues)
+	}
+}
+
+func TestPoolCollectorHostVlans(t *testing.T) {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	defer func() { sd.Deinit() }()
+	ra := &EtcdResourceManager{Etcd: sd}
+
+	err := ra.DefineResource(poolCollectorTenant, AUTO_VXLAN_RSRC,
+		&AutoVxlanCfgResource{Vxlans: testVlanRange(0, 9),
+			LocalVlans: testVlanRange(1, 0), HostLocalVlans: true})
+	if err != nil {
+		t.Fatalf("error '%s' defining vxlan resource \n", err)
+	}
+	hostVlans := &drivers.OvsCfgHostVlansState{Vlans: "3000-3003"}
+	hostVlans.StateDriver = sd
+	err = hostVlans.Write()
+	if err != nil {
+		t.Fatalf("error '%s' writing the host vlans \n", err)
+	}
+	_, err = drivers.AllocHostVlan(sd, "host1", "orange")
+	if err != nil {
+		t.Fatalf("error '%s' allocating host vlan \n", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&PoolCollector{StateDriver: sd})
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error '%s' gathering metrics \n", err)
+	}
+
+	// the local vlans are reported for the host, not for the tenant
+	expValues := map[string]float64{
+		"netplugin_host_vlan_pool_capacity": 4,
+		"netplugin_host_vlan_pool_used":     1,
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "resource" &&
+					label.GetValue() == LOCAL_VLAN_POOL {
+					t.Fatalf("local vlan pool reported for tenant %v \n", m)
+				}
+			}
+		}
+		expValue, ok := expValues[mf.GetName()]
+		if !ok {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 ||
+			mf.GetMetric()[0].GetLabel()[0].GetValue() != "host1" {
+			t.Fatalf("expected one %s metric for host1, found %v \n",
+				mf.GetName(), mf.GetMetric())
+		}
+		if value := mf.GetMetric()[0].GetGauge().GetValue(); value != expValue {
+			t.Fatalf("expected %s to be %v, found %v \n", mf.GetName(),
+				expValue, value)
+		}
+		delete(expValues, mf.GetName())
+	}
+	if len(expValues) != 0 {
+		t.Fatalf("metrics %v not reported \n", expValues)
+	}
+}
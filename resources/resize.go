@@ -0,0 +1,45 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"log"
+
+	"github.com/contiv/netplugin/core"
+)
+
+// resizing a resource changes its range of values in place. The values that
+// are in use must remain in the new range, the free values are recomputed
+// from the new range. The cfg and the oper state of the resized resource are
+// written together: if the oper state can't be written the previous cfg state
+// is restored, so that the two never disagree.
+
+func writeResized(cfg, oper, prevCfg core.State) error {
+	err := cfg.Write()
+	if err != nil {
+		return err
+	}
+
+	err = oper.Write()
+	if err != nil {
+		if err1 := prevCfg.Write(); err1 != nil {
+			log.Printf("error '%s' restoring resource cfg \n", err1)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/contiv/netplugin/drivers"
+	"github.com/contiv/netplugin/netutils"
+	"github.com/jainvipin/bitset"
+)
+
+const (
+	resizeTenant = "resizeTenant"
+)
+
+func newResizeTestRA() *EtcdResourceManager {
+	sd := &drivers.FakeStateDriver{}
+	sd.Init(nil)
+	return &EtcdResourceManager{Etcd: sd}
+}
+
+func testVlanRange(min, max uint) *bitset.BitSet {
+	vlans := netutils.CreateBitset(12)
+	for vlan := min; vlan <= max; vlan++ {
+		vlans.Set(vlan)
+	}
+	return vlans
+}
+
+func TestVlanRsrcResize(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_VLAN_RSRC, testVlanRange(10, 11))
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	vlan, err := ra.AllocateResourceVal(resizeTenant, AUTO_VLAN_RSRC)
+	if err != nil || vlan.(uint) != 10 {
+		t.Fatalf("error '%v' allocating vlan, allocated %v \n", err, vlan)
+	}
+
+	err = ra.RedefineResource(resizeTenant, AUTO_VLAN_RSRC,
+		&AutoVlanCfgResource{Vlans: testVlanRange(11, 20)})
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("shrinking below a vlan in use, err '%v' \n", err)
+	}
+
+	err = ra.RedefineResource(resizeTenant, AUTO_VLAN_RSRC,
+		&AutoVlanCfgResource{Vlans: testVlanRange(10, 12)})
+	if err != nil {
+		t.Fatalf("error '%s' expanding vlan resource \n", err)
+	}
+
+	// the allocated vlan is kept, the rest of the range is free
+	for _, expVlan := range []uint{11, 12} {
+		vlan, err = ra.AllocateResourceVal(resizeTenant, AUTO_VLAN_RSRC)
+		if err != nil || vlan.(uint) != expVlan {
+			t.Fatalf("error '%v' allocating vlan, allocated %v expected %d \n",
+				err, vlan, expVlan)
+		}
+	}
+	_, err = ra.AllocateResourceVal(resizeTenant, AUTO_VLAN_RSRC)
+	if err == nil {
+		t.Fatalf("allocation beyond the resized range succeeded \n")
+	}
+}
+
+func TestSubnetRsrcResize(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.0.0"),
+			SubnetPoolLen: 23, AllocSubnetLen: 24})
+	if err != nil {
+		t.Fatalf("error '%s' defining subnet resource \n", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = ra.AllocateResourceVal(resizeTenant, AUTO_SUBNET_RSRC)
+		if err != nil {
+			t.Fatalf("error '%s' allocating subnet \n", err)
+		}
+	}
+
+	err = ra.RedefineResource(resizeTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.1.0"),
+			SubnetPoolLen: 24, AllocSubnetLen: 24})
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("shrinking below a subnet in use, err '%v' \n", err)
+	}
+
+	err = ra.RedefineResource(resizeTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.0.0"),
+			SubnetPoolLen: 22, AllocSubnetLen: 25})
+	if err == nil || !strings.Contains(err.Error(), "length") {
+		t.Fatalf("changing the allocated length of subnets in use, err '%v' \n",
+			err)
+	}
+
+	err = ra.RedefineResource(resizeTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.0.0"),
+			SubnetPoolLen: 22, AllocSubnetLen: 24})
+	if err != nil {
+		t.Fatalf("error '%s' expanding subnet resource \n", err)
+	}
+	pair, err := ra.AllocateResourceVal(resizeTenant, AUTO_SUBNET_RSRC)
+	if err != nil || pair.(SubnetIpLenPair).Ip.String() != "11.1.2.0" {
+		t.Fatalf("error '%v' allocating subnet from the expanded pool, "+
+			"allocated %v \n", err, pair)
+	}
+}
+
+func TestVxlanRsrcResize(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_VXLAN_RSRC,
+		&AutoVxlanCfgResource{Vxlans: testVlanRange(0, 1),
+			LocalVlans: testVlanRange(100, 101)})
+	if err != nil {
+		t.Fatalf("error '%s' defining vxlan resource \n", err)
+	}
+	_, err = ra.AllocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating vxlan \n", err)
+	}
+
+	// the base of the range moves two vxlans lower, the vxlan in use moves
+	// to offset 2
+	err = ra.RedefineResource(resizeTenant, AUTO_VXLAN_RSRC,
+		&VxlanResizeCfg{Vxlans: testVlanRange(0, 3),
+			LocalVlans: testVlanRange(100, 103), Rebase: 2})
+	if err != nil {
+		t.Fatalf("error '%s' expanding vxlan resource \n", err)
+	}
+	for _, expVxlan := range []uint{0, 1, 3} {
+		pair, err := ra.AllocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC)
+		if err != nil || pair.(VxlanVlanPair).Vxlan != expVxlan {
+			t.Fatalf("error '%v' allocating vxlan, allocated %v expected %d \n",
+				err, pair, expVxlan)
+		}
+	}
+
+	err = ra.RedefineResource(resizeTenant, AUTO_VXLAN_RSRC,
+		&VxlanResizeCfg{Vxlans: testVlanRange(0, 3),
+			LocalVlans: testVlanRange(100, 103), Rebase: -1})
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("moving the range away from a vxlan in use, err '%v' \n", err)
+	}
+}
@@ -46,6 +46,7 @@ type AutoSubnetCfgResource struct {
 	SubnetPool     net.IP `json:"subnetPool"`
 	SubnetPoolLen  uint   `json:"subnetPoolLen"`
 	AllocSubnetLen uint   `json:"allocSubnetLen"`
+	AllocStrategy  string `json:"allocStrategy"`
 }
 
 type SubnetIpLenPair struct {
@@ -81,12 +82,18 @@ func (r *AutoSubnetCfgResource) Init(rsrcCfg interface{}) error {
 	r.SubnetPool = cfg.SubnetPool
 	r.SubnetPoolLen = cfg.SubnetPoolLen
 	r.AllocSubnetLen = cfg.AllocSubnetLen
+	r.AllocStrategy = cfg.AllocStrategy
 
 	if cfg.AllocSubnetLen < cfg.SubnetPoolLen {
 		return &core.Error{Desc: "AllocSubnetLen should be greater than or equal to SubnetPoolLen"}
 	}
 
-	err := r.Write()
+	err := ValidateAllocStrategy(r.AllocStrategy)
+	if err != nil {
+		return err
+	}
+
+	err = r.Write()
 	if err != nil {
 		return err
 	}
@@ -129,6 +136,10 @@ func (r *AutoSubnetCfgResource) Description() string {
 }
 
 func (r *AutoSubnetCfgResource) Allocate() (interface{}, error) {
+	return r.AllocateWithHint("")
+}
+
+func (r *AutoSubnetCfgResource) AllocateWithHint(hint string) (interface{}, error) {
 	oper := &AutoSubnetOperResource{}
 	oper.StateDriver = r.StateDriver
 	err := oper.Read(r.Id)
@@ -136,12 +147,14 @@ func (r *AutoSubnetCfgResource) Allocate() (interface{}, error) {
 		return nil, err
 	}
 
-	subnet, ok := oper.FreeSubnets.NextSet(0)
+	subnet, ok := pickFreeBit(oper.FreeSubnets, r.AllocStrategy,
+		oper.NextSubnet, hint)
 	if !ok {
 		return nil, &core.Error{Desc: "no subnets available."}
 	}
 
 	oper.FreeSubnets.Clear(subnet)
+	oper.NextSubnet = subnet + 1
 
 	var subnetIp string
 	subnetIp, err = netutils.GetSubnetIp(r.SubnetPool.String(), r.SubnetPoolLen,
@@ -151,6 +164,7 @@ func (r *AutoSubnetCfgResource) Allocate() (interface{}, error) {
 	}
 
 	pair := SubnetIpLenPair{Ip: net.ParseIP(subnetIp), Len: r.AllocSubnetLen}
+	oper.Owners = setOwner(oper.Owners, r.subnetString(subnetIp), hint)
 	err = oper.Write()
 	if err != nil {
 		return nil, err
@@ -158,7 +172,27 @@ func (r *AutoSubnetCfgResource) Allocate() (interface{}, error) {
 	return pair, nil
 }
 
-func (r *AutoSubnetCfgResource) Deallocate(value interface{}) error {
+// subnetNumber returns the position in the pool of a subnet of the pool
+func (r *AutoSubnetCfgResource) subnetNumber(value interface{}) (SubnetIpLenPair,
+	uint, error) {
+	pair, ok := value.(SubnetIpLenPair)
+	if !ok {
+		return pair, 0, &core.Error{Desc: "Invalid type for subnet value"}
+	}
+
+	if pair.Len != r.AllocSubnetLen {
+		return pair, 0, &core.Error{Desc: fmt.Sprintf("Invalid subnet length. Exp: %d Rcvd: %d",
+			r.AllocSubnetLen, pair.Len)}
+	}
+
+	subnet, err := netutils.GetIpNumber(r.SubnetPool.String(), r.SubnetPoolLen,
+		pair.Len, pair.Ip.String())
+	return pair, subnet, err
+}
+
+// Reserve marks a subnet of the pool, given as its ip and length, as in use by
+// the owner
+func (r *AutoSubnetCfgResource) Reserve(value interface{}, owner string) error {
 	oper := &AutoSubnetOperResource{}
 	oper.StateDriver = r.StateDriver
 	err := oper.Read(r.Id)
@@ -166,19 +200,31 @@ func (r *AutoSubnetCfgResource) Deallocate(value interface{}) error {
 		return err
 	}
 
-	pair, ok := value.(SubnetIpLenPair)
-	if !ok {
-		return &core.Error{Desc: "Invalid type for subnet value"}
+	pair, subnet, err := r.subnetNumber(value)
+	if err != nil {
+		return err
 	}
 
-	if pair.Len != r.AllocSubnetLen {
-		return &core.Error{Desc: fmt.Sprintf("Invalid subnet length. Exp: %d Rcvd: %d",
-			r.AllocSubnetLen, pair.Len)}
+	if !oper.FreeSubnets.Test(subnet) {
+		return &core.Error{Desc: fmt.Sprintf("subnet %s is already in use",
+			r.subnetString(pair.Ip.String()))}
 	}
+	oper.FreeSubnets.Clear(subnet)
+	oper.Owners = setOwner(oper.Owners, r.subnetString(pair.Ip.String()),
+		owner)
 
-	var subnet uint
-	subnet, err = netutils.GetIpNumber(r.SubnetPool.String(), r.SubnetPoolLen,
-		pair.Len, pair.Ip.String())
+	return oper.Write()
+}
+
+func (r *AutoSubnetCfgResource) Deallocate(value interface{}) error {
+	oper := &AutoSubnetOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	pair, subnet, err := r.subnetNumber(value)
 	if err != nil {
 		return err
 	}
@@ -187,6 +233,7 @@ func (r *AutoSubnetCfgResource) Deallocate(value interface{}) error {
 		return nil
 	}
 	oper.FreeSubnets.Set(subnet)
+	delete(oper.Owners, r.subnetString(pair.Ip.String()))
 
 	err = oper.Write()
 	if err != nil {
@@ -195,9 +242,95 @@ func (r *AutoSubnetCfgResource) Deallocate(value interface{}) error {
 	return nil
 }
 
+func (r *AutoSubnetCfgResource) subnetString(subnetIp string) string {
+	return fmt.Sprintf("%s/%d", subnetIp, r.AllocSubnetLen)
+}
+
+func (r *AutoSubnetCfgResource) Usage() ([]core.ResourceUsage, error) {
+	oper := &AutoSubnetOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	subnets := netutils.CreateBitset(r.AllocSubnetLen - r.SubnetPoolLen).Complement()
+	usage, err := rangeUsage(r.Id, AUTO_SUBNET_RSRC, subnets, oper.FreeSubnets,
+		func(subnet uint) (string, error) {
+			subnetIp, err := netutils.GetSubnetIp(r.SubnetPool.String(),
+				r.SubnetPoolLen, r.AllocSubnetLen, subnet)
+			return r.subnetString(subnetIp), err
+		}, oper.Owners, "")
+	if err != nil {
+		return nil, err
+	}
+	return []core.ResourceUsage{usage}, nil
+}
+
+// Resize changes the pool of subnets, the subnets in use must remain in the
+// new pool. The length of the allocated subnets can change only while no
+// subnet is in use.
+func (r *AutoSubnetCfgResource) Resize(rsrcCfg interface{}) error {
+	cfg, ok := rsrcCfg.(*AutoSubnetCfgResource)
+	if !ok {
+		return &core.Error{Desc: "Invalid type for subnet resource config"}
+	}
+
+	if cfg.AllocSubnetLen < cfg.SubnetPoolLen {
+		return &core.Error{Desc: "AllocSubnetLen should be greater than or equal to SubnetPoolLen"}
+	}
+
+	oper := &AutoSubnetOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	allocSubnetSize := cfg.AllocSubnetLen - cfg.SubnetPoolLen
+	freeSubnets := netutils.CreateBitset(allocSubnetSize).Complement()
+	for subnet := uint(0); subnet < oper.FreeSubnets.Len(); subnet++ {
+		if oper.FreeSubnets.Test(subnet) {
+			continue
+		}
+
+		subnetIp, err := netutils.GetSubnetIp(r.SubnetPool.String(),
+			r.SubnetPoolLen, r.AllocSubnetLen, subnet)
+		if err != nil {
+			return err
+		}
+		if cfg.AllocSubnetLen != r.AllocSubnetLen {
+			return &core.Error{Desc: fmt.Sprintf(
+				"subnet %s/%d is in use, can't change the allocated subnet length",
+				subnetIp, r.AllocSubnetLen)}
+		}
+
+		newSubnet, err := netutils.GetIpNumber(cfg.SubnetPool.String(),
+			cfg.SubnetPoolLen, cfg.AllocSubnetLen, subnetIp)
+		if err != nil {
+			return &core.Error{Desc: fmt.Sprintf("subnet %s/%d is in use",
+				subnetIp, r.AllocSubnetLen)}
+		}
+		freeSubnets.Clear(newSubnet)
+	}
+
+	prevCfg := *r
+	r.SubnetPool = cfg.SubnetPool
+	r.SubnetPoolLen = cfg.SubnetPoolLen
+	r.AllocSubnetLen = cfg.AllocSubnetLen
+	oper.FreeSubnets = freeSubnets
+	// the allocation order restarts in the new pool
+	oper.NextSubnet = 0
+	return writeResized(r, oper, &prevCfg)
+}
+
 type AutoSubnetOperResource struct {
 	core.CommonState
 	FreeSubnets *bitset.BitSet `json:"freeSubnets"`
+	// subnet following the last allocated one, used by round-robin
+	NextSubnet uint `json:"nextSubnet"`
+	// networks the subnets are allocated to, by subnet
+	Owners map[string]string `json:"owners,omitempty"`
 }
 
 func (r *AutoSubnetOperResource) Write() error {
@@ -399,3 +399,43 @@ func TestAutoSubnetCfgResourceDeAllocate(t *testing.T) {
 		t.Fatalf("Subnet resource deallocation failed. Error: %s", err)
 	}
 }
+
+func TestAutoSubnetCfgResourceReserve(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.0.0"),
+			SubnetPoolLen: 22, AllocSubnetLen: 24})
+	if err != nil {
+		t.Fatalf("error '%s' defining subnet resource \n", err)
+	}
+
+	reserved := SubnetIpLenPair{Ip: net.ParseIP("11.1.0.0"), Len: 24}
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_SUBNET_RSRC, reserved, "net1")
+	if err != nil {
+		t.Fatalf("error '%s' reserving subnet \n", err)
+	}
+	pair, err := ra.AllocateResourceVal(resizeTenant, AUTO_SUBNET_RSRC)
+	if err != nil || !pair.(SubnetIpLenPair).Ip.Equal(net.ParseIP("11.1.1.0")) {
+		t.Fatalf("error '%v' allocating subnet, allocated %+v \n", err, pair)
+	}
+
+	// a subnet in use, out of the pool or of another length can't be reserved
+	for _, pair := range []SubnetIpLenPair{reserved,
+		{Ip: net.ParseIP("11.1.4.0"), Len: 24},
+		{Ip: net.ParseIP("11.1.2.0"), Len: 23}} {
+		err = ra.ReserveResourceVal(resizeTenant, AUTO_SUBNET_RSRC, pair, "net1")
+		if err == nil {
+			t.Fatalf("reserved subnet %+v, expected to fail \n", pair)
+		}
+	}
+
+	// the reserved subnet is freed like an allocated one
+	err = ra.DeallocateResourceVal(resizeTenant, AUTO_SUBNET_RSRC, reserved)
+	if err != nil {
+		t.Fatalf("error '%s' freeing reserved subnet \n", err)
+	}
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_SUBNET_RSRC, reserved, "net1")
+	if err != nil {
+		t.Fatalf("error '%s' reserving freed subnet \n", err)
+	}
+}
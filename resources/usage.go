@@ -0,0 +1,76 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strconv"
+
+	"github.com/contiv/netplugin/core"
+	"github.com/jainvipin/bitset"
+)
+
+// usage of the resources. The resources allocated with a hint record the hint,
+// the name of the network the value is allocated to, as the owner of the
+// value in their oper state. The owners are keyed by the value as reported in
+// the usage.
+
+// setOwner records the owner of a value, an allocation without an owner drops
+// the owner left by a previous allocation of the value
+func setOwner(owners map[string]string, value, owner string) map[string]string {
+	if owner == "" {
+		delete(owners, value)
+		return owners
+	}
+	if owners == nil {
+		owners = make(map[string]string)
+	}
+	owners[value] = owner
+	return owners
+}
+
+func tagString(tag uint) string {
+	return strconv.Itoa(int(tag))
+}
+
+// rangeUsage reports the values of a range that aren't free. The owner of a
+// value is looked up in the owners, or is the default owner if not found.
+func rangeUsage(id, desc string, valRange, free *bitset.BitSet,
+	value func(uint) (string, error), owners map[string]string,
+	defaultOwner string) (core.ResourceUsage, error) {
+	usage := core.ResourceUsage{Id: id, Description: desc,
+		Allocated: []core.AllocatedValue{}}
+	for bit, ok := valRange.NextSet(0); ok; bit, ok = valRange.NextSet(bit + 1) {
+		usage.Capacity++
+		if free.Test(bit) {
+			usage.Free++
+			continue
+		}
+
+		val, err := value(bit)
+		if err != nil {
+			return usage, err
+		}
+		owner, found := owners[val]
+		if !found {
+			owner = defaultOwner
+		}
+		usage.Allocated = append(usage.Allocated,
+			core.AllocatedValue{Value: val, Owner: owner})
+	}
+	usage.Used = usage.Capacity - usage.Free
+
+	return usage, nil
+}
@@ -0,0 +1,185 @@
+/***
+Copyright 2014 Cisco Systems Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/contiv/netplugin/core"
+)
+
+const (
+	usageTenant  = "usageTenant"
+	usageNetwork = "usageNetwork"
+)
+
+func verifyUsage(t *testing.T, usage, expUsage core.ResourceUsage) {
+	if !reflect.DeepEqual(usage, expUsage) {
+		t.Fatalf("usage %+v, expected %+v \n", usage, expUsage)
+	}
+}
+
+func TestResourceUsage(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(usageTenant, AUTO_VLAN_RSRC, testVlanRange(10, 13))
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	err = ra.DefineResource(usageTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.0.0"),
+			SubnetPoolLen: 23, AllocSubnetLen: 24})
+	if err != nil {
+		t.Fatalf("error '%s' defining subnet resource \n", err)
+	}
+	err = ra.DefineResource(usageNetwork, AUTO_IP_RSRC,
+		&AutoIpCfgResource{SubnetIp: net.ParseIP("11.1.0.0"), SubnetLen: 30,
+			AllocStart: 1, AllocEnd: 2})
+	if err != nil {
+		t.Fatalf("error '%s' defining ip resource \n", err)
+	}
+
+	for _, hint := range []string{"orange", "", "purple"} {
+		_, err = ra.AllocateResourceValWithHint(usageTenant, AUTO_VLAN_RSRC, hint)
+		if err != nil {
+			t.Fatalf("error '%s' allocating vlan \n", err)
+		}
+	}
+	err = ra.DeallocateResourceVal(usageTenant, AUTO_VLAN_RSRC, uint(12))
+	if err != nil {
+		t.Fatalf("error '%s' freeing vlan \n", err)
+	}
+	_, err = ra.AllocateResourceValWithHint(usageTenant, AUTO_SUBNET_RSRC,
+		"orange")
+	if err != nil {
+		t.Fatalf("error '%s' allocating subnet \n", err)
+	}
+	_, err = ra.AllocateResourceVal(usageNetwork, AUTO_IP_RSRC)
+	if err != nil {
+		t.Fatalf("error '%s' allocating ip \n", err)
+	}
+
+	usages, err := ra.GetResourceUsage(usageTenant)
+	if err != nil || len(usages) != 2 {
+		t.Fatalf("error '%v' getting usage, got %+v \n", err, usages)
+	}
+	verifyUsage(t, usages[0], core.ResourceUsage{Id: usageTenant,
+		Description: AUTO_SUBNET_RSRC, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{
+			{Value: "11.1.0.0/24", Owner: "orange"}}})
+	verifyUsage(t, usages[1], core.ResourceUsage{Id: usageTenant,
+		Description: AUTO_VLAN_RSRC, Capacity: 4, Used: 2, Free: 2,
+		Allocated: []core.AllocatedValue{{Value: "10", Owner: "orange"},
+			{Value: "11"}}})
+
+	usages, err = ra.GetResourceUsage(usageNetwork)
+	if err != nil || len(usages) != 1 {
+		t.Fatalf("error '%v' getting usage, got %+v \n", err, usages)
+	}
+	verifyUsage(t, usages[0], core.ResourceUsage{Id: usageNetwork,
+		Description: AUTO_IP_RSRC, Capacity: 4, Used: 1, Free: 3,
+		Allocated: []core.AllocatedValue{
+			{Value: "11.1.0.1", Owner: usageNetwork}}})
+}
+
+func TestVxlanUsageResize(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(usageTenant, AUTO_VXLAN_RSRC,
+		&AutoVxlanCfgResource{Vxlans: testVlanRange(0, 1),
+			LocalVlans: testVlanRange(100, 101)})
+	if err != nil {
+		t.Fatalf("error '%s' defining vxlan resource \n", err)
+	}
+	_, err = ra.AllocateResourceValWithHint(usageTenant, AUTO_VXLAN_RSRC,
+		"orange")
+	if err != nil {
+		t.Fatalf("error '%s' allocating vxlan \n", err)
+	}
+
+	// the owner follows the vxlan to its new offset
+	err = ra.RedefineResource(usageTenant, AUTO_VXLAN_RSRC,
+		&VxlanResizeCfg{Vxlans: testVlanRange(0, 3),
+			LocalVlans: testVlanRange(100, 101), Rebase: 2})
+	if err != nil {
+		t.Fatalf("error '%s' expanding vxlan resource \n", err)
+	}
+
+	usages, err := ra.GetResourceUsage(usageTenant)
+	if err != nil || len(usages) != 2 {
+		t.Fatalf("error '%v' getting usage, got %+v \n", err, usages)
+	}
+	verifyUsage(t, usages[0], core.ResourceUsage{Id: usageTenant,
+		Description: AUTO_VXLAN_RSRC, Capacity: 4, Used: 1, Free: 3,
+		Allocated: []core.AllocatedValue{{Value: "2", Owner: "orange"}}})
+	verifyUsage(t, usages[1], core.ResourceUsage{Id: usageTenant,
+		Description: LOCAL_VLAN_POOL, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{{Value: "100", Owner: "orange"}}})
+}
+
+func TestReservedUsage(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(usageTenant, AUTO_VLAN_RSRC, testVlanRange(10, 11))
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+	err = ra.DefineResource(usageTenant, AUTO_SUBNET_RSRC,
+		&AutoSubnetCfgResource{SubnetPool: net.ParseIP("11.1.0.0"),
+			SubnetPoolLen: 23, AllocSubnetLen: 24})
+	if err != nil {
+		t.Fatalf("error '%s' defining subnet resource \n", err)
+	}
+	err = ra.DefineResource(usageTenant, AUTO_VXLAN_RSRC,
+		&AutoVxlanCfgResource{Vxlans: testVlanRange(0, 1),
+			LocalVlans: testVlanRange(100, 101)})
+	if err != nil {
+		t.Fatalf("error '%s' defining vxlan resource \n", err)
+	}
+
+	// the reserved values are owned like the allocated ones
+	err = ra.ReserveResourceVal(usageTenant, AUTO_VLAN_RSRC, uint(11), "orange")
+	if err != nil {
+		t.Fatalf("error '%s' reserving vlan \n", err)
+	}
+	err = ra.ReserveResourceVal(usageTenant, AUTO_SUBNET_RSRC,
+		SubnetIpLenPair{Ip: net.ParseIP("11.1.1.0"), Len: 24}, "orange")
+	if err != nil {
+		t.Fatalf("error '%s' reserving subnet \n", err)
+	}
+	err = ra.ReserveResourceVal(usageTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 1, Vlan: 101}, "purple")
+	if err != nil {
+		t.Fatalf("error '%s' reserving vxlan \n", err)
+	}
+
+	usages, err := ra.GetResourceUsage(usageTenant)
+	if err != nil || len(usages) != 4 {
+		t.Fatalf("error '%v' getting usage, got %+v \n", err, usages)
+	}
+	verifyUsage(t, usages[0], core.ResourceUsage{Id: usageTenant,
+		Description: AUTO_SUBNET_RSRC, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{
+			{Value: "11.1.1.0/24", Owner: "orange"}}})
+	verifyUsage(t, usages[1], core.ResourceUsage{Id: usageTenant,
+		Description: AUTO_VLAN_RSRC, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{{Value: "11", Owner: "orange"}}})
+	verifyUsage(t, usages[2], core.ResourceUsage{Id: usageTenant,
+		Description: AUTO_VXLAN_RSRC, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{{Value: "1", Owner: "purple"}}})
+	verifyUsage(t, usages[3], core.ResourceUsage{Id: usageTenant,
+		Description: LOCAL_VLAN_POOL, Capacity: 2, Used: 1, Free: 1,
+		Allocated: []core.AllocatedValue{{Value: "101", Owner: "purple"}}})
+}
@@ -26,7 +26,8 @@ import (
 
 // implements the Resource interface for an 'auto-vlan' resource.
 // 'auto-vlan' resource allocates a vlan from a range of vlan encaps specified
-// at time of resource instantiation
+// at time of resource instantiation, picking the vlan per the resource's
+// allocation strategy
 
 const (
 	AUTO_VLAN_RSRC = "auto-vlan"
@@ -41,7 +42,8 @@ const (
 
 type AutoVlanCfgResource struct {
 	core.CommonState
-	Vlans *bitset.BitSet `json:"vlans"`
+	Vlans         *bitset.BitSet `json:"vlans"`
+	AllocStrategy string         `json:"allocStrategy"`
 }
 
 func (r *AutoVlanCfgResource) Write() error {
@@ -65,12 +67,21 @@ func (r *AutoVlanCfgResource) ReadAll() ([]core.State, error) {
 }
 
 func (r *AutoVlanCfgResource) Init(rsrcCfg interface{}) error {
-	var ok bool
-	r.Vlans, ok = rsrcCfg.(*bitset.BitSet)
-	if !ok {
+	switch cfg := rsrcCfg.(type) {
+	case *bitset.BitSet:
+		r.Vlans = cfg
+	case *AutoVlanCfgResource:
+		r.Vlans = cfg.Vlans
+		r.AllocStrategy = cfg.AllocStrategy
+	default:
 		return &core.Error{Desc: "Invalid type for vlan resource config"}
 	}
-	err := r.Write()
+	err := ValidateAllocStrategy(r.AllocStrategy)
+	if err != nil {
+		return err
+	}
+
+	err = r.Write()
 	if err != nil {
 		return err
 	}
@@ -112,6 +123,10 @@ func (r *AutoVlanCfgResource) Description() string {
 }
 
 func (r *AutoVlanCfgResource) Allocate() (interface{}, error) {
+	return r.AllocateWithHint("")
+}
+
+func (r *AutoVlanCfgResource) AllocateWithHint(hint string) (interface{}, error) {
 	oper := &AutoVlanOperResource{}
 	oper.StateDriver = r.StateDriver
 	err := oper.Read(r.Id)
@@ -119,12 +134,15 @@ func (r *AutoVlanCfgResource) Allocate() (interface{}, error) {
 		return nil, err
 	}
 
-	vlan, ok := oper.FreeVlans.NextSet(0)
+	vlan, ok := pickFreeBit(oper.FreeVlans, r.AllocStrategy, oper.NextVlan,
+		hint)
 	if !ok {
 		return nil, &core.Error{Desc: "no vlans available."}
 	}
 
 	oper.FreeVlans.Clear(vlan)
+	oper.NextVlan = vlan + 1
+	oper.Owners = setOwner(oper.Owners, tagString(vlan), hint)
 
 	err = oper.Write()
 	if err != nil {
@@ -133,6 +151,32 @@ func (r *AutoVlanCfgResource) Allocate() (interface{}, error) {
 	return vlan, nil
 }
 
+// Reserve marks a vlan of the range as in use by the owner
+func (r *AutoVlanCfgResource) Reserve(value interface{}, owner string) error {
+	oper := &AutoVlanOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	vlan, ok := value.(uint)
+	if !ok {
+		return &core.Error{Desc: "Invalid type for vlan value"}
+	}
+	if !r.Vlans.Test(vlan) {
+		return &core.Error{Desc: fmt.Sprintf("vlan %d is out of the range",
+			vlan)}
+	}
+	if !oper.FreeVlans.Test(vlan) {
+		return &core.Error{Desc: fmt.Sprintf("vlan %d is in use", vlan)}
+	}
+	oper.FreeVlans.Clear(vlan)
+	oper.Owners = setOwner(oper.Owners, tagString(vlan), owner)
+
+	return oper.Write()
+}
+
 func (r *AutoVlanCfgResource) Deallocate(value interface{}) error {
 	oper := &AutoVlanOperResource{}
 	oper.StateDriver = r.StateDriver
@@ -149,6 +193,7 @@ func (r *AutoVlanCfgResource) Deallocate(value interface{}) error {
 		return nil
 	}
 	oper.FreeVlans.Set(vlan)
+	delete(oper.Owners, tagString(vlan))
 
 	err = oper.Write()
 	if err != nil {
@@ -157,9 +202,62 @@ func (r *AutoVlanCfgResource) Deallocate(value interface{}) error {
 	return nil
 }
 
+func (r *AutoVlanCfgResource) Usage() ([]core.ResourceUsage, error) {
+	oper := &AutoVlanOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := rangeUsage(r.Id, AUTO_VLAN_RSRC, r.Vlans, oper.FreeVlans,
+		func(vlan uint) (string, error) { return tagString(vlan), nil },
+		oper.Owners, "")
+	if err != nil {
+		return nil, err
+	}
+	return []core.ResourceUsage{usage}, nil
+}
+
+// Resize changes the range of vlans, the vlans in use must remain in the new
+// range
+func (r *AutoVlanCfgResource) Resize(rsrcCfg interface{}) error {
+	cfg, ok := rsrcCfg.(*AutoVlanCfgResource)
+	if !ok {
+		return &core.Error{Desc: "Invalid type for vlan resource config"}
+	}
+
+	oper := &AutoVlanOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	freeVlans := cfg.Vlans.Clone()
+	for vlan, ok := r.Vlans.NextSet(0); ok; vlan, ok = r.Vlans.NextSet(vlan + 1) {
+		if oper.FreeVlans.Test(vlan) {
+			continue
+		}
+		if !cfg.Vlans.Test(vlan) {
+			return &core.Error{Desc: fmt.Sprintf("vlan %d is in use", vlan)}
+		}
+		freeVlans.Clear(vlan)
+	}
+
+	prevCfg := *r
+	r.Vlans = cfg.Vlans
+	oper.FreeVlans = freeVlans
+	return writeResized(r, oper, &prevCfg)
+}
+
 type AutoVlanOperResource struct {
 	core.CommonState
 	FreeVlans *bitset.BitSet `json:"freeVlans"`
+	// vlan following the last allocated one, used by round-robin
+	NextVlan uint `json:"nextVlan"`
+	// networks the vlans are allocated to, by vlan
+	Owners map[string]string `json:"owners,omitempty"`
 }
 
 func (r *AutoVlanOperResource) Write() error {
@@ -375,3 +375,39 @@ func TestAutoVlanCfgResourceDeAllocate(t *testing.T) {
 		t.Fatalf("Vlan resource deallocation failed. Error: %s", err)
 	}
 }
+
+func TestAutoVlanCfgResourceReserve(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_VLAN_RSRC,
+		&AutoVlanCfgResource{Vlans: testVlanRange(10, 11)})
+	if err != nil {
+		t.Fatalf("error '%s' defining vlan resource \n", err)
+	}
+
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_VLAN_RSRC, uint(10), "net1")
+	if err != nil {
+		t.Fatalf("error '%s' reserving vlan \n", err)
+	}
+	vlan, err := ra.AllocateResourceVal(resizeTenant, AUTO_VLAN_RSRC)
+	if err != nil || vlan.(uint) != 11 {
+		t.Fatalf("error '%v' allocating vlan, allocated %v \n", err, vlan)
+	}
+
+	// a vlan in use or out of the range can't be reserved
+	for _, vlan := range []uint{10, 11, 12} {
+		err = ra.ReserveResourceVal(resizeTenant, AUTO_VLAN_RSRC, vlan, "net1")
+		if err == nil {
+			t.Fatalf("reserved vlan %d, expected to fail \n", vlan)
+		}
+	}
+
+	// the reserved vlan is freed like an allocated one
+	err = ra.DeallocateResourceVal(resizeTenant, AUTO_VLAN_RSRC, uint(10))
+	if err != nil {
+		t.Fatalf("error '%s' freeing reserved vlan \n", err)
+	}
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_VLAN_RSRC, uint(10), "net1")
+	if err != nil {
+		t.Fatalf("error '%s' reserving freed vlan \n", err)
+	}
+}
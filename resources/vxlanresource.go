@@ -18,6 +18,7 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/contiv/netplugin/core"
 	"github.com/contiv/netplugin/drivers"
@@ -43,6 +44,19 @@ type AutoVxlanCfgResource struct {
 	core.CommonState
 	Vxlans     *bitset.BitSet `json:"vxlans"`
 	LocalVlans *bitset.BitSet `json:"LocalVlans"`
+	// strategy to pick the vxlans and local vlans with
+	AllocStrategy string `json:"allocStrategy"`
+	// the hosts pick the local vlans of the vxlans, none are allocated with
+	// the vxlans
+	HostLocalVlans bool `json:"hostLocalVlans"`
+}
+
+// config of a vxlan resource's resize. The vxlans are relative to the new base
+// of the vxlan range, which is 'Rebase' lower than the current one.
+type VxlanResizeCfg struct {
+	Vxlans     *bitset.BitSet
+	LocalVlans *bitset.BitSet
+	Rebase     int
 }
 
 type VxlanVlanPair struct {
@@ -77,7 +91,14 @@ func (r *AutoVxlanCfgResource) Init(rsrcCfg interface{}) error {
 	}
 	r.Vxlans = cfg.Vxlans
 	r.LocalVlans = cfg.LocalVlans
-	err := r.Write()
+	r.AllocStrategy = cfg.AllocStrategy
+	r.HostLocalVlans = cfg.HostLocalVlans
+	err := ValidateAllocStrategy(r.AllocStrategy)
+	if err != nil {
+		return err
+	}
+
+	err = r.Write()
 	if err != nil {
 		return err
 	}
@@ -119,6 +140,10 @@ func (r *AutoVxlanCfgResource) Description() string {
 }
 
 func (r *AutoVxlanCfgResource) Allocate() (interface{}, error) {
+	return r.AllocateWithHint("")
+}
+
+func (r *AutoVxlanCfgResource) AllocateWithHint(hint string) (interface{}, error) {
 	oper := &AutoVxlanOperResource{}
 	oper.StateDriver = r.StateDriver
 	err := oper.Read(r.Id)
@@ -126,18 +151,28 @@ func (r *AutoVxlanCfgResource) Allocate() (interface{}, error) {
 		return nil, err
 	}
 
-	vxlan, ok := oper.FreeVxlans.NextSet(0)
+	vxlan, ok := pickFreeBit(oper.FreeVxlans, r.AllocStrategy,
+		oper.NextVxlan, hint)
 	if !ok {
 		return nil, &core.Error{Desc: "no vxlans available."}
 	}
 
-	vlan, ok := oper.FreeLocalVlans.NextSet(0)
-	if !ok {
-		return nil, &core.Error{Desc: "no local vlans available."}
-	}
-
 	oper.FreeVxlans.Clear(vxlan)
-	oper.FreeLocalVlans.Clear(vlan)
+	oper.NextVxlan = vxlan + 1
+	oper.Owners = setOwner(oper.Owners, tagString(vxlan), hint)
+
+	vlan := uint(0)
+	if !r.HostLocalVlans {
+		vlan, ok = pickFreeBit(oper.FreeLocalVlans, r.AllocStrategy,
+			oper.NextLocalVlan, hint)
+		if !ok {
+			return nil, &core.Error{Desc: "no local vlans available."}
+		}
+		oper.FreeLocalVlans.Clear(vlan)
+		oper.NextLocalVlan = vlan + 1
+		oper.LocalVlanOwners = setOwner(oper.LocalVlanOwners, tagString(vlan),
+			hint)
+	}
 
 	err = oper.Write()
 	if err != nil {
@@ -146,6 +181,48 @@ func (r *AutoVxlanCfgResource) Allocate() (interface{}, error) {
 	return VxlanVlanPair{Vxlan: vxlan, Vlan: vlan}, nil
 }
 
+// Reserve marks a vxlan, given as an offset from the start of the vxlan range,
+// and its local vlan as in use by the owner. The local vlan is left out when
+// the hosts pick the local vlans.
+func (r *AutoVxlanCfgResource) Reserve(value interface{}, owner string) error {
+	oper := &AutoVxlanOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	pair, ok := value.(VxlanVlanPair)
+	if !ok {
+		return &core.Error{Desc: "Invalid type for vxlan-vlan pair"}
+	}
+	if !r.Vxlans.Test(pair.Vxlan) {
+		return &core.Error{Desc: fmt.Sprintf("vxlan at offset %d is out of the range",
+			pair.Vxlan)}
+	}
+	if !oper.FreeVxlans.Test(pair.Vxlan) {
+		return &core.Error{Desc: fmt.Sprintf("vxlan at offset %d of the range is in use",
+			pair.Vxlan)}
+	}
+	if !r.HostLocalVlans {
+		if !r.LocalVlans.Test(pair.Vlan) {
+			return &core.Error{Desc: fmt.Sprintf("vlan %d isn't a local vlan",
+				pair.Vlan)}
+		}
+		if !oper.FreeLocalVlans.Test(pair.Vlan) {
+			return &core.Error{Desc: fmt.Sprintf("local vlan %d is in use",
+				pair.Vlan)}
+		}
+		oper.FreeLocalVlans.Clear(pair.Vlan)
+		oper.LocalVlanOwners = setOwner(oper.LocalVlanOwners,
+			tagString(pair.Vlan), owner)
+	}
+	oper.FreeVxlans.Clear(pair.Vxlan)
+	oper.Owners = setOwner(oper.Owners, tagString(pair.Vxlan), owner)
+
+	return oper.Write()
+}
+
 func (r *AutoVxlanCfgResource) Deallocate(value interface{}) error {
 	oper := &AutoVxlanOperResource{}
 	oper.StateDriver = r.StateDriver
@@ -160,8 +237,11 @@ func (r *AutoVxlanCfgResource) Deallocate(value interface{}) error {
 	}
 	vxlan := pair.Vxlan
 	oper.FreeVxlans.Set(vxlan)
-	vlan := pair.Vlan
-	oper.FreeLocalVlans.Set(vlan)
+	delete(oper.Owners, tagString(vxlan))
+	if vlan := pair.Vlan; !r.HostLocalVlans {
+		oper.FreeLocalVlans.Set(vlan)
+		delete(oper.LocalVlanOwners, tagString(vlan))
+	}
 
 	err = oper.Write()
 	if err != nil {
@@ -170,10 +250,104 @@ func (r *AutoVxlanCfgResource) Deallocate(value interface{}) error {
 	return nil
 }
 
+// Usage reports the vxlans as offsets from the start of the vxlan range, like
+// they are allocated. The local vlans are reported along, unless the hosts
+// pick them.
+func (r *AutoVxlanCfgResource) Usage() ([]core.ResourceUsage, error) {
+	oper := &AutoVxlanOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	tagValue := func(tag uint) (string, error) { return tagString(tag), nil }
+	vxlans, err := rangeUsage(r.Id, AUTO_VXLAN_RSRC, r.Vxlans, oper.FreeVxlans,
+		tagValue, oper.Owners, "")
+	if err != nil {
+		return nil, err
+	}
+	if r.HostLocalVlans {
+		return []core.ResourceUsage{vxlans}, nil
+	}
+	localVlans, err := rangeUsage(r.Id, LOCAL_VLAN_POOL, r.LocalVlans,
+		oper.FreeLocalVlans, tagValue, oper.LocalVlanOwners, "")
+	if err != nil {
+		return nil, err
+	}
+	return []core.ResourceUsage{vxlans, localVlans}, nil
+}
+
+// Resize changes the range of vxlans and the local vlans, the vxlans and the
+// local vlans in use must remain in the new ranges
+func (r *AutoVxlanCfgResource) Resize(rsrcCfg interface{}) error {
+	cfg, ok := rsrcCfg.(*VxlanResizeCfg)
+	if !ok {
+		return &core.Error{Desc: "Invalid vxlan resource config."}
+	}
+
+	oper := &AutoVxlanOperResource{}
+	oper.StateDriver = r.StateDriver
+	err := oper.Read(r.Id)
+	if err != nil {
+		return err
+	}
+
+	freeVxlans := cfg.Vxlans.Clone()
+	for vxlan, ok := r.Vxlans.NextSet(0); ok; vxlan, ok = r.Vxlans.NextSet(vxlan + 1) {
+		if oper.FreeVxlans.Test(vxlan) {
+			continue
+		}
+		newVxlan := int(vxlan) + cfg.Rebase
+		if newVxlan < 0 || !cfg.Vxlans.Test(uint(newVxlan)) {
+			return &core.Error{Desc: fmt.Sprintf("vxlan at offset %d of the range is in use",
+				vxlan)}
+		}
+		freeVxlans.Clear(uint(newVxlan))
+	}
+
+	freeLocalVlans := cfg.LocalVlans.Clone()
+	for vlan, ok := r.LocalVlans.NextSet(0); ok; vlan, ok = r.LocalVlans.NextSet(vlan + 1) {
+		if oper.FreeLocalVlans.Test(vlan) {
+			continue
+		}
+		if !cfg.LocalVlans.Test(vlan) {
+			return &core.Error{Desc: fmt.Sprintf("local vlan %d is in use", vlan)}
+		}
+		freeLocalVlans.Clear(vlan)
+	}
+
+	prevCfg := *r
+	r.Vxlans = cfg.Vxlans
+	r.LocalVlans = cfg.LocalVlans
+	oper.FreeVxlans = freeVxlans
+	oper.FreeLocalVlans = freeLocalVlans
+	owners := map[string]string{}
+	for vxlan, owner := range oper.Owners {
+		offset, _ := strconv.Atoi(vxlan)
+		owners[strconv.Itoa(offset+cfg.Rebase)] = owner
+	}
+	oper.Owners = owners
+	if int(oper.NextVxlan)+cfg.Rebase > 0 {
+		oper.NextVxlan = uint(int(oper.NextVxlan) + cfg.Rebase)
+	} else {
+		oper.NextVxlan = 0
+	}
+	return writeResized(r, oper, &prevCfg)
+}
+
 type AutoVxlanOperResource struct {
 	core.CommonState
 	FreeVxlans     *bitset.BitSet `json:"freeVxlans"`
 	FreeLocalVlans *bitset.BitSet `json:"freeLocalVlans"`
+	// vxlan and local vlan following the last allocated ones, used by
+	// round-robin
+	NextVxlan     uint `json:"nextVxlan"`
+	NextLocalVlan uint `json:"nextLocalVlan"`
+	// networks the vxlans and the local vlans are allocated to, by vxlan
+	// offset and by local vlan
+	Owners          map[string]string `json:"owners,omitempty"`
+	LocalVlanOwners map[string]string `json:"localVlanOwners,omitempty"`
 }
 
 func (r *AutoVxlanOperResource) Write() error {
@@ -434,3 +434,92 @@ func TestAutoVxlanCfgResourceDeAllocate(t *testing.T) {
 		t.Fatalf("Vxlan resource deallocation failed. Error: %s", err)
 	}
 }
+
+func TestAutoVxlanCfgResourceNoLocalVlans(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_VXLAN_RSRC,
+		&AutoVxlanCfgResource{Vxlans: testVlanRange(0, 1),
+			LocalVlans: testVlanRange(1, 0), HostLocalVlans: true})
+	if err != nil {
+		t.Fatalf("error '%s' defining vxlan resource \n", err)
+	}
+
+	// the vxlans are allocated without a local vlan, the hosts pick them
+	for vxlan := uint(0); vxlan <= 1; vxlan++ {
+		pair, err := ra.AllocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC)
+		if err != nil || pair != (VxlanVlanPair{Vxlan: vxlan}) {
+			t.Fatalf("error '%v' allocating vxlan, allocated %+v \n", err, pair)
+		}
+	}
+	_, err = ra.AllocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC)
+	if err == nil || err.Error() != "no vxlans available." {
+		t.Fatalf("error '%v', expected the vxlans to run out \n", err)
+	}
+
+	err = ra.DeallocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 1})
+	if err != nil {
+		t.Fatalf("error '%s' freeing vxlan \n", err)
+	}
+	pair, err := ra.AllocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC)
+	if err != nil || pair != (VxlanVlanPair{Vxlan: 1}) {
+		t.Fatalf("error '%v' allocating freed vxlan, allocated %+v \n", err, pair)
+	}
+
+	// the hosts report the usage of the local vlans they pick
+	usages, err := ra.GetResourceUsage(resizeTenant)
+	if err != nil || len(usages) != 1 || usages[0].Description != AUTO_VXLAN_RSRC {
+		t.Fatalf("error '%v' getting usage, got %+v \n", err, usages)
+	}
+}
+
+func TestAutoVxlanCfgResourceReserve(t *testing.T) {
+	ra := newResizeTestRA()
+	err := ra.DefineResource(resizeTenant, AUTO_VXLAN_RSRC,
+		&AutoVxlanCfgResource{Vxlans: testVlanRange(0, 1),
+			LocalVlans: testVlanRange(100, 101)})
+	if err != nil {
+		t.Fatalf("error '%s' defining vxlan resource \n", err)
+	}
+
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 1, Vlan: 101}, "net1")
+	if err != nil {
+		t.Fatalf("error '%s' reserving vxlan \n", err)
+	}
+	pair, err := ra.AllocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC)
+	if err != nil || pair != (VxlanVlanPair{Vxlan: 0, Vlan: 100}) {
+		t.Fatalf("error '%v' allocating vxlan, allocated %+v \n", err, pair)
+	}
+
+	// a vxlan in use or out of the range can't be reserved
+	err = ra.DeallocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 0, Vlan: 100})
+	if err != nil {
+		t.Fatalf("error '%s' freeing vxlan \n", err)
+	}
+	for _, pair := range []VxlanVlanPair{{Vxlan: 1, Vlan: 100},
+		{Vxlan: 2, Vlan: 100}} {
+		err = ra.ReserveResourceVal(resizeTenant, AUTO_VXLAN_RSRC, pair, "net1")
+		if err == nil {
+			t.Fatalf("reserved vxlan %+v, expected to fail \n", pair)
+		}
+	}
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 0, Vlan: 102}, "net1")
+	if err == nil || !strings.Contains(err.Error(), "isn't a local vlan") {
+		t.Fatalf("reserving a vlan out of the local vlans, err '%v' \n", err)
+	}
+
+	// the reserved vxlan and local vlan are freed like allocated ones
+	err = ra.DeallocateResourceVal(resizeTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 1, Vlan: 101})
+	if err != nil {
+		t.Fatalf("error '%s' freeing reserved vxlan \n", err)
+	}
+	err = ra.ReserveResourceVal(resizeTenant, AUTO_VXLAN_RSRC,
+		VxlanVlanPair{Vxlan: 1, Vlan: 101}, "net1")
+	if err != nil {
+		t.Fatalf("error '%s' reserving freed vxlan \n", err)
+	}
+}
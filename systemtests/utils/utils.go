@@ -96,7 +96,7 @@ func applyConfig(t *testing.T, cfgType, jsonCfg string, node VagrantNode) {
 			err, cmdStr, output)
 	}
 
-	cmdStr = "netdcli -" + cfgType + " /tmp/netdcli.cfg 2>&1"
+	cmdStr = "netdcli -force -" + cfgType + " /tmp/netdcli.cfg 2>&1"
 	output, err = node.RunCommandWithOutput(cmdStr)
 	if err != nil {
 		t.Fatalf("Failed to apply config. Error: %s\nCmd: %q\nOutput:\n%s\n",